@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +17,8 @@ const (
 	TASK_STATUS_PENDING   = 0 // 待执行
 	TASK_STATUS_COMPLETED = 1 // 已执行
 	TASK_STATUS_FAILED    = 2 // 失败
+	TASK_STATUS_RUNNING   = 3 // 执行中
+	TASK_STATUS_CANCELLED = 4 // 已取消
 )
 
 // APIResponse 统一响应结构
@@ -26,14 +29,38 @@ type APIResponse struct {
 }
 
 // CrawlRequest 爬取请求结构
+// 请求级的站点、优先级等选项作用于 keywords 中的所有关键词，tasks 中未填写的项也使用请求级选项
 type CrawlRequest struct {
-	Keywords []string `json:"keywords"`
+	Keywords    []string           `json:"keywords"`
+	Tasks       []CrawlTaskRequest `json:"tasks"`        // 可选，逐个关键词指定站点、优先级等选项
+	CallbackURL string             `json:"callback_url"` // 可选，每个新增关键词任务结束后回调
+	CrawlTaskOptions
+}
+
+// CrawlTaskRequest 带选项的单个关键词
+type CrawlTaskRequest struct {
+	Keyword string `json:"keyword"`
+	CrawlTaskOptions
+}
+
+// CrawlTaskOptions 关键词任务的站点、优先级和抓取深度，未填写的项使用默认值
+type CrawlTaskOptions struct {
+	Domain    string `json:"domain,omitempty"`     // 站点域名或站点代码（如 www.amazon.com.mx、MX），默认配置文件的 domain
+	Priority  int    `json:"priority,omitempty"`   // 优先级，越大越先执行，默认 0
+	MaxPages  int    `json:"max_pages,omitempty"`  // 最多搜索的结果页数，默认 1
+	MaxASINs  int    `json:"max_asins,omitempty"`  // 最多处理的商品数，默认不限
+	NotBefore string `json:"not_before,omitempty"` // 最早执行时间，RFC3339 或 2006-01-02 15:04:05（本地时间）
+
+	Recrawl     string `json:"recrawl,omitempty"`      // 关键词已提交过时的处理方式：skip（默认）/ force / stale
+	MaxAgeDays  int    `json:"max_age_days,omitempty"` // recrawl 为 stale 时，最近一次完成早于该天数才重新执行
+	RefreshDays int    `json:"refresh_days,omitempty"` // 完成后超过该天数自动重新执行，0 表示不自动刷新
 }
 
 // CrawlResponseData 爬取响应数据
 type CrawlResponseData struct {
 	Total    int `json:"total"`    // 提交的总数
 	Inserted int `json:"inserted"` // 新插入的数量
+	Requeued int `json:"requeued"` // 已存在并按 recrawl 重新排队的数量
 	Skipped  int `json:"skipped"`  // 跳过的数量（已存在）
 }
 
@@ -49,10 +76,11 @@ type ASINInspectionRequestItem struct {
 }
 
 type ASINInspectionRequest struct {
-	JobID   string                      `json:"job_id"`
-	Domain  string                      `json:"domain"`
-	Items   []ASINInspectionRequestItem `json:"items"`
-	Options ASINInspectionOptions       `json:"options"`
+	JobID       string                      `json:"job_id"`
+	Domain      string                      `json:"domain"`
+	Items       []ASINInspectionRequestItem `json:"items"`
+	Options     ASINInspectionOptions       `json:"options"`
+	CallbackURL string                      `json:"callback_url"` // 可选，仅异步巡检任务使用，任务完成后回调
 }
 
 type ASINInspectionResponseData struct {
@@ -84,29 +112,81 @@ type ASINInspectionResponseItem struct {
 	NewerModel      string `json:"newer_model"`
 	ErrorMessage    string `json:"error_message"`
 	CapturedAt      string `json:"captured_at"`
+
+	Seller      *InspectionSeller `json:"seller,omitempty"`       // include_seller 时返回
+	SellerError string            `json:"seller_error,omitempty"` // 获取卖家信息失败的原因
+	Offers      []InspectionOffer `json:"offers,omitempty"`       // include_offer 时返回
+	OfferError  string            `json:"offer_error,omitempty"`  // 获取报价失败的原因
 }
 
-// StartHTTPServer 启动 HTTP 服务
-func StartHTTPServer(addr string) {
+// HTTP_SHUTDOWN_TIMEOUT 关闭 HTTP 服务时等待进行中请求的最长时间
+const HTTP_SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// StartHTTPServer 启动 HTTP 服务，阻塞至 ctx 取消后服务关闭
+func StartHTTPServer(ctx context.Context, addr string) error {
 	mux := http.NewServeMux()
 
-	// 注册路由
-	mux.HandleFunc("/api/crawl", handleCrawl)
-	mux.HandleFunc("/api/asin-inspection", handleASINInspection)
-	mux.HandleFunc("/api/status", handleStatus)
+	// 注册路由，除 /health 外都需要鉴权
+	mux.HandleFunc("/api/crawl", withAuth(SCOPE_CRAWL_SUBMIT, SCOPE_CRAWL_SUBMIT, handleCrawl))
+	mux.HandleFunc("/api/asin-inspection", withAuth(SCOPE_INSPECTION_RUN, SCOPE_INSPECTION_RUN, handleASINInspection))
+	mux.HandleFunc("/api/asin-inspection/jobs", withAuth(SCOPE_INSPECTION_RUN, SCOPE_INSPECTION_RUN, handleInspectionJobs))
+	mux.HandleFunc("/api/asin-inspection/jobs/", withAuth(SCOPE_DATA_READ, SCOPE_INSPECTION_RUN, handleInspectionJob))
+	mux.HandleFunc("/api/status", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleStatus))
+	mux.HandleFunc("/api/tasks", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleTasks))
+	mux.HandleFunc("/api/tasks/", withAuth(SCOPE_DATA_READ, SCOPE_CRAWL_SUBMIT, handleTask))
+	mux.HandleFunc("/api/products", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleResults(productResults)))
+	mux.HandleFunc("/api/sellers", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleResults(sellerResults)))
+	mux.HandleFunc("/api/shops", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleResults(shopResults)))
+	mux.HandleFunc("/api/schedules", withAuth(SCOPE_DATA_READ, SCOPE_ADMIN, handleSchedules))
+	mux.HandleFunc("/api/schedules/", withAuth(SCOPE_DATA_READ, SCOPE_ADMIN, handleSchedule))
+	mux.HandleFunc("/api/proxies", withAuth(SCOPE_ADMIN, SCOPE_ADMIN, handleProxies))
+	mux.HandleFunc("/api/claims", withAuth(SCOPE_ADMIN, SCOPE_ADMIN, handleClaims))
+	mux.HandleFunc("/api/instances", withAuth(SCOPE_ADMIN, SCOPE_ADMIN, handleInstances))
+	mux.HandleFunc("/metrics", withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, handleMetrics))
 	mux.HandleFunc("/health", handleHealth)
 
 	log.Infof("HTTP 服务启动在 %s", addr)
+	if apiKeys.enabled() {
+		log.Infof("已加载 %d 个 API 密钥，接口需携带令牌访问", len(apiKeys.keys))
+	} else {
+		log.Warnf("未配置 API 密钥（auth.keys 或环境变量 CRAWLER_API_TOKEN），HTTP 接口不做鉴权")
+	}
 	log.Infof("可用接口:")
 	log.Infof("  POST /api/crawl  - 提交爬取任务")
 	log.Infof("  POST /api/asin-inspection - ASIN/链接实时巡检")
+	log.Infof("  POST /api/asin-inspection/jobs - 提交异步巡检任务")
+	log.Infof("  GET  /api/asin-inspection/jobs/{id} - 查看巡检任务进度和结果")
+	log.Infof("  GET  /api/asin-inspection/jobs/{id}/xlsx - 下载已完成巡检任务的 xlsx")
 	log.Infof("  GET  /api/status - 查看任务状态")
+	log.Infof("  GET  /api/products、/api/sellers、/api/shops - 分页查询商品、卖家、店铺，Accept: text/csv 时导出 CSV")
+	log.Infof("  GET  /api/schedules - 查看定时任务，POST 新增定时任务")
+	log.Infof("  GET/PUT/DELETE /api/schedules/{id} - 查看、修改、删除定时任务，POST /api/schedules/{id}/run 立即执行")
+	log.Infof("  GET  /api/proxies - 查看代理池状态")
+	log.Infof("  GET  /api/claims - 查看各 app_id 持有的商品/商家认领")
+	log.Infof("  GET  /api/instances - 查看已登记的实例及心跳")
+	log.Infof("  GET  /metrics    - Prometheus 指标")
 	log.Infof("  GET  /health     - 健康检查")
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	srv := &http.Server{Addr: addr, Handler: mux}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		log.Infof("正在关闭 HTTP 服务，等待进行中的请求完成")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("HTTP 服务关闭失败: %v", err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
 		log.Errorf("HTTP 服务启动失败: %v", err)
-		panic(err)
+		return err
 	}
+	<-stopped
+	log.Infof("HTTP 服务已关闭")
+	return nil
 }
 
 // handleCrawl 处理爬取请求 - 将关键词写入 amc_category 表
@@ -133,47 +213,63 @@ func handleCrawl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证参数
-	if len(req.Keywords) == 0 {
+	if len(req.Keywords) == 0 && len(req.Tasks) == 0 {
 		writeJSON(w, http.StatusBadRequest, APIResponse{
 			Code:    -1,
-			Message: "keywords 不能为空",
+			Message: "keywords 和 tasks 不能都为空",
+		})
+		return
+	}
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{
+			Code:    -1,
+			Message: err.Error(),
+		})
+		return
+	}
+	tasks, err := buildKeywordTasks(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{
+			Code:    -1,
+			Message: err.Error(),
 		})
 		return
 	}
 
 	// 将关键词写入数据库
 	inserted := 0
+	requeued := 0
 	skipped := 0
-	for _, kw := range req.Keywords {
-		err := insertKeywordTask(kw)
-		if err != nil {
-			if is_duplicate_entry(err) {
-				skipped++
-				log.Infof("关键词已存在，跳过: %s", kw)
-			} else {
-				log.Errorf("插入关键词失败: %s, 错误: %v", kw, err)
-			}
-		} else {
+	for _, t := range tasks {
+		result, err := submitKeywordTask(t)
+		switch {
+		case err != nil:
+			log.Errorf("插入关键词失败: %s, 错误: %v", t.Keyword, err)
+		case result == SUBMIT_INSERTED:
 			inserted++
-			log.Infof("关键词已入库: %s", kw)
+			log.Infof("关键词已入库: %s (%s)", t.Keyword, t.Domain)
+		case result == SUBMIT_REQUEUED:
+			requeued++
+			log.Infof("关键词已存在，重新排队: %s (%s)", t.Keyword, t.Domain)
+		default:
+			skipped++
+			log.Infof("关键词已存在，跳过: %s (%s)", t.Keyword, t.Domain)
 		}
 	}
 
-	log.Infof("收到爬取请求，共 %d 个关键词，新增 %d 个，跳过 %d 个", len(req.Keywords), inserted, skipped)
+	log.Infof("收到爬取请求，共 %d 个关键词，新增 %d 个，重新排队 %d 个，跳过 %d 个", len(tasks), inserted, requeued, skipped)
 
 	// 通知 Worker 有新任务（非阻塞）
-	select {
-	case taskNotify <- struct{}{}:
-	default:
-	}
+	notifyTaskWorkers()
 
 	// 返回成功响应
 	writeJSON(w, http.StatusOK, APIResponse{
 		Code:    0,
 		Message: "任务已提交",
 		Data: CrawlResponseData{
-			Total:    len(req.Keywords),
+			Total:    len(tasks),
 			Inserted: inserted,
+			Requeued: requeued,
 			Skipped:  skipped,
 		},
 	})
@@ -182,9 +278,6 @@ func handleCrawl(w http.ResponseWriter, r *http.Request) {
 func handleASINInspection(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if !checkCrawlerToken(w, r) {
-		return
-	}
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
 			Code:    -1,
@@ -211,19 +304,16 @@ func handleASINInspection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := app.get_cookie(); err != nil {
-		log.Warnf("获取 Cookie 失败: %v，将不使用 Cookie", err)
-	}
-
 	domain := normalizeDomain(req.Domain)
 	if domain == "" {
 		domain = normalizeDomain(app.Domain)
 	}
 	inspector := NewLinkInspector("", domain, "")
+	inspector.options = req.Options
 	responseItems := make([]ASINInspectionResponseItem, 0, len(items))
 	for i, item := range items {
 		log.Infof("ASIN巡检: %d/%d %s", i+1, len(items), item.Original)
-		result := inspector.inspectItem(item)
+		result := inspector.inspectItem(r.Context(), item)
 		responseItems = append(responseItems, linkInspectionResultToAPIItem(result, time.Now().UTC().Format(time.RFC3339)))
 	}
 
@@ -237,27 +327,20 @@ func handleASINInspection(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func checkCrawlerToken(w http.ResponseWriter, r *http.Request) bool {
-	token := strings.TrimSpace(os.Getenv("CRAWLER_API_TOKEN"))
-	if token == "" {
-		return true
-	}
-	if r.Header.Get("X-Crawler-Token") == token {
-		return true
-	}
-	writeJSON(w, http.StatusUnauthorized, APIResponse{
-		Code:    -1,
-		Message: "无效的 X-Crawler-Token",
-	})
-	return false
-}
+// ASIN_INSPECTION_MAX_ITEMS 实时巡检单次最多提交的条数，更多条目请使用异步巡检任务
+const ASIN_INSPECTION_MAX_ITEMS = 50
 
 func buildASINInspectionItems(req ASINInspectionRequest) ([]LinkInspectionItem, error) {
+	return buildInspectionItems(req, ASIN_INSPECTION_MAX_ITEMS)
+}
+
+// buildInspectionItems 解析并去重巡检条目，最多 maxItems 条
+func buildInspectionItems(req ASINInspectionRequest, maxItems int) ([]LinkInspectionItem, error) {
 	if len(req.Items) == 0 {
 		return nil, fmt.Errorf("items 不能为空")
 	}
-	if len(req.Items) > 50 {
-		return nil, fmt.Errorf("items 不能超过 50 条")
+	if len(req.Items) > maxItems {
+		return nil, fmt.Errorf("items 不能超过 %d 条", maxItems)
 	}
 
 	defaultDomain := normalizeDomain(req.Domain)
@@ -327,15 +410,141 @@ func linkInspectionResultToAPIItem(result LinkInspectionResult, capturedAt strin
 		NewerModel:      result.NewerModel,
 		ErrorMessage:    result.ErrorMessage,
 		CapturedAt:      capturedAt,
+		Seller:          result.Seller,
+		SellerError:     result.SellerError,
+		Offers:          result.Offers,
+		OfferError:      result.OfferError,
+	}
+}
+
+// CRAWL_MAX_PAGES 单个关键词最多搜索的结果页数
+const CRAWL_MAX_PAGES = 20
+
+// NewKeywordTask 待写入 amc_category 的关键词任务
+type NewKeywordTask struct {
+	Keyword     string
+	Domain      string // 站点域名
+	Priority    int
+	MaxPages    int       // 0 表示 1 页
+	MaxASINs    int       // 0 表示不限
+	NotBefore   time.Time // 零值表示立即执行
+	CallbackURL string    // 为空时不回调
+	Recrawl     string    // 已存在时的处理方式，见 RECRAWL_*
+	MaxAgeDays  int       // Recrawl 为 stale 时的天数
+	RefreshDays int       // 完成后超过该天数自动重新执行，0 表示不自动刷新
+}
+
+// notBefore not_before 列的值，未设置时为 NULL
+func (t NewKeywordTask) notBefore() interface{} {
+	if t.NotBefore.IsZero() {
+		return nil
 	}
+	return t.NotBefore.Local().Format("2006-01-02 15:04:05")
 }
 
-// insertKeywordTask 将关键词插入到 amc_category 表
-func insertKeywordTask(keyword string) error {
+// buildKeywordTasks 合并请求级和关键词级选项，校验并生成待写入的任务
+func buildKeywordTasks(req CrawlRequest) ([]NewKeywordTask, error) {
+	items := make([]CrawlTaskRequest, 0, len(req.Keywords)+len(req.Tasks))
+	for _, kw := range req.Keywords {
+		items = append(items, CrawlTaskRequest{Keyword: kw})
+	}
+	items = append(items, req.Tasks...)
+
+	tasks := make([]NewKeywordTask, 0, len(items))
+	for _, item := range items {
+		keyword := strings.TrimSpace(item.Keyword)
+		if keyword == "" {
+			return nil, fmt.Errorf("关键词不能为空")
+		}
+		t, err := item.CrawlTaskOptions.withDefaults(req.CrawlTaskOptions).newTask(keyword)
+		if err != nil {
+			return nil, fmt.Errorf("关键词 %s: %w", keyword, err)
+		}
+		t.CallbackURL = req.CallbackURL
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+// withDefaults 未填写的项使用 def 中的值
+func (o CrawlTaskOptions) withDefaults(def CrawlTaskOptions) CrawlTaskOptions {
+	if o.Domain == "" {
+		o.Domain = def.Domain
+	}
+	if o.Priority == 0 {
+		o.Priority = def.Priority
+	}
+	if o.MaxPages == 0 {
+		o.MaxPages = def.MaxPages
+	}
+	if o.MaxASINs == 0 {
+		o.MaxASINs = def.MaxASINs
+	}
+	if o.NotBefore == "" {
+		o.NotBefore = def.NotBefore
+	}
+	if o.Recrawl == "" {
+		o.Recrawl = def.Recrawl
+	}
+	if o.MaxAgeDays == 0 {
+		o.MaxAgeDays = def.MaxAgeDays
+	}
+	if o.RefreshDays == 0 {
+		o.RefreshDays = def.RefreshDays
+	}
+	return o
+}
+
+// newTask 校验选项并生成任务，未指定站点时使用配置文件的 domain
+func (o CrawlTaskOptions) newTask(keyword string) (NewKeywordTask, error) {
+	t := NewKeywordTask{Keyword: keyword, Domain: app.Domain, Priority: o.Priority, MaxPages: o.MaxPages, MaxASINs: o.MaxASINs,
+		Recrawl: o.Recrawl, MaxAgeDays: o.MaxAgeDays, RefreshDays: o.RefreshDays}
+	if o.Domain != "" {
+		domain, err := resolveMarketplaceDomain(o.Domain)
+		if err != nil {
+			return t, err
+		}
+		t.Domain = domain
+	}
+	if o.MaxPages < 0 || o.MaxPages > CRAWL_MAX_PAGES {
+		return t, fmt.Errorf("max_pages 取值范围为 1-%d", CRAWL_MAX_PAGES)
+	}
+	if o.MaxASINs < 0 {
+		return t, fmt.Errorf("max_asins 不能为负数")
+	}
+	if o.RefreshDays < 0 {
+		return t, fmt.Errorf("refresh_days 不能为负数")
+	}
+	if err := validateRecrawl(o.Recrawl, o.MaxAgeDays); err != nil {
+		return t, err
+	}
+	if o.NotBefore != "" {
+		notBefore, err := parseNotBefore(o.NotBefore)
+		if err != nil {
+			return t, err
+		}
+		t.NotBefore = notBefore
+	}
+	return t, nil
+}
+
+// parseNotBefore 解析 RFC3339 或本地时间格式的 not_before
+func parseNotBefore(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("not_before 格式无效: %s，应为 RFC3339 或 2006-01-02 15:04:05", s)
+}
+
+// insertKeywordTask 将关键词任务插入到 amc_category 表
+func insertKeywordTask(t NewKeywordTask) error {
 	// zh_key 和 en_key 都使用同一个关键词
 	_, err := app.db.Exec(
-		"INSERT INTO amc_category (zh_key, en_key, task_status) VALUES (?, ?, ?)",
-		keyword, keyword, TASK_STATUS_PENDING,
+		"INSERT INTO amc_category (zh_key, en_key, domain, priority, max_pages, max_asins, not_before, refresh_days, task_status, callback_url) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		t.Keyword, t.Keyword, t.Domain, t.Priority, t.MaxPages, t.MaxASINs, t.notBefore(), t.RefreshDays, TASK_STATUS_PENDING, nullableString(t.CallbackURL),
 	)
 	return err
 }
@@ -353,18 +562,133 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 查询各状态的任务数量
-	var pending, completed, failed int
+	var pending, running, completed, failed, cancelled int
 	app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE task_status = ?", TASK_STATUS_PENDING).Scan(&pending)
+	app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE task_status = ?", TASK_STATUS_RUNNING).Scan(&running)
 	app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE task_status = ?", TASK_STATUS_COMPLETED).Scan(&completed)
 	app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE task_status = ?", TASK_STATUS_FAILED).Scan(&failed)
+	app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE task_status = ?", TASK_STATUS_CANCELLED).Scan(&cancelled)
 
 	writeJSON(w, http.StatusOK, APIResponse{
 		Code:    0,
 		Message: "ok",
 		Data: map[string]interface{}{
 			"pending":   pending,
+			"running":   running,
 			"completed": completed,
 			"failed":    failed,
+			"cancelled": cancelled,
+		},
+	})
+}
+
+// handleProxies 查看代理池状态
+func handleProxies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data: map[string]interface{}{
+			"enable":  app.Proxy.Enable,
+			"proxies": proxyPool.Snapshot(),
+		},
+	})
+}
+
+// handleClaims 查看各 app_id 当前持有的商品/商家认领
+func handleClaims(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+
+	holders, err := claimReport(r.Context())
+	if err != nil {
+		log.Errorf("查询认领情况失败: %v", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询认领情况失败",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data: map[string]interface{}{
+			"lease_seconds": app.Claim.Lease_seconds,
+			"holders":       holders,
+		},
+	})
+}
+
+// handleInstances 查看已登记的实例、心跳和失联情况
+// 参数 active=1 只返回未结束的实例，limit 为返回条数（默认 50，最大 500）
+func handleInstances(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: "limit 必须是正整数",
+			})
+			return
+		}
+		if n > 500 {
+			n = 500
+		}
+		limit = n
+	}
+	activeOnly := r.URL.Query().Get("active") == "1"
+
+	instances, err := listInstances(r.Context(), activeOnly, limit)
+	if err != nil {
+		log.Errorf("查询实例失败: %v", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询实例失败",
+		})
+		return
+	}
+
+	stale := 0
+	for _, i := range instances {
+		if i.State == INSTANCE_STATE_STALE {
+			stale++
+		}
+	}
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data: map[string]interface{}{
+			"heartbeat_interval": app.Instance.Heartbeat_interval,
+			"stale":              stale,
+			"instances":          instances,
 		},
 	})
 }
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"net/http"
-	"net/http/httptest"
+	"context"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildASINInspectionItems(t *testing.T) {
@@ -73,22 +74,67 @@ func TestLinkInspectionResultToAPIItemIncludesOriginalAndActualASIN(t *testing.T
 	}
 }
 
-func TestCheckCrawlerToken(t *testing.T) {
-	t.Setenv("CRAWLER_API_TOKEN", "secret")
+func TestBuildKeywordTasks(t *testing.T) {
+	oldDomain := app.Domain
+	app.Domain = "www.amazon.com"
+	t.Cleanup(func() { app.Domain = oldDomain })
 
-	req := httptest.NewRequest(http.MethodPost, "/api/asin-inspection", nil)
-	rr := httptest.NewRecorder()
-	if checkCrawlerToken(rr, req) {
-		t.Fatal("expected request without token to fail")
+	req := CrawlRequest{
+		Keywords:         []string{"nike"},
+		Tasks:            []CrawlTaskRequest{{Keyword: "puma", CrawlTaskOptions: CrawlTaskOptions{Domain: "UK", MaxPages: 3}}},
+		CallbackURL:      "https://example.com/hook",
+		CrawlTaskOptions: CrawlTaskOptions{Domain: "amazon.com.mx", Priority: 5, MaxASINs: 40, NotBefore: "2026-06-06T08:00:00Z"},
 	}
-	if rr.Code != http.StatusUnauthorized {
-		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	tasks, err := buildKeywordTasks(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("len(tasks) = %d, want 2", len(tasks))
 	}
+	assertEqual(t, "nike domain", tasks[0].Domain, "www.amazon.com.mx")
+	assertEqual(t, "nike priority", strconv.Itoa(tasks[0].Priority), "5")
+	assertEqual(t, "nike max_asins", strconv.Itoa(tasks[0].MaxASINs), "40")
+	assertEqual(t, "nike not_before", tasks[0].NotBefore.UTC().Format(time.RFC3339), "2026-06-06T08:00:00Z")
+	assertEqual(t, "nike callback", tasks[0].CallbackURL, "https://example.com/hook")
+	assertEqual(t, "puma domain", tasks[1].Domain, "www.amazon.co.uk")
+	assertEqual(t, "puma max_pages", strconv.Itoa(tasks[1].MaxPages), "3")
+	assertEqual(t, "puma priority", strconv.Itoa(tasks[1].Priority), "5")
+
+	tasks, _ = buildKeywordTasks(CrawlRequest{Keywords: []string{"adidas"}})
+	assertEqual(t, "default domain", tasks[0].Domain, "www.amazon.com")
+	if !tasks[0].NotBefore.IsZero() {
+		t.Error("not_before should be empty")
+	}
+}
+
+func TestBuildKeywordTasksRejectsInvalidOptions(t *testing.T) {
+	bad := []CrawlRequest{
+		{Keywords: []string{" "}},
+		{Keywords: []string{"nike"}, CrawlTaskOptions: CrawlTaskOptions{Domain: "www.example.com"}},
+		{Keywords: []string{"nike"}, CrawlTaskOptions: CrawlTaskOptions{MaxPages: CRAWL_MAX_PAGES + 1}},
+		{Keywords: []string{"nike"}, CrawlTaskOptions: CrawlTaskOptions{MaxASINs: -1}},
+		{Tasks: []CrawlTaskRequest{{Keyword: "nike", CrawlTaskOptions: CrawlTaskOptions{NotBefore: "tomorrow"}}}},
+	}
+	for i, req := range bad {
+		if _, err := buildKeywordTasks(req); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestStartHTTPServerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- StartHTTPServer(ctx, "127.0.0.1:0") }()
 
-	req = httptest.NewRequest(http.MethodPost, "/api/asin-inspection", nil)
-	req.Header.Set("X-Crawler-Token", "secret")
-	rr = httptest.NewRecorder()
-	if !checkCrawlerToken(rr, req) {
-		t.Fatal("expected request with token to pass")
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after cancel")
 	}
 }
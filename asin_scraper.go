@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -46,35 +46,31 @@ func NewASINScraper(asinStr, domain string) *ASINScraper {
 }
 
 // Run 执行爬虫主流程
-func (s *ASINScraper) Run() error {
+// ctx 取消时停止处理后续 ASIN，已完成的结果仍会导出
+func (s *ASINScraper) Run(ctx context.Context) error {
 	log.Infof("开始处理 %d 个 ASIN", len(s.asinList))
 
-	// 1. 获取 Cookie
-	if _, err := app.get_cookie(); err != nil {
-		log.Warnf("获取 Cookie 失败: %v，将不使用 Cookie", err)
-	}
-
-	// 2. 遍历 ASIN 列表
+	// 1. 遍历 ASIN 列表（每次请求由 fetcher 在会话锁内刷新 Cookie）
 	for i, asin := range s.asinList {
 		log.Infof("进度: %d/%d - 处理 ASIN: %s", i+1, len(s.asinList), asin)
 
-		result := s.scrapeASIN(asin)
-		s.results = append(s.results, result)
-
-		// 延迟等待（2-3 秒）
-		if i < len(s.asinList)-1 {
-			delay := 2 + rangdom_range(2)
-			log.Infof("等待 %d 秒后继续...", delay)
-			time.Sleep(time.Duration(delay) * time.Second)
+		done := instance.beginTask("asin:" + asin)
+		result := s.scrapeASIN(ctx, asin)
+		done()
+		if ctx.Err() != nil {
+			log.Warnf("收到退出信号，已处理 %d/%d 个 ASIN，导出已完成的结果", i, len(s.asinList))
+			break
 		}
+		recordTaskResult(METRIC_TASK_ASIN, s.domain, result.ErrorMessage == "")
+		s.results = append(s.results, result)
 	}
 
-	// 3. 导出 CSV
+	// 2. 导出 CSV
 	return s.exportCSV()
 }
 
 // scrapeASIN 爬取单个 ASIN 的数据
-func (s *ASINScraper) scrapeASIN(asin string) ASINResult {
+func (s *ASINScraper) scrapeASIN(ctx context.Context, asin string) ASINResult {
 	result := ASINResult{
 		ASIN:   asin,
 		Status: "success",
@@ -83,64 +79,20 @@ func (s *ASINScraper) scrapeASIN(asin string) ASINResult {
 	// 构建产品页面 URL
 	url := fmt.Sprintf("https://%s/dp/%s", s.domain, asin)
 
-	// 检查 robots.txt
-	fp := GetCurrentFingerprint()
-	if err := robot.IsAllow(fp.UserAgent, url); err != nil {
-		log.Errorf("robots.txt 不允许访问: %v", err)
-		result.Status = "error"
-		result.ErrorMessage = err.Error()
-		return result
-	}
-
-	// 发送请求
-	client := get_client()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		result.Status = "error"
-		result.ErrorMessage = err.Error()
-		return result
-	}
-
-	// 设置请求头（复用 product.go 的逻辑）
-	s.setRequestHeaders(req)
-
-	// 添加 Cookie
-	if app.cookie != "" {
-		req.Header.Set("Cookie", app.cookie)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		result.Status = "error"
-		result.ErrorMessage = err.Error()
-		return result
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		result.Status = "error"
-		result.ErrorMessage = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		return result
-	}
-
-	// 解析 HTML
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: url, Mode: FETCH_MODE_ASIN})
 	if err != nil {
 		result.Status = "error"
 		result.ErrorMessage = err.Error()
-		return result
-	}
-
-	// 检查验证页面
-	if doc.Find("h4").First().Text() == "Enter the characters you see below" {
-		result.Status = "error"
-		result.ErrorMessage = "需要验证"
-		// 尝试切换 Cookie
-		if err := app.handleCookieInvalid(); err != nil {
-			log.Errorf("切换 Cookie 失败: %v", err)
+		if isCookieRejected(err) {
+			result.ErrorMessage = "需要验证"
+			// 尝试切换 Cookie
+			if err := app.handleCookieInvalid(); err != nil {
+				log.Errorf("切换 Cookie 失败: %v", err)
+			}
 		}
 		return result
 	}
+	doc := page.Doc
 
 	// 提取评论数
 	result.ReviewCount = s.extractReviewCount(doc)
@@ -270,12 +222,6 @@ func (s *ASINScraper) extractReviewCount(doc *goquery.Document) int {
 	return 0
 }
 
-// setRequestHeaders 设置请求头
-func (s *ASINScraper) setRequestHeaders(req *http.Request) {
-	// 使用统一的指纹系统
-	ApplyFingerprint(req, GetRandomReferer(s.domain))
-}
-
 // exportCSV 导出 CSV 文件
 func (s *ASINScraper) exportCSV() error {
 	// 创建输出目录
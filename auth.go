@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// API 权限范围
+const (
+	SCOPE_CRAWL_SUBMIT   = "crawl:submit"   // 提交关键词爬取，重试、取消任务
+	SCOPE_INSPECTION_RUN = "inspection:run" // ASIN 实时巡检、提交异步巡检任务
+	SCOPE_DATA_READ      = "data:read"      // 查询任务、巡检结果、运行状态和监控指标
+	SCOPE_ADMIN          = "admin"          // 代理池、认领、实例、定时任务等运维接口
+	SCOPE_ALL            = "*"              // 全部权限
+)
+
+var knownScopes = map[string]bool{
+	SCOPE_CRAWL_SUBMIT:   true,
+	SCOPE_INSPECTION_RUN: true,
+	SCOPE_DATA_READ:      true,
+	SCOPE_ADMIN:          true,
+	SCOPE_ALL:            true,
+}
+
+// LEGACY_API_KEY_NAME 环境变量 CRAWLER_API_TOKEN 对应的密钥名，拥有全部权限
+const LEGACY_API_KEY_NAME = "legacy"
+
+// API_AUDIT_BODY_LIMIT 审计日志中保存的请求体最大字符数
+const API_AUDIT_BODY_LIMIT = 4096
+
+// API_MAX_BODY_BYTES 开启鉴权时写请求的请求体上限
+const API_MAX_BODY_BYTES = 4 << 20
+
+// APIKeyConfig 一个 API 密钥
+type APIKeyConfig struct {
+	Name         string   `yaml:"name"`         // 密钥名，记录在审计日志和用量统计中
+	Token        string   `yaml:"token"`        // 令牌明文
+	Token_sha256 string   `yaml:"token_sha256"` // 令牌的 SHA-256（十六进制），与 token 二选一，避免配置文件中出现明文
+	Scopes       []string `yaml:"scopes"`       // 权限范围: crawl:submit / inspection:run / data:read / admin / *
+	Rate_limit   float64  `yaml:"rate_limit"`   // 每秒请求数，0 不限速
+	Burst        int      `yaml:"burst"`        // 允许的突发请求数，默认 rate_limit 向上取整
+	Daily_quota  int      `yaml:"daily_quota"`  // 每日请求数上限，0 不限
+}
+
+// AuthConfig HTTP 接口鉴权配置
+// 未配置任何密钥且未设置环境变量 CRAWLER_API_TOKEN 时接口不做鉴权
+type AuthConfig struct {
+	Keys []APIKeyConfig `yaml:"keys"`
+}
+
+// withDefaults 未配置的项使用默认值，设置了环境变量 CRAWLER_API_TOKEN 时追加一个拥有全部权限的 legacy 密钥
+func (c AuthConfig) withDefaults() AuthConfig {
+	keys := make([]APIKeyConfig, 0, len(c.Keys)+1)
+	hasLegacy := false
+	for _, k := range c.Keys {
+		if k.Rate_limit > 0 && k.Burst <= 0 {
+			k.Burst = int(math.Ceil(k.Rate_limit))
+		}
+		if k.Name == LEGACY_API_KEY_NAME {
+			hasLegacy = true
+		}
+		keys = append(keys, k)
+	}
+	if token := strings.TrimSpace(os.Getenv("CRAWLER_API_TOKEN")); token != "" && !hasLegacy {
+		keys = append(keys, APIKeyConfig{Name: LEGACY_API_KEY_NAME, Token: token, Scopes: []string{SCOPE_ALL}})
+	}
+	c.Keys = keys
+	return c
+}
+
+// apiKey 已加载的密钥
+type apiKey struct {
+	name       string
+	hash       [sha256.Size]byte
+	scopes     map[string]bool
+	dailyQuota int
+	limiter    *rateLimiter // 未限速时为 nil
+}
+
+// allows 密钥是否拥有 scope 权限
+func (k *apiKey) allows(scope string) bool {
+	return k.scopes[SCOPE_ALL] || k.scopes[scope]
+}
+
+// apiKeyStore 密钥、限速和每日用量
+type apiKeyStore struct {
+	keys []*apiKey
+	now  func() time.Time
+
+	mu       sync.Mutex
+	usageDay string           // 内存用量对应的日期
+	usage    map[string]int64 // 未连接数据库时按密钥统计当日请求数
+}
+
+// 全局密钥库，init_config 中按配置重建；没有密钥时不鉴权
+var apiKeys = &apiKeyStore{now: time.Now}
+
+// newAPIKeyStore 校验配置并加载密钥
+func newAPIKeyStore(c AuthConfig) (*apiKeyStore, error) {
+	s := &apiKeyStore{now: time.Now}
+	names := make(map[string]bool)
+	for i, kc := range c.Keys {
+		if kc.Name == "" {
+			return nil, fmt.Errorf("auth.keys 第 %d 个密钥缺少 name", i+1)
+		}
+		if names[kc.Name] {
+			return nil, fmt.Errorf("auth.keys 密钥名重复: %s", kc.Name)
+		}
+		names[kc.Name] = true
+
+		k := &apiKey{name: kc.Name, scopes: make(map[string]bool), dailyQuota: kc.Daily_quota}
+		switch {
+		case kc.Token != "":
+			k.hash = sha256.Sum256([]byte(kc.Token))
+		case kc.Token_sha256 != "":
+			b, err := hex.DecodeString(strings.TrimSpace(kc.Token_sha256))
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("密钥 %s 的 token_sha256 不是有效的 SHA-256 十六进制值", kc.Name)
+			}
+			copy(k.hash[:], b)
+		default:
+			return nil, fmt.Errorf("密钥 %s 缺少 token 或 token_sha256", kc.Name)
+		}
+		if len(kc.Scopes) == 0 {
+			return nil, fmt.Errorf("密钥 %s 没有配置 scopes", kc.Name)
+		}
+		for _, scope := range kc.Scopes {
+			if !knownScopes[scope] {
+				return nil, fmt.Errorf("密钥 %s 的权限范围无效: %s", kc.Name, scope)
+			}
+			k.scopes[scope] = true
+		}
+		if kc.Rate_limit > 0 {
+			burst := kc.Burst
+			if burst <= 0 {
+				burst = 1
+			}
+			k.limiter = newRateLimiter(RateLimitConfig{Rate: kc.Rate_limit, Burst: burst})
+		}
+		s.keys = append(s.keys, k)
+	}
+	return s, nil
+}
+
+// enabled 是否开启鉴权
+func (s *apiKeyStore) enabled() bool {
+	return len(s.keys) > 0
+}
+
+// lookup 按令牌查找密钥，令牌取自 Authorization: Bearer 或 X-Crawler-Token
+func (s *apiKeyStore) lookup(r *http.Request) *apiKey {
+	token := strings.TrimSpace(r.Header.Get("X-Crawler-Token"))
+	if auth := r.Header.Get("Authorization"); token == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token = strings.TrimSpace(auth[7:])
+	}
+	if token == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	var found *apiKey
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+// countUsage 计入一次请求，返回密钥当日累计请求数
+// 连接数据库时记录在 amc_api_usage，多实例共享配额；否则只在本进程内统计
+func (s *apiKeyStore) countUsage(name string) (int64, error) {
+	day := s.now().Format("2006-01-02")
+	if app.db != nil {
+		r, err := app.db.Exec("INSERT INTO amc_api_usage (key_name, day, requests) VALUES (?, ?, LAST_INSERT_ID(1)) ON DUPLICATE KEY UPDATE requests = LAST_INSERT_ID(requests + 1)", name, day)
+		if err != nil {
+			return 0, err
+		}
+		return r.LastInsertId()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usageDay != day || s.usage == nil {
+		s.usageDay = day
+		s.usage = make(map[string]int64)
+	}
+	s.usage[name]++
+	return s.usage[name], nil
+}
+
+// untilTomorrow 距离次日零点的时间
+func (s *apiKeyStore) untilTomorrow() time.Duration {
+	now := s.now()
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// authorize 校验令牌、权限范围、限速和每日配额，不通过时写入错误响应并返回 false
+// 令牌有效时总是返回对应的密钥，用于审计
+func (s *apiKeyStore) authorize(w http.ResponseWriter, r *http.Request, scope string) (*apiKey, bool) {
+	k := s.lookup(r)
+	if k == nil {
+		writeJSON(w, http.StatusUnauthorized, APIResponse{Code: -1, Message: "缺少或无效的 API 令牌（Authorization: Bearer 或 X-Crawler-Token）"})
+		return nil, false
+	}
+	if !k.allows(scope) {
+		writeJSON(w, http.StatusForbidden, APIResponse{Code: -1, Message: fmt.Sprintf("密钥 %s 没有 %s 权限", k.name, scope)})
+		return k, false
+	}
+	if k.limiter != nil {
+		if wait := k.limiter.Reserve(k.name); wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			writeJSON(w, http.StatusTooManyRequests, APIResponse{Code: -1, Message: "请求过于频繁，请稍后重试"})
+			return k, false
+		}
+	}
+	if k.dailyQuota > 0 {
+		n, err := s.countUsage(k.name)
+		if err != nil {
+			log.Warnf("统计 API 用量失败，本次请求不计配额: %v", err)
+		} else if n > int64(k.dailyQuota) {
+			w.Header().Set("Retry-After", retryAfter(s.untilTomorrow()))
+			writeJSON(w, http.StatusTooManyRequests, APIResponse{Code: -1, Message: fmt.Sprintf("今日请求已达配额 %d 次", k.dailyQuota)})
+			return k, false
+		}
+	}
+	return k, true
+}
+
+// retryAfter Retry-After 响应头的秒数，向上取整
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// statusRecorder 记录响应状态码，用于审计日志
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// withAuth 接口鉴权中间件：GET/HEAD 请求需要 readScope 权限，其他方法需要 writeScope 权限；
+// 通过鉴权的写请求记录审计日志，被拒绝的请求只输出日志，避免未授权的调用方刷写 amc_api_audit
+func withAuth(readScope, writeScope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiKeys.enabled() {
+			h(w, r)
+			return
+		}
+		read := r.Method == http.MethodGet || r.Method == http.MethodHead
+		scope := writeScope
+		if read {
+			scope = readScope
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		k, ok := apiKeys.authorize(rec, r, scope)
+		if !ok {
+			name := ""
+			if k != nil {
+				name = k.name
+			}
+			log.Warnf("API 拒绝: %s %s %s 密钥=%s 状态=%d", r.RemoteAddr, r.Method, r.URL.RequestURI(), name, rec.status)
+			return
+		}
+
+		body := ""
+		if !read {
+			data, err := io.ReadAll(http.MaxBytesReader(rec, r.Body, API_MAX_BODY_BYTES))
+			if err != nil {
+				code, message := http.StatusBadRequest, fmt.Sprintf("读取请求体失败: %v", err)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					code, message = http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体不能超过 %d 字节", API_MAX_BODY_BYTES)
+				}
+				writeJSON(rec, code, APIResponse{Code: -1, Message: message})
+				recordAPIAudit(r, k.name, rec.status, "")
+				return
+			}
+			body = truncateRunes(string(data), API_AUDIT_BODY_LIMIT)
+			r.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		h(rec, r)
+		if !read {
+			recordAPIAudit(r, k.name, rec.status, body)
+		}
+	}
+}
+
+// recordAPIAudit 记录调用方、请求和响应状态，连接数据库时写入 amc_api_audit
+func recordAPIAudit(r *http.Request, keyName string, status int, body string) {
+	log.Infof("API 审计: %s %s %s 密钥=%s 状态=%d", r.RemoteAddr, r.Method, r.URL.RequestURI(), keyName, status)
+	if app.db == nil {
+		return
+	}
+	_, err := app.db.Exec("INSERT INTO amc_api_audit (key_name, method, path, status_code, remote_addr, body) VALUES (?, ?, ?, ?, ?, ?)",
+		keyName, r.Method, truncateRunes(r.URL.RequestURI(), 1024), status, truncateRunes(r.RemoteAddr, 64), body)
+	if err != nil {
+		log.Warnf("写入 API 审计日志失败: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAPIKeys 测试期间替换全局密钥库
+func useAPIKeys(t *testing.T, c AuthConfig) *apiKeyStore {
+	t.Helper()
+	store, err := newAPIKeyStore(c.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := apiKeys
+	apiKeys = store
+	t.Cleanup(func() { apiKeys = old })
+	return store
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func doAuthRequest(h http.HandlerFunc, method, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/test", strings.NewReader(`{}`))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	return rr
+}
+
+func TestAuthConfigLegacyToken(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "secret")
+	useAPIKeys(t, AuthConfig{})
+	h := withAuth(SCOPE_DATA_READ, SCOPE_INSPECTION_RUN, okHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/asin-inspection", nil)
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	assertEqual(t, "without token", strconv.Itoa(rr.Code), "401")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/asin-inspection", nil)
+	req.Header.Set("X-Crawler-Token", "secret")
+	rr = httptest.NewRecorder()
+	h(rr, req)
+	assertEqual(t, "with token", strconv.Itoa(rr.Code), "200")
+}
+
+func TestWithAuthOpenWithoutKeys(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	useAPIKeys(t, AuthConfig{})
+	rr := doAuthRequest(withAuth(SCOPE_ADMIN, SCOPE_ADMIN, okHandler), http.MethodPost, "")
+	assertEqual(t, "status", strconv.Itoa(rr.Code), "200")
+}
+
+func TestWithAuthScopes(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	hash := sha256.Sum256([]byte("reader-token"))
+	useAPIKeys(t, AuthConfig{Keys: []APIKeyConfig{
+		{Name: "reader", Token_sha256: hex.EncodeToString(hash[:]), Scopes: []string{SCOPE_DATA_READ}},
+		{Name: "ops", Token: "ops-token", Scopes: []string{SCOPE_ALL}},
+	}})
+	h := withAuth(SCOPE_DATA_READ, SCOPE_CRAWL_SUBMIT, okHandler)
+
+	assertEqual(t, "reader GET", strconv.Itoa(doAuthRequest(h, http.MethodGet, "reader-token").Code), "200")
+	assertEqual(t, "reader POST", strconv.Itoa(doAuthRequest(h, http.MethodPost, "reader-token").Code), "403")
+	assertEqual(t, "ops POST", strconv.Itoa(doAuthRequest(h, http.MethodPost, "ops-token").Code), "200")
+	assertEqual(t, "wrong token", strconv.Itoa(doAuthRequest(h, http.MethodGet, "nope").Code), "401")
+}
+
+func TestWithAuthKeepsRequestBody(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	useAPIKeys(t, AuthConfig{Keys: []APIKeyConfig{{Name: "crawl", Token: "t", Scopes: []string{SCOPE_CRAWL_SUBMIT}}}})
+	var got string
+	h := withAuth(SCOPE_CRAWL_SUBMIT, SCOPE_CRAWL_SUBMIT, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/crawl", strings.NewReader(`{"keywords":["nike"]}`))
+	req.Header.Set("X-Crawler-Token", "t")
+	h(httptest.NewRecorder(), req)
+	assertEqual(t, "body", got, `{"keywords":["nike"]}`)
+}
+
+// failingReader 读取时返回错误的请求体
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestWithAuthRejectsUnreadableBody(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	useAPIKeys(t, AuthConfig{Keys: []APIKeyConfig{{Name: "crawl", Token: "t", Scopes: []string{SCOPE_CRAWL_SUBMIT}}}})
+	called := false
+	h := withAuth(SCOPE_CRAWL_SUBMIT, SCOPE_CRAWL_SUBMIT, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	big := strings.NewReader(strings.Repeat("x", API_MAX_BODY_BYTES+1))
+	for _, c := range []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{"too large", big, http.StatusRequestEntityTooLarge},
+		{"read error", failingReader{}, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/crawl", c.body)
+		req.Header.Set("X-Crawler-Token", "t")
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		assertEqual(t, c.name, strconv.Itoa(rec.Code), strconv.Itoa(c.want))
+	}
+	if called {
+		t.Fatal("handler should not run when the body cannot be read")
+	}
+}
+
+func TestWithAuthRateLimit(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	store := useAPIKeys(t, AuthConfig{Keys: []APIKeyConfig{{Name: "slow", Token: "t", Scopes: []string{SCOPE_ALL}, Rate_limit: 0.5}}})
+	now := time.Unix(1700000000, 0)
+	store.keys[0].limiter.now = func() time.Time { return now }
+	h := withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, okHandler)
+
+	assertEqual(t, "first", strconv.Itoa(doAuthRequest(h, http.MethodGet, "t").Code), "200")
+	rr := doAuthRequest(h, http.MethodGet, "t")
+	assertEqual(t, "second", strconv.Itoa(rr.Code), "429")
+	assertEqual(t, "retry after", rr.Header().Get("Retry-After"), "2")
+
+	now = now.Add(2 * time.Second)
+	assertEqual(t, "after wait", strconv.Itoa(doAuthRequest(h, http.MethodGet, "t").Code), "200")
+}
+
+func TestWithAuthDailyQuota(t *testing.T) {
+	t.Setenv("CRAWLER_API_TOKEN", "")
+	store := useAPIKeys(t, AuthConfig{Keys: []APIKeyConfig{{Name: "quota", Token: "t", Scopes: []string{SCOPE_ALL}, Daily_quota: 2}}})
+	now := time.Date(2026, 6, 6, 23, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	h := withAuth(SCOPE_DATA_READ, SCOPE_DATA_READ, okHandler)
+
+	assertEqual(t, "1st", strconv.Itoa(doAuthRequest(h, http.MethodGet, "t").Code), "200")
+	assertEqual(t, "2nd", strconv.Itoa(doAuthRequest(h, http.MethodGet, "t").Code), "200")
+	rr := doAuthRequest(h, http.MethodGet, "t")
+	assertEqual(t, "3rd", strconv.Itoa(rr.Code), "429")
+	assertEqual(t, "retry after", rr.Header().Get("Retry-After"), "3600")
+
+	// 次日重新计数
+	now = now.Add(2 * time.Hour)
+	assertEqual(t, "next day", strconv.Itoa(doAuthRequest(h, http.MethodGet, "t").Code), "200")
+}
+
+func TestNewAPIKeyStoreValidation(t *testing.T) {
+	cases := map[string][]APIKeyConfig{
+		"missing name":  {{Token: "t", Scopes: []string{SCOPE_ALL}}},
+		"duplicate":     {{Name: "a", Token: "t", Scopes: []string{SCOPE_ALL}}, {Name: "a", Token: "u", Scopes: []string{SCOPE_ALL}}},
+		"missing token": {{Name: "a", Scopes: []string{SCOPE_ALL}}},
+		"bad hash":      {{Name: "a", Token_sha256: "abc", Scopes: []string{SCOPE_ALL}}},
+		"no scopes":     {{Name: "a", Token: "t"}},
+		"unknown scope": {{Name: "a", Token: "t", Scopes: []string{"cookie:write"}}},
+	}
+	for name, keys := range cases {
+		if _, err := newAPIKeyStore(AuthConfig{Keys: keys}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
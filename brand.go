@@ -1,11 +1,10 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -57,7 +56,8 @@ var brandConsecutiveFailures int
 const BRAND_MAX_CONSECUTIVE_FAILURES = 10 // 连续失败10次后退出
 
 // brandMain 品牌巡查主入口
-func brandMain() {
+// 遇到 503 或 Cookie 验证页面时释放本实例认领的品牌并返回错误，由 main 记录结束状态后以非零状态退出
+func brandMain(ctx context.Context) error {
 	log.Info("========================")
 	log.Info("启动品牌巡查模式")
 	log.Info("========================")
@@ -66,18 +66,8 @@ func brandMain() {
 	brandConsecutiveFailures = 0
 
 	// 恢复上次中断的任务：将当前 app_id 的"处理中"状态重置为"待处理"
-	result, err := app.db.Exec(`
-		UPDATE available_brand_domains
-		SET patrol_status = ?
-		WHERE patrol_status = ? AND patrol_app_id = ?
-	`, BRAND_PATROL_PENDING, BRAND_PATROL_PROCESSING, app.Basic.App_id)
-	if err != nil {
-		log.Errorf("重置中断任务失败: %v", err)
-	} else {
-		affected, _ := result.RowsAffected()
-		if affected > 0 {
-			log.Infof("恢复上次中断的 %d 个任务", affected)
-		}
+	if affected := releaseBrandClaims(); affected > 0 {
+		log.Infof("恢复上次中断的 %d 个任务", affected)
 	}
 
 	maxASINs := app.Brand.MaxASINs
@@ -99,7 +89,21 @@ func brandMain() {
 		log.Infof("------------------------")
 		log.Infof("第 %d 轮巡查开始", i+1)
 
-		processed := processBrandBatch(batch, maxASINs)
+		processed, err := processBrandBatch(ctx, batch, maxASINs)
+		if err != nil {
+			if err == ERROR_NOT_503 {
+				log.Errorf("遇到503错误，程序暂停！请检查网络或更换Cookie后重新启动")
+			} else {
+				log.Errorf("Cookie验证页面，程序暂停！请获取新Cookie后重新启动")
+			}
+			log.Infof("释放 %d 个未处理的品牌", releaseBrandClaims())
+			return err
+		}
+		if ctx.Err() != nil {
+			// 收到退出信号：本批未处理的品牌重置为待处理
+			log.Infof("品牌巡查被中断，释放 %d 个未处理的品牌", releaseBrandClaims())
+			break
+		}
 		if processed == 0 {
 			log.Info("没有待处理的品牌，巡查结束")
 			break
@@ -111,12 +115,29 @@ func brandMain() {
 	log.Info("========================")
 	log.Info("品牌巡查模式结束")
 	log.Info("========================")
+	return nil
 }
 
-// processBrandBatch 处理一批品牌
-func processBrandBatch(batch int, maxASINs int) int {
-	// 1. 批量标记为处理中
+// releaseBrandClaims 将当前 app_id 的"处理中"品牌重置为"待处理"，返回重置数量
+func releaseBrandClaims() int64 {
 	result, err := app.db.Exec(`
+		UPDATE available_brand_domains
+		SET patrol_status = ?
+		WHERE patrol_status = ? AND patrol_app_id = ?
+	`, BRAND_PATROL_PENDING, BRAND_PATROL_PROCESSING, app.Basic.App_id)
+	if err != nil {
+		log.Errorf("重置中断任务失败: %v", err)
+		return 0
+	}
+	affected, _ := result.RowsAffected()
+	return affected
+}
+
+// processBrandBatch 处理一批品牌，ctx 取消后在当前品牌结束时返回
+// 遇到 503 或 Cookie 验证页面时将当前品牌重置为待处理，并返回 ERROR_NOT_503 或 Cookie 错误，由调用方决定是否退出
+func processBrandBatch(ctx context.Context, batch int, maxASINs int) (int, error) {
+	// 1. 批量标记为处理中
+	result, err := app.db.ExecContext(ctx, `
 		UPDATE available_brand_domains
 		SET patrol_status = ?, patrol_app_id = ?
 		WHERE patrol_status = ?
@@ -127,24 +148,24 @@ func processBrandBatch(batch int, maxASINs int) int {
 	`, BRAND_PATROL_PROCESSING, app.Basic.App_id, BRAND_PATROL_PENDING, batch)
 	if err != nil {
 		log.Errorf("批量标记品牌失败: %v", err)
-		return 0
+		return 0, nil
 	}
 
 	affected, _ := result.RowsAffected()
 	if affected == 0 {
-		return 0
+		return 0, nil
 	}
 	log.Infof("标记 %d 个品牌为处理中", affected)
 
 	// 2. 查询待处理品牌
-	rows, err := app.db.Query(`
+	rows, err := app.db.QueryContext(ctx, `
 		SELECT id, brand_name, domain, COALESCE(matched_asins, ''), COALESCE(source_rank, 0)
 		FROM available_brand_domains
 		WHERE patrol_status = ? AND patrol_app_id = ?
 	`, BRAND_PATROL_PROCESSING, app.Basic.App_id)
 	if err != nil {
 		log.Errorf("查询品牌失败: %v", err)
-		return 0
+		return 0, nil
 	}
 	defer rows.Close()
 
@@ -172,17 +193,19 @@ func processBrandBatch(batch int, maxASINs int) int {
 		log.Infof("处理品牌: %s (rank=%d)", b.brandName, b.sourceRank)
 
 		// 处理品牌
-		err := b.process(maxASINs)
+		done := instance.beginTask("brand:" + b.brandName)
+		err := b.process(ctx, maxASINs)
+		done()
+		if ctx.Err() != nil {
+			// 当前品牌未完成，由 releaseBrandClaims 重置为待处理
+			return processed, nil
+		}
+		recordTaskResult(METRIC_TASK_BRAND, app.Domain, err == nil)
 		if err != nil {
-			// 检查是否是 503 或验证错误 - 直接退出程序
-			if err == ERROR_NOT_503 {
-				log.Errorf("遇到503错误，程序暂停！请检查网络或更换Cookie后重新启动")
-				b.updateStatus(BRAND_PATROL_PENDING, "") // 重置为待处理
-				os.Exit(1)
-			} else if err == ERROR_VERIFICATION {
-				log.Errorf("Cookie验证页面，程序暂停！请获取新Cookie后重新启动")
+			// 检查是否是 503 或验证错误 - 停止本批
+			if err == ERROR_NOT_503 || isCookieRejected(err) {
 				b.updateStatus(BRAND_PATROL_PENDING, "") // 重置为待处理
-				os.Exit(1)
+				return processed, err
 			} else {
 				log.Errorf("处理品牌 %s 失败: %v", b.brandName, err)
 				b.updateStatus(BRAND_PATROL_FAILED, err.Error())
@@ -203,29 +226,29 @@ func processBrandBatch(batch int, maxASINs int) int {
 		// 检查连续失败次数
 		if brandConsecutiveFailures >= BRAND_MAX_CONSECUTIVE_FAILURES {
 			log.Errorf("连续失败 %d 次，退出品牌巡查", brandConsecutiveFailures)
-			return processed
+			return processed, nil
 		}
 
 		processed++
 	}
 
-	return processed
+	return processed, nil
 }
 
 // process 处理单个品牌
-func (b *brandStruct) process(maxASINs int) error {
+func (b *brandStruct) process(ctx context.Context, maxASINs int) error {
 	if b.matchedAsins != "" {
 		// 路径1: 有ASIN，直接访问商品页
 		log.Infof("使用已有ASIN: %s", b.matchedAsins)
-		return b.processWithASIN()
+		return b.processWithASIN(ctx)
 	}
 	// 路径2: 无ASIN，搜索品牌名
 	log.Infof("搜索品牌名: %s", b.brandName)
-	return b.processWithSearch(maxASINs)
+	return b.processWithSearch(ctx, maxASINs)
 }
 
 // processWithASIN 有ASIN的处理路径
-func (b *brandStruct) processWithASIN() error {
+func (b *brandStruct) processWithASIN(ctx context.Context) error {
 	asins := strings.Split(b.matchedAsins, ",")
 	for _, asin := range asins {
 		asin = strings.TrimSpace(asin)
@@ -234,23 +257,26 @@ func (b *brandStruct) processWithASIN() error {
 		}
 
 		log.Infof("访问ASIN: %s", asin)
-		if err := b.fetchProductPage(asin); err != nil {
+		if err := b.fetchProductPage(ctx, asin); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			log.Warnf("访问ASIN %s 失败: %v", asin, err)
 			continue
 		}
 
 		if b.sellerID != "" {
 			log.Infof("找到卖家: %s", b.sellerID)
-			return b.fetchSellerInfo()
+			return b.fetchSellerInfo(ctx)
 		}
 	}
 	return nil
 }
 
 // processWithSearch 无ASIN的处理路径（搜索）
-func (b *brandStruct) processWithSearch(maxASINs int) error {
+func (b *brandStruct) processWithSearch(ctx context.Context, maxASINs int) error {
 	// 1. 搜索品牌名
-	if err := b.search(maxASINs); err != nil {
+	if err := b.search(ctx, maxASINs); err != nil {
 		return err
 	}
 
@@ -267,30 +293,28 @@ func (b *brandStruct) processWithSearch(maxASINs int) error {
 	// 3. 处理搜索到的ASIN
 	for _, asin := range b.asins {
 		log.Infof("访问ASIN: %s", asin)
-		if err := b.fetchProductPage(asin); err != nil {
+		if err := b.fetchProductPage(ctx, asin); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			log.Warnf("访问ASIN %s 失败: %v", asin, err)
 			continue
 		}
 
 		if b.sellerID != "" {
 			log.Infof("找到卖家: %s", b.sellerID)
-			return b.fetchSellerInfo()
+			return b.fetchSellerInfo(ctx)
 		}
 	}
 	return nil
 }
 
 // search 搜索品牌名获取ASIN
-func (b *brandStruct) search(maxASINs int) error {
+func (b *brandStruct) search(ctx context.Context, maxASINs int) error {
 	searchURL := fmt.Sprintf("https://%s/s?k=%s", app.Domain, url.QueryEscape(b.brandName))
 
-	fp := GetCurrentFingerprint()
-	if err := robot.IsAllow(fp.UserAgent, searchURL); err != nil {
-		return fmt.Errorf("robots.txt 不允许: %v", err)
-	}
-
 	// 直接请求，不重试 - 503/验证错误由上层处理
-	doc, err := b.request(searchURL)
+	doc, err := b.request(ctx, searchURL)
 	if err != nil {
 		return err
 	}
@@ -317,10 +341,10 @@ func (b *brandStruct) saveASINsToProduct() {
 	for _, asin := range b.asins {
 		productURL := fmt.Sprintf("https://%s/dp/%s", app.Domain, asin)
 		_, err := app.db.Exec(`
-			INSERT INTO amc_product (url, param, asin, keyword, brand_name, status, app)
-			VALUES (?, '', ?, ?, ?, 0, ?)
+			INSERT INTO amc_product (url, param, asin, keyword, domain, brand_name, status, app)
+			VALUES (?, '', ?, ?, ?, ?, 0, ?)
 			ON DUPLICATE KEY UPDATE brand_name = VALUES(brand_name)
-		`, productURL, asin, b.brandName, b.brandName, app.Basic.App_id)
+		`, productURL, asin, b.brandName, app.Domain, b.brandName, app.Basic.App_id)
 		if err != nil {
 			log.Warnf("保存ASIN %s 到产品表失败: %v", asin, err)
 		}
@@ -328,70 +352,18 @@ func (b *brandStruct) saveASINsToProduct() {
 }
 
 // fetchProductPage 访问商品页提取卖家信息
-func (b *brandStruct) fetchProductPage(asin string) error {
+func (b *brandStruct) fetchProductPage(ctx context.Context, asin string) error {
 	productURL := fmt.Sprintf("https://%s/dp/%s", app.Domain, asin)
 
-	fp := GetCurrentFingerprint()
-	if err := robot.IsAllow(fp.UserAgent, productURL); err != nil {
-		return fmt.Errorf("robots.txt 不允许: %v", err)
-	}
-
 	// 直接请求，不重试 - 503/验证错误由上层处理
-	doc, err := b.request(productURL)
+	doc, err := b.request(ctx, productURL)
 	if err != nil {
 		return err
 	}
 
-	// 提取卖家链接 - 尝试多个选择器
-	var sellerLink *goquery.Selection
-	selectors := []string{
-		"a[id=sellerProfileTriggerId]",
-		"a#sellerProfileTriggerId",
-		"#sellerProfileTriggerId",
-		"div#merchant-info a",
-		"div#tabular-buybox-container a",
-		"#merchant-info a",
-		"a[href*='seller=']",
-		"span.tabular-buybox-text a",
-		"div.tabular-buybox-container a",
-		"#vse-seller-link",
-	}
-
-	var href string
-	var foundLink bool
-	for _, selector := range selectors {
-		doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-			if foundLink {
-				return
-			}
-			h, e := s.Attr("href")
-			if e && strings.Contains(h, "seller=") {
-				sellerLink = s
-				href = h
-				foundLink = true
-			}
-		})
-		if foundLink {
-			break
-		}
-	}
-
-	// 兜底方案：遍历所有 a 标签寻找包含 seller= 的链接
-	if !foundLink {
-		doc.Find("a").Each(func(i int, s *goquery.Selection) {
-			if foundLink {
-				return
-			}
-			h, e := s.Attr("href")
-			if e && strings.Contains(h, "seller=") {
-				sellerLink = s
-				href = h
-				foundLink = true
-			}
-		})
-	}
-
-	if !foundLink {
+	// 提取卖家链接
+	sellerLink, href, ok := findSellerLink(doc)
+	if !ok {
 		return ERROR_NOT_SELLER_URL
 	}
 
@@ -428,16 +400,11 @@ func extractSellerID(href string) string {
 }
 
 // fetchSellerInfo 获取卖家详细信息并写入 tb_amazon_shop
-func (b *brandStruct) fetchSellerInfo() error {
+func (b *brandStruct) fetchSellerInfo(ctx context.Context) error {
 	sellerURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", app.Domain, b.sellerID)
 
-	fp := GetCurrentFingerprint()
-	if err := robot.IsAllow(fp.UserAgent, sellerURL); err != nil {
-		return fmt.Errorf("robots.txt 不允许: %v", err)
-	}
-
 	// 直接请求，不重试 - 503/验证错误由上层处理
-	doc, err := b.request(sellerURL)
+	doc, err := b.request(ctx, sellerURL)
 	if err != nil {
 		return err
 	}
@@ -571,56 +538,21 @@ func (b *brandStruct) saveToAmazonShop() error {
 }
 
 // request 发送HTTP请求
-func (b *brandStruct) request(reqURL string) (*goquery.Document, error) {
+func (b *brandStruct) request(ctx context.Context, reqURL string) (*goquery.Document, error) {
 	log.Infof("请求: %s", reqURL)
 
-	client := get_client()
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// 使用统一的指纹系统
-	ApplyFingerprint(req, GetRandomReferer(app.Domain))
-
-	if _, err := app.get_cookie(); err != nil {
-		log.Warnf("获取 cookie 失败: %v", err)
-	} else {
-		req.Header.Set("Cookie", app.cookie)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		break
-	case 404:
-		return nil, ERROR_NOT_404
-	case 503:
-		return nil, ERROR_NOT_503
-	default:
-		return nil, fmt.Errorf("状态码: %d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("解析HTML失败: %w", err)
-	}
-
-	// 验证页面检测
-	if doc.Find("h4").First().Text() == "Enter the characters you see below" {
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: reqURL, Mode: FETCH_MODE_BRAND})
+	if isCookieRejected(err) {
 		// Cookie 失效，尝试切换
 		if err := app.handleCookieInvalid(); err != nil {
 			log.Errorf("处理 cookie 失效失败: %v", err)
 		}
-		return nil, ERROR_VERIFICATION
+		return nil, err
 	}
-
-	return doc, nil
+	if err != nil {
+		return nil, err
+	}
+	return page.Doc, nil
 }
 
 // updateStatus 更新巡查状态
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// ClaimConfig amc_product / amc_seller 批量认领的租约配置
+type ClaimConfig struct {
+	Lease_seconds int `yaml:"lease_seconds"` // 认领租约时长（秒），处理期间每 1/3 时长续期一次，默认 1800
+	Reap_interval int `yaml:"reap_interval"` // 回收过期认领的检查间隔（秒），默认 60
+}
+
+// withDefaults 填充未配置的字段
+func (c ClaimConfig) withDefaults() ClaimConfig {
+	if c.Lease_seconds <= 0 {
+		c.Lease_seconds = 1800
+	}
+	if c.Reap_interval <= 0 {
+		c.Reap_interval = 60
+	}
+	return c
+}
+
+// CLAIM_LEASE_SET 认领或续期时写入的租约字段，参数为租约秒数
+const CLAIM_LEASE_SET = "claimed_at = NOW(), lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)"
+
+// keepClaims 处理认领批次期间定期续期租约，返回的函数用于停止续期
+func keepClaims(ctx context.Context, name string, renew func(context.Context) (int64, error)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(seconds(app.Claim.Lease_seconds) / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := renew(ctx); err != nil && ctx.Err() == nil {
+					log.Errorf("续期%s认领失败: %v", name, err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// renewProductClaims 续期本实例认领中的商品
+func renewProductClaims(ctx context.Context) (int64, error) {
+	r, err := app.db.ExecContext(ctx,
+		"UPDATE amc_product SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE status = ? AND app = ?",
+		app.Claim.Lease_seconds, MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// renewSellerClaims 续期本实例认领中的商家
+func renewSellerClaims(ctx context.Context) (int64, error) {
+	r, err := app.db.ExecContext(ctx,
+		"UPDATE amc_seller SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE all_status = ? AND app_id = ?",
+		app.Claim.Lease_seconds, MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// reapExpiredClaims 将租约已过期的认领归还到待处理池
+// 认领中的商品重置为待查询；失败待重试的商品只解除绑定，其他实例可以继续重试
+func reapExpiredClaims(ctx context.Context) (products, sellers int64, err error) {
+	r, err := app.db.ExecContext(ctx,
+		`UPDATE amc_product SET status = IF(status = ?, ?, status), app = 0, claimed_at = NULL, lease_expires_at = NULL
+		WHERE status IN (?, ?) AND app <> 0 AND lease_expires_at < NOW()`,
+		MYSQL_PRODUCT_STATUS_CHEKCK, MYSQL_PRODUCT_STATUS_INSERT,
+		MYSQL_PRODUCT_STATUS_CHEKCK, MYSQL_PRODUCT_STATUS_ERROR_OVER)
+	if err != nil {
+		return 0, 0, err
+	}
+	products, _ = r.RowsAffected()
+
+	r, err = app.db.ExecContext(ctx,
+		"UPDATE amc_seller SET app_id = 0, claimed_at = NULL, lease_expires_at = NULL WHERE all_status = ? AND app_id <> 0 AND lease_expires_at < NOW()",
+		MYSQL_SELLER_STATUS_INFO_INSERT)
+	if err != nil {
+		return products, 0, err
+	}
+	sellers, _ = r.RowsAffected()
+	return products, sellers, nil
+}
+
+// startClaimReaper 启动后台回收，立即执行一次，之后每 reap_interval 秒执行一次，ctx 取消后停止
+func startClaimReaper(ctx context.Context) {
+	reap := func() {
+		products, sellers, err := reapExpiredClaims(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("回收过期认领失败: %v", err)
+			}
+			return
+		}
+		if products > 0 || sellers > 0 {
+			log.Warnf("已回收租约过期的认领: 商品=%d 商家=%d", products, sellers)
+		}
+	}
+
+	go func() {
+		reap()
+		ticker := time.NewTicker(seconds(app.Claim.Reap_interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reap()
+			}
+		}
+	}()
+}
+
+// ClaimHolder 某个 app_id 当前持有的认领
+type ClaimHolder struct {
+	AppID          int    `json:"app_id"`
+	Products       int    `json:"products"`         // 认领中的商品
+	Sellers        int    `json:"sellers"`          // 认领中的商家
+	Expired        int    `json:"expired"`          // 其中租约已过期、等待回收的数量
+	OldestClaim    string `json:"oldest_claim"`     // 最早的认领时间
+	LeaseExpiresAt string `json:"lease_expires_at"` // 最晚的租约到期时间
+}
+
+// addClaimHolder 合并同一 app_id 在不同表中的认领统计
+// 时间为 MySQL DATETIME 文本（YYYY-MM-DD HH:MM:SS），可直接按字符串比较
+func addClaimHolder(holders map[int]*ClaimHolder, appID int, products, sellers, expired int, oldest, expires string) {
+	h, ok := holders[appID]
+	if !ok {
+		h = &ClaimHolder{AppID: appID}
+		holders[appID] = h
+	}
+	h.Products += products
+	h.Sellers += sellers
+	h.Expired += expired
+	if oldest != "" && (h.OldestClaim == "" || oldest < h.OldestClaim) {
+		h.OldestClaim = oldest
+	}
+	if expires > h.LeaseExpiresAt {
+		h.LeaseExpiresAt = expires
+	}
+}
+
+// sortedClaimHolders 按 app_id 排序输出
+func sortedClaimHolders(holders map[int]*ClaimHolder) []ClaimHolder {
+	list := make([]ClaimHolder, 0, len(holders))
+	for _, h := range holders {
+		list = append(list, *h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AppID < list[j].AppID })
+	return list
+}
+
+// claimReport 统计每个 app_id 当前持有的商品和商家认领
+func claimReport(ctx context.Context) ([]ClaimHolder, error) {
+	holders := map[int]*ClaimHolder{}
+
+	queries := []struct {
+		isProduct bool
+		query     string
+		status    int
+	}{
+		{true, `SELECT app, COUNT(*), COALESCE(SUM(lease_expires_at < NOW()), 0), MIN(claimed_at), MAX(lease_expires_at)
+			FROM amc_product WHERE status = ? AND app <> 0 GROUP BY app`, MYSQL_PRODUCT_STATUS_CHEKCK},
+		{false, `SELECT app_id, COUNT(*), COALESCE(SUM(lease_expires_at < NOW()), 0), MIN(claimed_at), MAX(lease_expires_at)
+			FROM amc_seller WHERE all_status = ? AND app_id <> 0 GROUP BY app_id`, MYSQL_SELLER_STATUS_INFO_INSERT},
+	}
+	for _, q := range queries {
+		rows, err := app.db.QueryContext(ctx, q.query, q.status)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var appID, count, expired int
+			var oldest, expires sql.NullString
+			if err := rows.Scan(&appID, &count, &expired, &oldest, &expires); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if q.isProduct {
+				addClaimHolder(holders, appID, count, 0, expired, oldest.String, expires.String)
+			} else {
+				addClaimHolder(holders, appID, 0, count, expired, oldest.String, expires.String)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sortedClaimHolders(holders), nil
+}
+
+// releaseClaims 释放本实例认领但尚未处理完的商品和商家，使其他实例或下次启动可以继续处理
+// 在退出时调用，此时根 context 已取消，因此不使用 context
+func (app *appConfig) releaseClaims() {
+	if app.db == nil {
+		return
+	}
+	r, err := app.db.Exec("UPDATE amc_product SET status = ?, app = 0, claimed_at = NULL, lease_expires_at = NULL WHERE status = ? AND app = ?",
+		MYSQL_PRODUCT_STATUS_INSERT, MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id)
+	if err != nil {
+		log.Errorf("释放商品认领失败: %v", err)
+	} else if n, _ := r.RowsAffected(); n > 0 {
+		log.Infof("已释放 %d 个未处理的商品", n)
+	}
+
+	r, err = app.db.Exec("UPDATE amc_seller SET app_id = 0, claimed_at = NULL, lease_expires_at = NULL WHERE all_status = ? AND app_id = ?",
+		MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id)
+	if err != nil {
+		log.Errorf("释放商家认领失败: %v", err)
+	} else if n, _ := r.RowsAffected(); n > 0 {
+		log.Infof("已释放 %d 个未处理的商家", n)
+	}
+}
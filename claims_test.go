@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClaimConfigDefaults(t *testing.T) {
+	c := ClaimConfig{}.withDefaults()
+	assertEqual(t, "lease", fmt.Sprint(c.Lease_seconds), "1800")
+	assertEqual(t, "reap", fmt.Sprint(c.Reap_interval), "60")
+}
+
+func TestClaimReportMergesTablesPerApp(t *testing.T) {
+	holders := map[int]*ClaimHolder{}
+	addClaimHolder(holders, 3, 0, 20, 0, "2026-06-06 09:00:00", "2026-06-06 10:30:00")
+	addClaimHolder(holders, 2, 1000, 0, 5, "2026-06-06 10:00:00", "2026-06-06 10:40:00")
+	addClaimHolder(holders, 2, 0, 37, 0, "2026-06-06 09:30:00", "2026-06-06 10:20:00")
+
+	list := sortedClaimHolders(holders)
+	assertEqual(t, "holders", fmt.Sprint(len(list)), "2")
+	h := list[0]
+	assertEqual(t, "app id", fmt.Sprint(h.AppID), "2")
+	assertEqual(t, "counts", fmt.Sprintf("%d/%d/%d", h.Products, h.Sellers, h.Expired), "1000/37/5")
+	assertEqual(t, "oldest", h.OldestClaim, "2026-06-06 09:30:00")
+	assertEqual(t, "expires", h.LeaseExpiresAt, "2026-06-06 10:40:00")
+	assertEqual(t, "second app", fmt.Sprint(list[1].AppID), "3")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PageClass 页面分类结果
+type PageClass int
+
+const (
+	PAGE_CLASS_OK                PageClass = iota // 正常页面
+	PAGE_CLASS_CAPTCHA                            // 人机验证
+	PAGE_CLASS_SIGN_IN                            // 登录墙
+	PAGE_CLASS_DOG_404                            // 亚马逊狗狗 404 页面
+	PAGE_CLASS_EMPTY_RESULTS                      // 搜索无结果
+	PAGE_CLASS_REGION_BLOCKED                     // 地区限制
+	PAGE_CLASS_UNEXPECTED_LAYOUT                  // 未知页面结构
+	PAGE_CLASS_THROTTLED                          // 503 限流
+)
+
+var pageClassNames = map[PageClass]string{
+	PAGE_CLASS_OK:                "ok",
+	PAGE_CLASS_CAPTCHA:           "captcha",
+	PAGE_CLASS_SIGN_IN:           "sign_in",
+	PAGE_CLASS_DOG_404:           "dog_404",
+	PAGE_CLASS_EMPTY_RESULTS:     "empty_results",
+	PAGE_CLASS_REGION_BLOCKED:    "region_blocked",
+	PAGE_CLASS_UNEXPECTED_LAYOUT: "unexpected_layout",
+	PAGE_CLASS_THROTTLED:         "throttled",
+}
+
+func (c PageClass) String() string {
+	if name, ok := pageClassNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Err 将页面分类映射为 error.go 中的错误，正常页面返回 nil
+func (c PageClass) Err() error {
+	switch c {
+	case PAGE_CLASS_CAPTCHA:
+		return ERROR_VERIFICATION
+	case PAGE_CLASS_SIGN_IN:
+		return ERROR_SIGN_IN
+	case PAGE_CLASS_DOG_404:
+		return ERROR_NOT_404
+	case PAGE_CLASS_EMPTY_RESULTS:
+		return ERROR_EMPTY_RESULTS
+	case PAGE_CLASS_REGION_BLOCKED:
+		return ERROR_REGION_BLOCKED
+	case PAGE_CLASS_UNEXPECTED_LAYOUT:
+		return ERROR_UNEXPECTED_LAYOUT
+	case PAGE_CLASS_THROTTLED:
+		return ERROR_NOT_503
+	}
+	return nil
+}
+
+// 各模式下正常页面至少应包含其中一个元素
+var pageLayoutMarkers = map[string][]string{
+	FETCH_MODE_SEARCH:  {"div.s-search-results", ".s-main-slot"},
+	FETCH_MODE_PRODUCT: {"#dp", "#dp-container", "#productTitle", "input#ASIN"},
+	FETCH_MODE_LINK:    {"#dp", "#dp-container", "#productTitle", "input#ASIN"},
+	FETCH_MODE_ASIN:    {"#dp", "#dp-container", "#productTitle", "input#ASIN"},
+	FETCH_MODE_OFFER:   {"#aod-container", "#aod-offer-list", "#aod-pinned-offer"},
+	FETCH_MODE_SELLER:  {"#seller-profile-container", "#page-section-detail-seller-info", "#seller-name", "#sellerName", "#seller-feedback-summary-rating"},
+}
+
+var regionBlockedTexts = []string{
+	"not available in your country",
+	"not available in your region",
+	"not available in your location",
+	"isn't available in your country",
+	"is not available in your area",
+}
+
+// classifyPage 对响应进行分类
+// doc 可以为空（如未解析的非 200 响应），mode 为 FETCH_MODE_*，未配置页面特征的模式不做结构检查
+func classifyPage(statusCode int, doc *goquery.Document, mode string) PageClass {
+	switch statusCode {
+	case http.StatusNotFound:
+		return PAGE_CLASS_DOG_404
+	case http.StatusServiceUnavailable:
+		return PAGE_CLASS_THROTTLED
+	}
+	if doc == nil {
+		return PAGE_CLASS_OK
+	}
+
+	switch {
+	case isCaptchaPage(doc):
+		return PAGE_CLASS_CAPTCHA
+	case isSignInPage(doc):
+		return PAGE_CLASS_SIGN_IN
+	case isDog404Page(doc):
+		return PAGE_CLASS_DOG_404
+	case isRegionBlockedPage(doc, mode):
+		return PAGE_CLASS_REGION_BLOCKED
+	}
+
+	if mode == FETCH_MODE_SEARCH && isEmptySearchPage(doc) {
+		return PAGE_CLASS_EMPTY_RESULTS
+	}
+	if markers, ok := pageLayoutMarkers[mode]; ok && !hasAnySelector(doc, markers) {
+		return PAGE_CLASS_UNEXPECTED_LAYOUT
+	}
+	return PAGE_CLASS_OK
+}
+
+// isCaptchaPage 检测亚马逊人机验证页面
+func isCaptchaPage(doc *goquery.Document) bool {
+	title := doc.Find("title").First().Text()
+	h4 := doc.Find("h4").First().Text()
+	return strings.Contains(title, "Enter the characters") ||
+		strings.Contains(title, "Type the characters") ||
+		strings.Contains(strings.ToLower(title), "robot check") ||
+		strings.Contains(h4, "Enter the characters") ||
+		strings.Contains(h4, "Type the characters") ||
+		doc.Find("form[action*='/captcha/'], form[action*='validateCaptcha'], input#captchacharacters").Length() > 0 ||
+		doc.Find("[method=post]").Find("input[type=text][name*=field-keywords]").Length() > 0
+}
+
+// isSignInPage 检测登录墙
+func isSignInPage(doc *goquery.Document) bool {
+	title := doc.Find("title").First().Text()
+	return strings.Contains(title, "Amazon Sign-In") ||
+		strings.Contains(title, "Amazon Sign In") ||
+		doc.Find("form[name=signIn], form#ap_login_form, input#ap_email, input#ap_password").Length() > 0
+}
+
+// isDog404Page 检测状态码为 200 但内容为狗狗 404 的页面
+func isDog404Page(doc *goquery.Document) bool {
+	title := doc.Find("title").First().Text()
+	return strings.Contains(title, "Page Not Found") ||
+		doc.Find("img[alt*='Dogs of Amazon'], a[href*='ref=cs_404_logo'], a[href*='ref=cs_404_link']").Length() > 0 ||
+		strings.Contains(doc.Find("body").Text(), "Sorry! We couldn't find that page")
+}
+
+// isRegionBlockedPage 检测地区限制页面
+// 页面具备当前模式的正常结构时不做文本匹配，脚本和样式中的文案不参与匹配
+func isRegionBlockedPage(doc *goquery.Document, mode string) bool {
+	// 正常页面中的配送提示不算地区限制
+	if markers, ok := pageLayoutMarkers[mode]; ok && hasAnySelector(doc, markers) {
+		return false
+	}
+	if doc.Find("#productTitle").Length() > 0 {
+		return false
+	}
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	text := strings.ToLower(body.Text())
+	for _, blocked := range regionBlockedTexts {
+		if strings.Contains(text, blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptySearchPage 检测搜索无结果页面
+func isEmptySearchPage(doc *goquery.Document) bool {
+	if doc.Find("div[data-component-type=s-search-result][data-asin]").FilterFunction(func(i int, s *goquery.Selection) bool {
+		asin, _ := s.Attr("data-asin")
+		return asin != ""
+	}).Length() > 0 {
+		return false
+	}
+	if doc.Find(".s-no-results, .s-no-results-filler").Length() > 0 {
+		return true
+	}
+	return strings.Contains(doc.Find("div.s-search-results, .s-main-slot").Text(), "No results for")
+}
+
+func hasAnySelector(doc *goquery.Document, selectors []string) bool {
+	for _, selector := range selectors {
+		if doc.Find(selector).Length() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isCookieRejected 判断错误是否表示当前 Cookie 已被拒绝（验证码或登录墙），需要切换 Cookie
+func isCookieRejected(err error) bool {
+	return err == ERROR_VERIFICATION || err == ERROR_SIGN_IN
+}
+
+// isPageUnrecoverable 判断错误是否重试无意义（robots 限制、页面不存在、地区限制、页面结构异常）
+func isPageUnrecoverable(err error) bool {
+	return isRobotsDisallow(err) ||
+		err == ERROR_NOT_404 ||
+		err == ERROR_REGION_BLOCKED ||
+		err == ERROR_UNEXPECTED_LAYOUT
+}
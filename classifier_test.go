@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func loadPageFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "pages", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestClassifyPageFixtures(t *testing.T) {
+	cases := []struct {
+		file   string
+		mode   string
+		status int
+		want   PageClass
+	}{
+		{"search_ok.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_OK},
+		{"search_empty.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_EMPTY_RESULTS},
+		{"product_ok.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_OK},
+		{"product_ok.html", FETCH_MODE_LINK, http.StatusOK, PAGE_CLASS_OK},
+		{"seller_ok.html", FETCH_MODE_SELLER, http.StatusOK, PAGE_CLASS_OK},
+		{"offers_ok.html", FETCH_MODE_OFFER, http.StatusOK, PAGE_CLASS_OK},
+		{"unexpected_layout.html", FETCH_MODE_OFFER, http.StatusOK, PAGE_CLASS_UNEXPECTED_LAYOUT},
+		{"captcha.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_CAPTCHA},
+		{"captcha.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_CAPTCHA},
+		{"captcha_robot_check.html", FETCH_MODE_SELLER, http.StatusOK, PAGE_CLASS_CAPTCHA},
+		{"sign_in.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_SIGN_IN},
+		{"dog_404.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_DOG_404},
+		{"dog_404.html", FETCH_MODE_PRODUCT, http.StatusNotFound, PAGE_CLASS_DOG_404},
+		{"region_blocked.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_REGION_BLOCKED},
+		{"region_blocked.html", FETCH_MODE_BRAND, http.StatusOK, PAGE_CLASS_REGION_BLOCKED},
+		// 正常结构中的配送提示、脚本和样式中的文案不算地区限制
+		{"search_region_notice.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_OK},
+		{"region_text_in_script.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_UNEXPECTED_LAYOUT},
+		{"region_text_in_script.html", FETCH_MODE_BRAND, http.StatusOK, PAGE_CLASS_OK},
+		{"unexpected_layout.html", FETCH_MODE_PRODUCT, http.StatusOK, PAGE_CLASS_UNEXPECTED_LAYOUT},
+		{"unexpected_layout.html", FETCH_MODE_SEARCH, http.StatusOK, PAGE_CLASS_UNEXPECTED_LAYOUT},
+		{"unexpected_layout.html", FETCH_MODE_SELLER, http.StatusOK, PAGE_CLASS_UNEXPECTED_LAYOUT},
+		// 品牌模式会访问多种页面，不做结构检查
+		{"unexpected_layout.html", FETCH_MODE_BRAND, http.StatusOK, PAGE_CLASS_OK},
+		{"product_ok.html", FETCH_MODE_SEARCH, http.StatusServiceUnavailable, PAGE_CLASS_THROTTLED},
+	}
+	for _, c := range cases {
+		got := classifyPage(c.status, loadPageFixture(t, c.file), c.mode)
+		if got != c.want {
+			t.Errorf("%s mode=%s status=%d: class = %s, want %s", c.file, c.mode, c.status, got, c.want)
+		}
+	}
+}
+
+func TestClassifyPageWithoutDocument(t *testing.T) {
+	assertEqual(t, "404", classifyPage(http.StatusNotFound, nil, FETCH_MODE_ROBOTS).String(), "dog_404")
+	assertEqual(t, "503", classifyPage(http.StatusServiceUnavailable, nil, FETCH_MODE_ROBOTS).String(), "throttled")
+	assertEqual(t, "200", classifyPage(http.StatusOK, nil, FETCH_MODE_ROBOTS).String(), "ok")
+}
+
+func TestPageClassErr(t *testing.T) {
+	cases := map[PageClass]error{
+		PAGE_CLASS_OK:                nil,
+		PAGE_CLASS_CAPTCHA:           ERROR_VERIFICATION,
+		PAGE_CLASS_SIGN_IN:           ERROR_SIGN_IN,
+		PAGE_CLASS_DOG_404:           ERROR_NOT_404,
+		PAGE_CLASS_EMPTY_RESULTS:     ERROR_EMPTY_RESULTS,
+		PAGE_CLASS_REGION_BLOCKED:    ERROR_REGION_BLOCKED,
+		PAGE_CLASS_UNEXPECTED_LAYOUT: ERROR_UNEXPECTED_LAYOUT,
+		PAGE_CLASS_THROTTLED:         ERROR_NOT_503,
+	}
+	for class, want := range cases {
+		if got := class.Err(); got != want {
+			t.Errorf("%s.Err() = %v, want %v", class, got, want)
+		}
+	}
+	if !isCookieRejected(PAGE_CLASS_SIGN_IN.Err()) || !isCookieRejected(PAGE_CLASS_CAPTCHA.Err()) {
+		t.Fatal("captcha and sign-in should require a new cookie")
+	}
+	if !isPageUnrecoverable(PAGE_CLASS_UNEXPECTED_LAYOUT.Err()) || isPageUnrecoverable(PAGE_CLASS_THROTTLED.Err()) {
+		t.Fatal("unexpected layout is unrecoverable, throttled is not")
+	}
+}
+
+func TestParseSearchResultsFixture(t *testing.T) {
+	products, err := parseSearchResults(loadPageFixture(t, "search_ok.html"), "speakers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 {
+		t.Fatalf("len(products) = %d, want 2", len(products))
+	}
+}
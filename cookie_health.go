@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// cookie 冷却的最长时间
+const COOKIE_COOLDOWN_MAX = 24 * time.Hour
+
+// cookieCandidate 参与健康度评分的 cookie 记录
+type cookieCandidate struct {
+	ID             int64
+	Cookie         string
+	BrowserProfile sql.NullString
+	ProxyAddr      sql.NullString
+	RequestCount   int64
+	SuccessCount   int64
+	CaptchaCount   int64
+	IdleSeconds    sql.NullInt64 // 距最后一次请求的秒数，从未使用过为 NULL
+}
+
+// cookieHealthScore 计算 cookie 健康度，越高越优先
+// 成功率（平滑处理，新 cookie 为 0.5）为主，休息时间越长略微加分，近期验证码次数扣分
+func cookieHealthScore(c cookieCandidate) float64 {
+	ratio := float64(c.SuccessCount+1) / float64(c.RequestCount+2)
+
+	rest := 1.0
+	if c.IdleSeconds.Valid {
+		rest = math.Min(float64(c.IdleSeconds.Int64)/time.Hour.Seconds(), 1)
+	}
+
+	return ratio + 0.2*rest - 0.1*float64(c.CaptchaCount)
+}
+
+// pickHealthiestCookie 返回健康度最高的 cookie 下标，列表为空时返回 -1
+func pickHealthiestCookie(candidates []cookieCandidate) int {
+	best := -1
+	bestScore := 0.0
+	for i, c := range candidates {
+		score := cookieHealthScore(c)
+		if best == -1 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// cookieCooldown 第 strikes 次被拒绝后的冷却时间，按基础时间指数增长
+func cookieCooldown(base time.Duration, strikes int) time.Duration {
+	if strikes < 1 {
+		strikes = 1
+	}
+	d := base
+	for i := 1; i < strikes; i++ {
+		d *= 2
+		if d >= COOKIE_COOLDOWN_MAX {
+			return COOKIE_COOLDOWN_MAX
+		}
+	}
+	if d > COOKIE_COOLDOWN_MAX {
+		return COOKIE_COOLDOWN_MAX
+	}
+	return d
+}
+
+// isCookieRequestSuccess 判断一次请求对 cookie 而言是否成功
+// 页面不存在、搜索无结果等属于正常响应；验证码、登录墙、503、网络错误均记为失败
+func isCookieRequestSuccess(err error) bool {
+	return err == nil || err == ERROR_NOT_404 || err == ERROR_EMPTY_RESULTS || err == ERROR_UNEXPECTED_LAYOUT
+}
+
+// recordCookieOutcome 记录 cookie 的一次请求结果
+// 成功的请求会清零连续验证码次数
+func (app *appConfig) recordCookieOutcome(cookieID int64, success bool) {
+	if app.db == nil || cookieID == 0 {
+		return
+	}
+	successInc := 0
+	if success {
+		successInc = 1
+	}
+	_, err := app.db.Exec(
+		`UPDATE amc_cookie SET request_count = request_count + 1, success_count = success_count + ?,
+		captcha_count = IF(? = 1, 0, captcha_count), last_request = CURRENT_TIMESTAMP WHERE id = ?`,
+		successInc, successInc, cookieID,
+	)
+	if err != nil {
+		log.Errorf("记录 cookie 请求结果失败 (id=%d): %v", cookieID, err)
+	}
+}
+
+// coolDownCookie 当前 cookie 被拒绝（验证码/登录墙/503）后进入冷却并解除与 host_id 的绑定
+// 连续被拒绝次数达到 max_strikes 时才标记为失效（status = 0）
+func (app *appConfig) coolDownCookie() error {
+	if app.cookieID == 0 {
+		return fmt.Errorf("没有正在使用的 cookie")
+	}
+	// 冷却前先保存已刷新的 cookie，冷却结束后可继续使用
+	jar.Flush()
+
+	var strikes int
+	if err := app.db.QueryRow("SELECT captcha_count FROM amc_cookie WHERE id = ?", app.cookieID).Scan(&strikes); err != nil {
+		return fmt.Errorf("查询 cookie 失败: %w", err)
+	}
+	strikes++
+
+	if strikes >= app.Cookie.Max_strikes {
+		_, err := app.db.Exec("UPDATE amc_cookie SET status = 0, captcha_count = ? WHERE id = ?", strikes, app.cookieID)
+		if err != nil {
+			return fmt.Errorf("标记 cookie 失效失败: %w", err)
+		}
+		log.Warnf("cookie (id=%d) 连续被拒绝 %d 次，已标记为失效", app.cookieID, strikes)
+	} else {
+		cooldown := cookieCooldown(time.Duration(app.Cookie.Cooldown)*time.Second, strikes)
+		_, err := app.db.Exec(
+			"UPDATE amc_cookie SET host_id = NULL, captcha_count = ?, cooldown_until = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE id = ?",
+			strikes, int64(cooldown.Seconds()), app.cookieID,
+		)
+		if err != nil {
+			return fmt.Errorf("设置 cookie 冷却失败: %w", err)
+		}
+		log.Warnf("cookie (id=%d) 第 %d 次被拒绝，冷却 %s", app.cookieID, strikes, cooldown)
+	}
+
+	jar.Forget(app.cookieID)
+	app.cookie = ""
+	app.cookieBase = ""
+	app.cookieID = 0
+	return nil
+}
+
+// queryCookieCandidates 查询未分配且不在冷却中的 cookie
+func queryCookieCandidates(tx *sql.Tx) ([]cookieCandidate, error) {
+	rows, err := tx.Query(
+		`SELECT id, cookie, browser_profile, proxy_addr, request_count, success_count, captcha_count,
+		TIMESTAMPDIFF(SECOND, last_request, CURRENT_TIMESTAMP)
+		FROM amc_cookie
+		WHERE host_id IS NULL AND status = 1 AND (cooldown_until IS NULL OR cooldown_until <= CURRENT_TIMESTAMP)
+		FOR UPDATE`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []cookieCandidate
+	for rows.Next() {
+		var c cookieCandidate
+		var requestCount, successCount sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.Cookie, &c.BrowserProfile, &c.ProxyAddr, &requestCount, &successCount, &c.CaptchaCount, &c.IdleSeconds); err != nil {
+			return nil, err
+		}
+		c.Cookie = strings.TrimSpace(c.Cookie)
+		c.RequestCount = requestCount.Int64
+		c.SuccessCount = successCount.Int64
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
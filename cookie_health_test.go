@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestCookieHealthScorePrefersSuccessfulRestedCookies(t *testing.T) {
+	candidates := []cookieCandidate{
+		{ID: 1, RequestCount: 100, SuccessCount: 60, IdleSeconds: sql.NullInt64{Int64: 7200, Valid: true}},
+		{ID: 2, RequestCount: 100, SuccessCount: 98, IdleSeconds: sql.NullInt64{Int64: 10, Valid: true}},
+		{ID: 3, RequestCount: 100, SuccessCount: 98, IdleSeconds: sql.NullInt64{Int64: 3600, Valid: true}},
+		{ID: 4, RequestCount: 100, SuccessCount: 99, CaptchaCount: 2, IdleSeconds: sql.NullInt64{Int64: 3600, Valid: true}},
+	}
+	best := pickHealthiestCookie(candidates)
+	if best < 0 || candidates[best].ID != 3 {
+		t.Fatalf("best = %d, want cookie 3", best)
+	}
+
+	// 从未使用过的 cookie 不会压过表现稳定的 cookie
+	fresh := cookieHealthScore(cookieCandidate{ID: 5})
+	if fresh >= cookieHealthScore(candidates[2]) {
+		t.Fatalf("fresh score = %.2f", fresh)
+	}
+
+	if pickHealthiestCookie(nil) != -1 {
+		t.Fatal("empty candidates should return -1")
+	}
+}
+
+func TestCookieCooldownGrowsExponentially(t *testing.T) {
+	base := 10 * time.Minute
+	cases := map[int]time.Duration{
+		0:  10 * time.Minute,
+		1:  10 * time.Minute,
+		2:  20 * time.Minute,
+		3:  40 * time.Minute,
+		20: COOKIE_COOLDOWN_MAX,
+	}
+	for strikes, want := range cases {
+		if got := cookieCooldown(base, strikes); got != want {
+			t.Errorf("cookieCooldown(%d) = %s, want %s", strikes, got, want)
+		}
+	}
+}
+
+func TestIsCookieRequestSuccess(t *testing.T) {
+	for _, err := range []error{nil, ERROR_NOT_404, ERROR_EMPTY_RESULTS} {
+		if !isCookieRequestSuccess(err) {
+			t.Errorf("%v should count as success", err)
+		}
+	}
+	for _, err := range []error{ERROR_VERIFICATION, ERROR_SIGN_IN, ERROR_NOT_503} {
+		if isCookieRequestSuccess(err) {
+			t.Errorf("%v should count as failure", err)
+		}
+	}
+}
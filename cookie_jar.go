@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// CookieConfig Cookie 会话配置
+type CookieConfig struct {
+	Save_interval int `yaml:"save_interval"` // 回写 amc_cookie 的最小间隔（秒），默认 60
+	Cooldown      int `yaml:"cooldown"`      // 首次被拒绝后的冷却时间（秒），之后每次翻倍，默认 600
+	Max_strikes   int `yaml:"max_strikes"`   // 连续被拒绝多少次后标记为失效，默认 3
+}
+
+// cookieJar 按 cookie ID 合并响应中的 Set-Cookie，并防抖回写数据库
+type cookieJar struct {
+	mu       sync.Mutex
+	interval time.Duration
+	now      func() time.Time
+	save     func(cookieID int64, cookie string) error
+	pending  map[int64]string    // 待回写的合并结果
+	saving   map[int64]bool      // 正在回写，同一 cookie 同时只写一次，避免旧值覆盖新值
+	lastSave map[int64]time.Time // 最近一次回写时间
+}
+
+var jar = newCookieJar(time.Minute, saveCookieValue)
+
+func newCookieJar(interval time.Duration, save func(int64, string) error) *cookieJar {
+	return &cookieJar{
+		interval: interval,
+		now:      time.Now,
+		save:     save,
+		pending:  make(map[int64]string),
+		saving:   make(map[int64]bool),
+		lastSave: make(map[int64]time.Time),
+	}
+}
+
+// saveCookieValue 将合并后的 cookie 写回 amc_cookie
+func saveCookieValue(cookieID int64, cookie string) error {
+	if _, err := app.db.Exec("UPDATE amc_cookie SET cookie = ? WHERE id = ?", cookie, cookieID); err != nil {
+		return err
+	}
+	if cookieID == app.cookieID {
+		app.cookieBase = cookie
+	}
+	return nil
+}
+
+// Merge 将响应中的 Set-Cookie 合并到 current，有变化时登记待回写，返回合并后的 cookie
+// 距上次回写超过 interval 时，顺带回写该 cookie 待保存的内容（不持有锁访问数据库）
+func (j *cookieJar) Merge(cookieID int64, current string, setCookies []string) string {
+	if cookieID == 0 {
+		return current
+	}
+	merged := current
+	if len(setCookies) > 0 {
+		merged = mergeCookieString(current, setCookies, j.now())
+	}
+
+	j.mu.Lock()
+	if merged != current {
+		j.pending[cookieID] = merged
+	}
+	var cookie string
+	var due bool
+	if last, ok := j.lastSave[cookieID]; !ok || j.now().Sub(last) >= j.interval {
+		cookie, due = j.takeLocked(cookieID)
+	}
+	j.mu.Unlock()
+
+	if due {
+		j.write(cookieID, cookie)
+	}
+	return merged
+}
+
+// Flush 立即回写所有待保存的 cookie
+func (j *cookieJar) Flush() {
+	j.mu.Lock()
+	batch := make(map[int64]string, len(j.pending))
+	for cookieID := range j.pending {
+		if cookie, ok := j.takeLocked(cookieID); ok {
+			batch[cookieID] = cookie
+		}
+	}
+	j.mu.Unlock()
+
+	for cookieID, cookie := range batch {
+		j.write(cookieID, cookie)
+	}
+}
+
+// Forget 丢弃指定 cookie 的待回写内容（cookie 失效或被外部修改时调用）
+func (j *cookieJar) Forget(cookieID int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.pending, cookieID)
+}
+
+// takeLocked 取出待回写的内容并标记为正在回写，已在回写或没有待回写内容时返回 false
+func (j *cookieJar) takeLocked(cookieID int64) (string, bool) {
+	cookie, ok := j.pending[cookieID]
+	if !ok || j.saving[cookieID] {
+		return "", false
+	}
+	delete(j.pending, cookieID)
+	j.saving[cookieID] = true
+	return cookie, true
+}
+
+// write 回写 takeLocked 取出的内容，失败时若没有更新的内容则放回待回写
+func (j *cookieJar) write(cookieID int64, cookie string) {
+	err := j.save(cookieID, cookie)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.saving, cookieID)
+	if err != nil {
+		if _, newer := j.pending[cookieID]; !newer {
+			j.pending[cookieID] = cookie
+		}
+		log.Errorf("回写 cookie 失败 (id=%d): %v", cookieID, err)
+		return
+	}
+	j.lastSave[cookieID] = j.now()
+	log.Infof("已回写刷新后的 cookie (id=%d)", cookieID)
+}
+
+// mergeCookieString 将 Set-Cookie 合并到 "k=v; k2=v2" 格式的 cookie 字符串中
+// 保留原有顺序，已过期或 Max-Age<=0 的条目将被删除，新条目追加到末尾
+func mergeCookieString(current string, setCookies []string, now time.Time) string {
+	var names []string
+	values := make(map[string]string)
+	for _, part := range strings.Split(current, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if idx := strings.Index(part, "="); idx >= 0 {
+			name, value = strings.TrimSpace(part[:idx]), part[idx+1:]
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	for _, line := range setCookies {
+		name, value, expired := parseSetCookie(line, now)
+		if name == "" {
+			continue
+		}
+		if expired {
+			delete(values, name)
+			continue
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	parts := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseSetCookie 解析一行 Set-Cookie，保留原始值（包括引号，如 session-token="xxx"）
+func parseSetCookie(line string, now time.Time) (name, value string, expired bool) {
+	parts := strings.Split(line, ";")
+	pair := strings.TrimSpace(parts[0])
+	idx := strings.Index(pair, "=")
+	if idx <= 0 {
+		return "", "", false
+	}
+	name, value = strings.TrimSpace(pair[:idx]), strings.TrimSpace(pair[idx+1:])
+
+	for _, attr := range parts[1:] {
+		attr = strings.TrimSpace(attr)
+		key, val := attr, ""
+		if i := strings.Index(attr, "="); i >= 0 {
+			key, val = attr[:i], strings.TrimSpace(attr[i+1:])
+		}
+		switch strings.ToLower(key) {
+		case "max-age":
+			if maxAge, err := strconv.Atoi(val); err == nil && maxAge <= 0 {
+				expired = true
+			}
+		case "expires":
+			if t, err := http.ParseTime(val); err == nil && t.Before(now) {
+				expired = true
+			}
+		}
+	}
+	return name, value, expired
+}
+
+// storeResponseCookies 合并响应中的 Set-Cookie 到当前会话
+func (app *appConfig) storeResponseCookies(resp *http.Response) {
+	if app.cookieID == 0 || app.cookie == "" {
+		return
+	}
+	app.cookie = jar.Merge(app.cookieID, app.cookie, resp.Header.Values("Set-Cookie"))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMergeCookieString(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := `session-id=111; i18n-prefs=USD; session-token="old"; csm-hit=abc`
+	got := mergeCookieString(current, []string{
+		`session-token="new+token=="; Domain=.amazon.com; Path=/; Secure; HttpOnly`,
+		`ubid-main=130-1; Domain=.amazon.com; Expires=Thu, 01 Jan 2032 00:00:00 GMT; Path=/`,
+		`csm-hit=; Domain=.amazon.com; Expires=Thu, 01 Jan 1970 00:00:01 GMT; Path=/`,
+		`i18n-prefs=EUR; Max-Age=0`,
+	}, now)
+	assertEqual(t, "merged", got, `session-id=111; session-token="new+token=="; ubid-main=130-1`)
+}
+
+func TestMergeCookieStringReAddsDeletedCookieOnce(t *testing.T) {
+	got := mergeCookieString("a=1; b=2", []string{"a=; Max-Age=-1", "a=3"}, time.Now())
+	assertEqual(t, "merged", got, "a=3; b=2")
+}
+
+func TestCookieJarDebouncesSaves(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var saved []string
+	j := newCookieJar(time.Minute, func(id int64, cookie string) error {
+		saved = append(saved, fmt.Sprintf("%d:%s", id, cookie))
+		return nil
+	})
+	j.now = func() time.Time { return now }
+
+	cookie := j.Merge(1, "a=1", []string{"a=2"})
+	assertEqual(t, "first merge", cookie, "a=2")
+	if len(saved) != 1 {
+		t.Fatalf("first change should be saved immediately, saved=%v", saved)
+	}
+
+	now = now.Add(10 * time.Second)
+	cookie = j.Merge(1, cookie, []string{"b=1"})
+	assertEqual(t, "second merge", cookie, "a=2; b=1")
+	if len(saved) != 1 {
+		t.Fatalf("change within interval should be deferred, saved=%v", saved)
+	}
+
+	// 其他 cookie 的防抖互不影响
+	j.Merge(2, "x=1", []string{"x=2"})
+	if len(saved) != 2 {
+		t.Fatalf("other cookie should be saved, saved=%v", saved)
+	}
+
+	// 超过间隔后，下一次响应（即使没有新的 Set-Cookie）会回写之前的变化
+	now = now.Add(time.Minute)
+	j.Merge(1, cookie, nil)
+	if len(saved) != 3 || saved[2] != "1:a=2; b=1" {
+		t.Fatalf("pending change should be saved after interval, saved=%v", saved)
+	}
+
+	j.Merge(1, cookie, []string{"c=1"})
+	j.Flush()
+	if len(saved) != 4 || saved[3] != "1:a=2; b=1; c=1" {
+		t.Fatalf("flush should save pending change, saved=%v", saved)
+	}
+}
+
+func TestCookieJarSavesWithoutLockAndRetriesFailures(t *testing.T) {
+	var j *cookieJar
+	fail := true
+	var saved []string
+	j = newCookieJar(time.Minute, func(id int64, cookie string) error {
+		// 回写期间其他请求仍可合并
+		if !j.mu.TryLock() {
+			t.Fatal("jar locked during save")
+		}
+		j.mu.Unlock()
+		if fail {
+			return fmt.Errorf("db down")
+		}
+		saved = append(saved, cookie)
+		return nil
+	})
+
+	j.Merge(1, "a=1", []string{"a=2"})
+	assertEqual(t, "requeued", j.pending[1], "a=2")
+
+	fail = false
+	j.Flush()
+	assertEqual(t, "saved", fmt.Sprint(saved), "[a=2]")
+	assertEqual(t, "pending", fmt.Sprint(len(j.pending), len(j.saving)), "0 0")
+}
+
+func TestFetchMergesSetCookie(t *testing.T) {
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", `session-token="refreshed"; Path=/; Secure`)
+		http.ServeFile(w, r, "testdata/pages/product_ok.html")
+	})
+
+	var saved []string
+	oldJar, oldID := jar, app.cookieID
+	jar = newCookieJar(time.Minute, func(id int64, cookie string) error {
+		saved = append(saved, cookie)
+		return nil
+	})
+	app.cookieID = 7
+	t.Cleanup(func() { jar, app.cookieID = oldJar, oldID })
+
+	if _, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/dp/B0DKF7HNZX", Mode: FETCH_MODE_PRODUCT}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "cookie", app.cookie, `session-id=123; session-token="refreshed"`)
+	if len(saved) != 1 || saved[0] != app.cookie {
+		t.Fatalf("saved = %v", saved)
+	}
+}
+
+func TestFetchDoesNotShareCookieAcrossMarketplaces(t *testing.T) {
+	var gotCookie string
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		gotCookie = r.Header.Get("Cookie")
+		w.Header().Add("Set-Cookie", `session-token="de-session"; Path=/; Secure`)
+		http.ServeFile(w, r, "testdata/pages/product_ok.html")
+	})
+
+	var saved []string
+	oldJar, oldID := jar, app.cookieID
+	jar = newCookieJar(time.Minute, func(id int64, cookie string) error {
+		saved = append(saved, cookie)
+		return nil
+	})
+	app.cookieID = 7
+	// cookie 属于配置文件的站点，测试服务器视为其他站点
+	app.Domain = "www.amazon.com"
+	t.Cleanup(func() { jar, app.cookieID = oldJar, oldID })
+
+	if _, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/dp/B0DKF7HNZX", Mode: FETCH_MODE_PRODUCT}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "request cookie", gotCookie, "")
+	assertEqual(t, "session cookie", app.cookie, "session-id=123")
+	if len(saved) != 0 {
+		t.Fatalf("saved = %v", saved)
+	}
+}
+
+func TestCookieDomainMatches(t *testing.T) {
+	oldDomain := app.Domain
+	t.Cleanup(func() { app.Domain = oldDomain })
+
+	app.Domain = "www.amazon.com"
+	assertEqual(t, "same", fmt.Sprint(cookieDomainMatches("WWW.amazon.com")), "true")
+	assertEqual(t, "bare", fmt.Sprint(cookieDomainMatches("amazon.com")), "true")
+	assertEqual(t, "other marketplace", fmt.Sprint(cookieDomainMatches("www.amazon.de")), "false")
+	app.Domain = ""
+	assertEqual(t, "unset", fmt.Sprint(cookieDomainMatches("www.amazon.com")), "false")
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 
@@ -50,68 +51,143 @@ type SellerDetail struct {
 
 // ExecuteCrawl 执行单个关键词的完整爬取流程
 // 流程: 搜索商品 -> 提取卖家ID -> 获取卖家详情
-func ExecuteCrawl(task CrawlTask) {
-	ExecuteCrawlWithStatus(task)
+func ExecuteCrawl(ctx context.Context, task CrawlTask) {
+	ExecuteCrawlWithStatus(ctx, task)
+}
+
+// 关键词任务的执行结果
+const (
+	CRAWL_OUTCOME_COMPLETED   = "completed"
+	CRAWL_OUTCOME_PARTIAL     = "partial" // 已保存，但部分卖家详情获取失败
+	CRAWL_OUTCOME_FAILED      = "failed"
+	CRAWL_OUTCOME_INTERRUPTED = "interrupted" // 中断或租约被回收，任务会重新执行
+)
+
+// CrawlOutcome 关键词任务的执行结果和统计
+type CrawlOutcome struct {
+	Status       string // 见 CRAWL_OUTCOME_*
+	Products     int    // 搜索到的商品数
+	SellersFound int    // 从商品页发现的卖家数
+	Sellers      int    // 获取到详情的卖家数
+	Err          error
 }
 
 // ExecuteCrawlWithStatus 执行单个关键词的完整爬取流程，返回是否成功
 // 使用内存传递模式，最后批量写入数据库
-func ExecuteCrawlWithStatus(task CrawlTask) bool {
+// ctx 取消时保存已获取的数据并将任务重置为待执行，返回 false
+// 任务带有回调地址时，完成、部分完成或失败后登记回调
+func ExecuteCrawlWithStatus(ctx context.Context, task CrawlTask) bool {
+	outcome := executeCrawl(ctx, task)
+	if outcome.Status != CRAWL_OUTCOME_INTERRUPTED && task.CallbackURL != "" {
+		enqueueTaskWebhook(task, outcome)
+	}
+	return outcome.Status == CRAWL_OUTCOME_COMPLETED || outcome.Status == CRAWL_OUTCOME_PARTIAL
+}
+
+// executeCrawl 执行爬取并更新任务状态
+func executeCrawl(ctx context.Context, task CrawlTask) CrawlOutcome {
 	keyword := task.Keyword
 	log.Infof("========================================")
-	log.Infof("开始爬取关键词: %s (内存优化模式)", keyword)
+	log.Infof("开始爬取关键词: %s 站点: %s (内存优化模式)", keyword, task.domain())
 	log.Infof("========================================")
 
+	var outcome CrawlOutcome
+	// finish 更新任务状态，任务已被其他消费者认领时视为中断
+	finish := func(taskStatus int, status string, err error) CrawlOutcome {
+		outcome.Status, outcome.Err = status, err
+		if setTaskStatus(task, taskStatus, errorMessage(err)) == ERROR_TASK_LEASE_LOST {
+			outcome.Status = CRAWL_OUTCOME_INTERRUPTED
+		}
+		return outcome
+	}
+	interrupted := func() CrawlOutcome {
+		outcome.Status, outcome.Err = CRAWL_OUTCOME_INTERRUPTED, ctx.Err()
+		return outcome
+	}
+
 	// 阶段1: 搜索商品（返回内存列表，不写数据库）
-	products, err := crawlSearchInMemory(keyword, task.ID)
+	setTaskStage(task, TASK_STAGE_SEARCH)
+	products, err := crawlSearchInMemory(ctx, task)
+	outcome.Products = len(products)
+	if ctx.Err() != nil {
+		checkpointCrawl(task, nil, nil, nil)
+		return interrupted()
+	}
 	if err != nil {
 		log.Errorf("搜索阶段失败: %s, 错误: %v", keyword, err)
 		// 更新任务状态为失败
-		app.db.Exec("UPDATE amc_category SET task_status = ? WHERE id = ?", TASK_STATUS_FAILED, task.ID)
-		return false
+		return finish(TASK_STATUS_FAILED, CRAWL_OUTCOME_FAILED, fmt.Errorf("搜索阶段失败: %w", err))
 	}
 
 	if len(products) == 0 {
 		log.Warnf("没有找到商品: %s", keyword)
 		// 更新任务状态为完成（虽然没找到商品）
-		app.db.Exec("UPDATE amc_category SET task_status = ? WHERE id = ?", TASK_STATUS_COMPLETED, task.ID)
-		return true
+		return finish(TASK_STATUS_COMPLETED, CRAWL_OUTCOME_COMPLETED, nil)
 	}
 
 	// 阶段2: 从商品列表中提取卖家信息（内存去重）
-	sellerMap, err := crawlProductsFromMemory(products, keyword)
+	setTaskStage(task, TASK_STAGE_PRODUCT)
+	sellerMap, err := crawlProductsFromMemory(ctx, task.domain(), products, keyword)
+	outcome.SellersFound = len(sellerMap)
+	if ctx.Err() != nil {
+		checkpointCrawl(task, products, sellerMap, nil)
+		return interrupted()
+	}
 	if err != nil {
 		log.Errorf("提取卖家信息失败: %s, 错误: %v", keyword, err)
-		app.db.Exec("UPDATE amc_category SET task_status = ? WHERE id = ?", TASK_STATUS_FAILED, task.ID)
-		return false
+		return finish(TASK_STATUS_FAILED, CRAWL_OUTCOME_FAILED, fmt.Errorf("提取卖家信息失败: %w", err))
 	}
 
 	if len(sellerMap) == 0 {
 		log.Warnf("没有找到卖家: %s", keyword)
 		// 仍然保存商品数据
-		_ = batchSaveAll(keyword, task.ID, products, []*SellerDetail{})
-		return true
+		return saveOutcome(task, outcome, products, []*SellerDetail{})
 	}
 
 	// 阶段3: 获取卖家详情
-	sellerDetails, err := fetchSellerDetails(sellerMap)
+	setTaskStage(task, TASK_STAGE_SELLER)
+	sellerDetails, err := fetchSellerDetails(ctx, task.domain(), sellerMap)
+	outcome.Sellers = len(sellerDetails)
+	if ctx.Err() != nil {
+		checkpointCrawl(task, products, sellerMap, sellerDetails)
+		return interrupted()
+	}
 	if err != nil {
 		log.Errorf("获取卖家详情失败: %s, 错误: %v", keyword, err)
-		app.db.Exec("UPDATE amc_category SET task_status = ? WHERE id = ?", TASK_STATUS_FAILED, task.ID)
-		return false
+		return finish(TASK_STATUS_FAILED, CRAWL_OUTCOME_FAILED, fmt.Errorf("获取卖家详情失败: %w", err))
 	}
 
 	// 阶段4: 批量保存所有数据到数据库（事务）
-	if err := batchSaveAll(keyword, task.ID, products, sellerDetails); err != nil {
-		log.Errorf("批量保存数据失败: %s, 错误: %v", keyword, err)
-		app.db.Exec("UPDATE amc_category SET task_status = ? WHERE id = ?", TASK_STATUS_FAILED, task.ID)
-		return false
+	outcome = saveOutcome(task, outcome, products, sellerDetails)
+	if outcome.Status == CRAWL_OUTCOME_FAILED || outcome.Status == CRAWL_OUTCOME_INTERRUPTED {
+		return outcome
 	}
 
 	log.Infof("========================================")
 	log.Infof("关键词爬取完成: %s (商品=%d, 卖家=%d)", keyword, len(products), len(sellerDetails))
 	log.Infof("========================================")
-	return true
+	return outcome
+}
+
+// saveOutcome 批量保存数据并确定任务结果，部分卖家详情获取失败时为部分完成
+func saveOutcome(task CrawlTask, outcome CrawlOutcome, products []*ProductInfo, sellerDetails []*SellerDetail) CrawlOutcome {
+	outcome.Status, outcome.Err = CRAWL_OUTCOME_COMPLETED, nil
+	if outcome.Sellers < outcome.SellersFound {
+		outcome.Status = CRAWL_OUTCOME_PARTIAL
+		outcome.Err = fmt.Errorf("%d 个卖家详情获取失败", outcome.SellersFound-outcome.Sellers)
+	}
+
+	err := batchSaveAll(task, products, sellerDetails, errorMessage(outcome.Err))
+	switch {
+	case errors.Is(err, ERROR_TASK_LEASE_LOST):
+		log.Warnf("任务已被其他消费者认领，放弃保存 ID:%d 关键词:%s", task.ID, task.Keyword)
+		outcome.Status, outcome.Err = CRAWL_OUTCOME_INTERRUPTED, err
+	case err != nil:
+		log.Errorf("批量保存数据失败: %s, 错误: %v", task.Keyword, err)
+		outcome.Status, outcome.Err = CRAWL_OUTCOME_FAILED, fmt.Errorf("批量保存数据失败: %w", err)
+		setTaskStatus(task, TASK_STATUS_FAILED, outcome.Err.Error())
+	}
+	return outcome
 }
 
 // ============================================================
@@ -119,26 +195,26 @@ func ExecuteCrawlWithStatus(task CrawlTask) bool {
 // ============================================================
 
 // ExecuteCrawlLegacy 旧的执行方式（数据库传递模式），保留用于命令行模式
-func ExecuteCrawlLegacy(task CrawlTask) bool {
+func ExecuteCrawlLegacy(ctx context.Context, task CrawlTask) bool {
 	keyword := task.Keyword
 	log.Infof("========================================")
 	log.Infof("开始爬取关键词: %s (传统模式)", keyword)
 	log.Infof("========================================")
 
 	// 阶段1: 搜索商品（传入任务 ID 用于搜索统计）
-	if err := crawlSearch(keyword, task.ID); err != nil {
+	if err := crawlSearch(ctx, keyword, task.ID); err != nil {
 		log.Errorf("搜索阶段失败: %s, 错误: %v", keyword, err)
 		return false
 	}
 
 	// 阶段2: 提取卖家ID
-	if err := crawlProduct(keyword); err != nil {
+	if err := crawlProduct(ctx, keyword); err != nil {
 		log.Errorf("产品处理阶段失败: %s, 错误: %v", keyword, err)
 		return false
 	}
 
 	// 阶段3: 获取卖家详情
-	if err := crawlSeller(keyword); err != nil {
+	if err := crawlSeller(ctx, keyword); err != nil {
 		log.Errorf("卖家信息获取阶段失败: %s, 错误: %v", keyword, err)
 		return false
 	}
@@ -150,7 +226,7 @@ func ExecuteCrawlLegacy(task CrawlTask) bool {
 }
 
 // crawlSearch 针对单个关键词执行搜索
-func crawlSearch(keyword string, categoryID int64) error {
+func crawlSearch(ctx context.Context, keyword string, categoryID int64) error {
 	log.Infof("------------------------")
 	log.Infof("1. 开始搜索关键词: %s", keyword)
 
@@ -170,20 +246,24 @@ func crawlSearch(keyword string, categoryID int64) error {
 	s.end = 2 // 只搜索首页
 	s.valid = 0
 
-	for ; s.start < s.end; s.start++ {
-		h, err := s.request(s.start)
-		switch err {
-		case nil:
+	for ; s.start < s.end && ctx.Err() == nil; s.start++ {
+		h, err := s.request(ctx, s.start)
+		switch {
+		case ctx.Err() != nil:
+			continue
+		case err == nil:
 			break
-		case ERROR_NOT_404, ERROR_NOT_503:
+		case err == ERROR_NOT_404:
+			continue
+		case err == ERROR_NOT_503:
+			// 限速器已暂停该站点的请求，重试当前页
 			s.start--
-			sleep(120)
 			continue
 		default:
 			log.Error(err)
 			continue
 		}
-		s.get_product_url(h)
+		s.get_product_url(ctx, h)
 	}
 
 	if err := s.search_end(insert_id); err != nil {
@@ -196,22 +276,23 @@ func crawlSearch(keyword string, categoryID int64) error {
 }
 
 // crawlProduct 处理与关键词相关的产品
-func crawlProduct(keyword string) error {
+func crawlProduct(ctx context.Context, keyword string) error {
 	log.Infof("------------------------")
 	log.Infof("2. 开始处理关键词相关产品: %s", keyword)
 
 	formattedKeyword := formatKeyword(keyword)
 
 	// 更新该关键词相关的产品状态
-	_, err := app.db.Exec("UPDATE amc_product SET status = ?, app = ? WHERE (status = ? OR status = ?) AND keyword = ? LIMIT 1000",
-		MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, MYSQL_PRODUCT_STATUS_INSERT, MYSQL_PRODUCT_STATUS_ERROR_OVER, formattedKeyword)
+	_, err := app.db.ExecContext(ctx, "UPDATE amc_product SET status = ?, app = ?, "+CLAIM_LEASE_SET+" WHERE (status = ? OR status = ?) AND keyword = ? AND domain = ? LIMIT 1000",
+		MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, app.Claim.Lease_seconds, MYSQL_PRODUCT_STATUS_INSERT, MYSQL_PRODUCT_STATUS_ERROR_OVER, formattedKeyword, app.Domain)
 	if err != nil {
 		log.Errorf("更新product表失败: %v", err)
 		return err
 	}
+	defer keepClaims(ctx, "商品", renewProductClaims)()
 
-	row, err := app.db.Query(`SELECT id, url, param, keyword FROM amc_product WHERE status = ? AND app = ? AND keyword = ?`,
-		MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, formattedKeyword)
+	row, err := app.db.QueryContext(ctx, `SELECT id, url, param, keyword FROM amc_product WHERE status = ? AND app = ? AND keyword = ? AND domain = ?`,
+		MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, formattedKeyword, app.Domain)
 	if err != nil {
 		log.Errorf("查询product表失败: %v", err)
 		return err
@@ -230,36 +311,33 @@ func crawlProduct(keyword string) error {
 			continue
 		}
 		url = "https://" + app.Domain + url + param
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, url); err != nil {
-			log.Errorf("%v", err)
-			continue
-		}
 
 		log.Infof("查找商品链接 ID:%d url:%s", primary_id, url)
-		err := product.request(url)
+		err := product.request(ctx, url)
 		if err != nil {
-			if err == ERROR_NOT_SELLER_URL {
+			if ctx.Err() != nil {
+				break
+			} else if err == ERROR_NOT_SELLER_URL {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_NO_PRODUCT, "", "", "")
 				continue
+			} else if isRobotsDisallow(err) {
+				log.Errorf("%v", err)
+				continue
 			} else if err == ERROR_NOT_404 || err == ERROR_NOT_503 {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
-				sleep(300)
 				continue
-			} else if err == ERROR_VERIFICATION {
+			} else if isCookieRejected(err) {
 				// Cookie 失效，标记失效并尝试获取新的
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
 				if err := app.handleCookieInvalid(); err != nil {
 					log.Errorf("处理 cookie 失效失败: %v", err)
 				}
-				sleep(300)
 				continue
 			} else {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
-				sleep(300)
 				continue
 			}
 		}
@@ -298,22 +376,23 @@ func crawlProduct(keyword string) error {
 }
 
 // crawlSeller 处理与关键词相关的卖家
-func crawlSeller(keyword string) error {
+func crawlSeller(ctx context.Context, keyword string) error {
 	log.Infof("------------------------")
 	log.Infof("3. 开始获取关键词相关卖家信息: %s", keyword)
 
 	formattedKeyword := formatKeyword(keyword)
 
 	// 更新该关键词相关的卖家状态
-	_, err := app.db.Exec("UPDATE amc_seller SET app_id = ? WHERE all_status = ? AND keyword = ? LIMIT 100",
-		app.Basic.App_id, MYSQL_SELLER_STATUS_INFO_INSERT, formattedKeyword)
+	_, err := app.db.ExecContext(ctx, "UPDATE amc_seller SET app_id = ?, "+CLAIM_LEASE_SET+" WHERE all_status = ? AND keyword = ? AND domain = ? LIMIT 100",
+		app.Basic.App_id, app.Claim.Lease_seconds, MYSQL_SELLER_STATUS_INFO_INSERT, formattedKeyword, app.Domain)
 	if err != nil {
 		log.Errorf("更新seller表失败: %v", err)
 		return err
 	}
+	defer keepClaims(ctx, "商家", renewSellerClaims)()
 
-	row, err := app.db.Query("SELECT id, seller_id, seller_name, keyword FROM amc_seller WHERE all_status = ? AND app_id = ? AND keyword = ?",
-		MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id, formattedKeyword)
+	row, err := app.db.QueryContext(ctx, "SELECT id, seller_id, seller_name, keyword FROM amc_seller WHERE all_status = ? AND app_id = ? AND keyword = ? AND domain = ?",
+		MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id, formattedKeyword, app.Domain)
 	if err != nil {
 		log.Errorf("查询seller表失败: %v", err)
 		return err
@@ -338,15 +417,20 @@ func crawlSeller(keyword string) error {
 		}
 		seller.url = "https://" + app.Domain + "/sp?ie=UTF8&seller=" + seller.seller_id
 
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, seller.url); err != nil {
-			log.Errorf("%v", err)
-			continue
-		}
-
-		for err := seller.request(); err != nil; {
+		err := seller.request(ctx)
+		for err != nil && ctx.Err() == nil {
 			log.Error(err)
-			sleep(120)
+			if isPageUnrecoverable(err) {
+				break
+			}
+			// 重试前的等待由限速器统一控制
+			err = seller.request(ctx)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			continue
 		}
 
 		seller.trnCheck()
@@ -375,78 +459,21 @@ func formatKeyword(keyword string) string {
 // 以下为 HTTP 模式内存传递优化相关函数
 // ============================================================
 
-// crawlSearchInMemory 搜索商品并返回内存列表（不写数据库）
-func crawlSearchInMemory(keyword string, categoryID int64) ([]*ProductInfo, error) {
+// crawlSearchInMemory 搜索商品并返回内存列表（商品不写数据库，只记录搜索统计）
+func crawlSearchInMemory(ctx context.Context, task CrawlTask) ([]*ProductInfo, error) {
 	log.Infof("------------------------")
-	log.Infof("1. 开始搜索关键词: %s (内存模式)", keyword)
-
-	formattedKeyword := formatKeyword(keyword)
-
-	// 构建搜索URL
-	searchURL := fmt.Sprintf("https://%s/s?k=%s&page=1&dc", app.Domain, formattedKeyword)
-
-	fp := GetCurrentFingerprint()
-	if err := robot.IsAllow(fp.UserAgent, searchURL); err != nil {
-		log.Errorf("robots.txt 不允许: %v", err)
-		return nil, err
-	}
-
-	// 发送请求
-	client := get_client()
-	req, err := http.NewRequest("GET", searchURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// 设置请求头 - 使用统一的指纹系统
-	ApplyFingerprint(req, GetRandomReferer(app.Domain))
-	if _, err := app.get_cookie(); err == nil {
-		req.Header.Set("Cookie", app.cookie)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// 处理响应状态码
-	switch resp.StatusCode {
-	case 200:
-		// OK
-	case 404:
-		return nil, ERROR_NOT_404
-	case 503:
-		return nil, ERROR_NOT_503
-	default:
-		return nil, fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// 检测验证页面
-	title := doc.Find("title").Text()
-	if strings.Contains(title, "Enter the characters") ||
-		strings.Contains(title, "Type the characters") ||
-		strings.Contains(title, "Robot check") ||
-		doc.Find("form[action*=/captcha/").Length() > 0 {
-		return nil, ERROR_VERIFICATION
-	}
+	log.Infof("1. 开始搜索关键词: %s (内存模式)", task.Keyword)
 
-	// 解析商品列表
-	products, err := parseSearchResults(doc, keyword)
+	products, err := searchProducts(ctx, task)
 	if err != nil {
 		return nil, err
 	}
 
 	// 插入搜索统计记录（保持统计功能）
 	var s searchStruct
-	s.en_key = formattedKeyword
-	s.zh_key = keyword
-	s.category_id = categoryID
+	s.en_key = formatKeyword(task.Keyword)
+	s.zh_key = task.Keyword
+	s.category_id = task.ID
 	s.valid = len(products)
 	if insertID, err := s.searchStartForAPI(); err == nil {
 		s.search_end(insertID)
@@ -457,6 +484,64 @@ func crawlSearchInMemory(keyword string, categoryID int64) ([]*ProductInfo, erro
 	return products, nil
 }
 
+// searchProducts 依次搜索 1 到 task.MaxPages 页，某页没有新商品或已达到 task.MaxASINs 时停止
+// 第 1 页失败时返回错误，之后的页失败只记录日志，返回已获取的商品
+func searchProducts(ctx context.Context, task CrawlTask) ([]*ProductInfo, error) {
+	keyword := task.Keyword
+	formattedKeyword := formatKeyword(keyword)
+	maxPages := task.MaxPages
+	if maxPages <= 0 {
+		maxPages = 1
+	}
+
+	var products []*ProductInfo
+	seen := make(map[string]bool)
+search:
+	for pageNo := 1; pageNo <= maxPages; pageNo++ {
+		// 构建搜索URL
+		searchURL := fmt.Sprintf("https://%s/s?k=%s&page=%d&dc", task.domain(), formattedKeyword, pageNo)
+
+		page, err := fetcher.Fetch(ctx, &FetchRequest{URL: searchURL, Mode: FETCH_MODE_SEARCH})
+		var found []*ProductInfo
+		switch err {
+		case nil:
+			// 解析商品列表
+			found, err = parseSearchResults(page.Doc, keyword)
+			if err != nil {
+				recordParseFailure(task.domain(), FETCH_MODE_SEARCH)
+			}
+		case ERROR_EMPTY_RESULTS:
+			// 搜索无结果不算失败，按 0 个商品处理
+			log.Infof("搜索无结果 关键词:%s 第%d页", keyword, pageNo)
+			break search
+		}
+		if err != nil {
+			if pageNo == 1 {
+				return nil, err
+			}
+			log.Warnf("搜索第%d页失败，使用已获取的 %d 个商品: %v", pageNo, len(products), err)
+			break
+		}
+
+		added := 0
+		for _, p := range found {
+			if seen[p.ASIN] {
+				continue
+			}
+			seen[p.ASIN] = true
+			products = append(products, p)
+			added++
+			if task.MaxASINs > 0 && len(products) >= task.MaxASINs {
+				break search
+			}
+		}
+		if added == 0 {
+			break
+		}
+	}
+	return products, nil
+}
+
 // parseSearchResults 解析搜索结果页面，返回商品列表（内存去重）
 func parseSearchResults(doc *goquery.Document, keyword string) ([]*ProductInfo, error) {
 	res := doc.Find("div[class~=s-search-results]").First()
@@ -471,6 +556,7 @@ func parseSearchResults(doc *goquery.Document, keyword string) ([]*ProductInfo,
 
 	// 使用 map 进行 ASIN 去重
 	productMap := make(map[string]*ProductInfo)
+	var result []*ProductInfo
 
 	// ASIN 计数器
 	withBoughtCount := 0
@@ -577,8 +663,8 @@ func parseSearchResults(doc *goquery.Document, keyword string) ([]*ProductInfo,
 		url = urlParts[0]
 		param = "/ref=" + urlParts[1]
 
-		// 添加到结果集
-		productMap[asin] = &ProductInfo{
+		// 添加到结果集，保持页面上的顺序
+		p := &ProductInfo{
 			URL:         url,
 			Param:       param,
 			Title:       title,
@@ -589,19 +675,16 @@ func parseSearchResults(doc *goquery.Document, keyword string) ([]*ProductInfo,
 			Rating:      rating,
 			ReviewCount: reviewCount,
 		}
-	})
-
-	// 转换为切片
-	result := make([]*ProductInfo, 0, len(productMap))
-	for _, p := range productMap {
+		productMap[asin] = p
 		result = append(result, p)
-	}
+	})
 
 	return result, nil
 }
 
 // crawlProductsFromMemory 从商品列表中提取卖家信息（内存去重）
-func crawlProductsFromMemory(products []*ProductInfo, keyword string) (map[string]*SellerInfo, error) {
+// ctx 取消时返回已发现的卖家和 ctx.Err()
+func crawlProductsFromMemory(ctx context.Context, domain string, products []*ProductInfo, keyword string) (map[string]*SellerInfo, error) {
 	log.Infof("------------------------")
 	log.Infof("2. 开始处理 %d 个商品，提取卖家信息 (内存模式)", len(products))
 
@@ -616,27 +699,26 @@ func crawlProductsFromMemory(products []*ProductInfo, keyword string) (map[strin
 	const maxCookieSwitches = 1  // 最多切换1次cookie
 
 	for _, p := range products {
-		// 构建完整URL
-		fullURL := "https://" + app.Domain + p.URL + p.Param
-
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, fullURL); err != nil {
-			log.Errorf("robots.txt 不允许: %v", err)
-			continue
+		if ctx.Err() != nil {
+			return sellerMap, ctx.Err()
 		}
+		// 构建完整URL
+		fullURL := "https://" + domain + p.URL + p.Param
 
 		log.Infof("处理商品 ASIN:%s URL:%s", p.ASIN, fullURL)
 
 		// 请求商品页获取卖家信息
-		sellerID, sellerName, brandName, err := fetchSellerInfoFromProduct(fullURL)
+		sellerID, sellerName, brandName, err := fetchSellerInfoFromProduct(ctx, fullURL)
 		if err != nil {
-			if err == ERROR_VERIFICATION {
+			if ctx.Err() != nil {
+				return sellerMap, ctx.Err()
+			} else if isCookieRejected(err) {
 				log.Errorf("Cookie 验证失败，尝试获取新 Cookie")
 				if handleErr := app.handleCookieInvalid(); handleErr != nil {
 					log.Errorf("获取新 Cookie 失败: %v", handleErr)
 				}
 				// 重试一次
-				sellerID, sellerName, brandName, err = fetchSellerInfoFromProduct(fullURL)
+				sellerID, sellerName, brandName, err = fetchSellerInfoFromProduct(ctx, fullURL)
 				if err != nil {
 					log.Errorf("重试后仍然失败: %v", err)
 					continue
@@ -664,6 +746,9 @@ func crawlProductsFromMemory(products []*ProductInfo, keyword string) (map[strin
 			} else if err == ERROR_NOT_SELLER_URL {
 				log.Infof("商品没有卖家链接: %s", p.ASIN)
 				continue
+			} else if isRobotsDisallow(err) {
+				log.Errorf("%v", err)
+				continue
 			} else {
 				log.Errorf("获取卖家信息失败: %v", err)
 				continue
@@ -708,126 +793,20 @@ func crawlProductsFromMemory(products []*ProductInfo, keyword string) (map[strin
 }
 
 // fetchSellerInfoFromProduct 从商品页面提取卖家信息
-func fetchSellerInfoFromProduct(productURL string) (sellerID, sellerName, brandName string, err error) {
-	client := get_client()
-	req, err := http.NewRequest("GET", productURL, nil)
-	if err != nil {
-		return "", "", "", err
-	}
-
-	// 设置请求头 - 使用统一的指纹系统
-	ApplyFingerprint(req, GetRandomReferer(app.Domain))
-	if _, err := app.get_cookie(); err == nil {
-		req.Header.Set("Cookie", app.cookie)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", "", err
-	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		// OK
-	case 404:
-		return "", "", "", ERROR_NOT_404
-	case 503:
-		return "", "", "", ERROR_NOT_503
-	default:
-		return "", "", "", fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func fetchSellerInfoFromProduct(ctx context.Context, productURL string) (sellerID, sellerName, brandName string, err error) {
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: productURL, Mode: FETCH_MODE_PRODUCT})
 	if err != nil {
 		return "", "", "", err
 	}
+	doc := page.Doc
 
-	// 检测验证页面
-	if doc.Find("h4").First().Text() == "Enter the characters you see below" {
-		return "", "", "", ERROR_VERIFICATION
-	}
-
-	// 提取卖家链接 - 尝试多个选择器
-	var sellerSelection *goquery.Selection
-	selectors := []string{
-		"a[id=sellerProfileTriggerId]",
-		"a#sellerProfileTriggerId",
-		"#sellerProfileTriggerId",
-		"div#merchant-info a",
-		"div#tabular-buybox-container a",
-		"#merchant-info a",
-		"a[href*='seller=']",
-		"span.tabular-buybox-text a",
-		"div.tabular-buybox-container a",
-		"#vse-seller-link",
-	}
-
-	var href string
-	var exist bool
-	for _, selector := range selectors {
-		doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-			if exist {
-				return
-			}
-			h, e := s.Attr("href")
-			if e && strings.Contains(h, "seller=") {
-				sellerSelection = s
-				href = h
-				exist = true
-			}
-		})
-		if exist {
-			break
-		}
-	}
-
-	// 兜底方案：遍历所有 a 标签寻找包含 seller= 的链接
-	if !exist {
-		doc.Find("a").Each(func(i int, s *goquery.Selection) {
-			if exist {
-				return
-			}
-			h, e := s.Attr("href")
-			if e && strings.Contains(h, "seller=") {
-				sellerSelection = s
-				href = h
-				exist = true
-			}
-		})
-	}
-
-	if !exist {
+	// 提取卖家链接
+	sellerSelection, href, ok := findSellerLink(doc)
+	if !ok {
 		return "", "", "", ERROR_NOT_SELLER_URL
 	}
-
-	// 提取卖家名称
 	sellerName = strings.TrimSpace(sellerSelection.Text())
-
-	// 从 href 中提取 seller_id
-	u, err := url.Parse(href)
-	if err == nil {
-		sellerID = u.Query().Get("seller")
-	}
-	if sellerID == "" {
-		for _, part := range strings.Split(href, "&") {
-			if strings.HasPrefix(part, "seller=") {
-				sellerID = strings.Split(part, "seller=")[1]
-				break
-			}
-			if strings.Contains(part, "?seller=") {
-				parts := strings.Split(part, "?seller=")
-				if len(parts) > 1 {
-					sellerPart := parts[1]
-					if idx := strings.Index(sellerPart, "&"); idx > 0 {
-						sellerPart = sellerPart[:idx]
-					}
-					sellerID = sellerPart
-					break
-				}
-			}
-		}
-	}
+	sellerID = extractSellerID(href)
 
 	// 提取品牌名 - 尝试多个选择器
 	brandSelectors := []string{
@@ -872,7 +851,8 @@ func fetchSellerInfoFromProduct(productURL string) (sellerID, sellerName, brandN
 }
 
 // fetchSellerDetails 获取卖家详情信息
-func fetchSellerDetails(sellerMap map[string]*SellerInfo) ([]*SellerDetail, error) {
+// ctx 取消时返回已获取的详情和 ctx.Err()
+func fetchSellerDetails(ctx context.Context, domain string, sellerMap map[string]*SellerInfo) ([]*SellerDetail, error) {
 	log.Infof("------------------------")
 	log.Infof("3. 开始获取 %d 个卖家的详情信息 (内存模式)", len(sellerMap))
 
@@ -884,25 +864,24 @@ func fetchSellerDetails(sellerMap map[string]*SellerInfo) ([]*SellerDetail, erro
 	const maxCookieSwitches = 1  // 最多切换1次cookie
 
 	for sellerID, info := range sellerMap {
-		sellerURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", app.Domain, sellerID)
-
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, sellerURL); err != nil {
-			log.Errorf("robots.txt 不允许: %v", err)
-			continue
+		if ctx.Err() != nil {
+			return details, ctx.Err()
 		}
+		sellerURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", domain, sellerID)
 
 		log.Infof("获取卖家详情 ID:%s URL:%s", sellerID, sellerURL)
 
-		detail, err := fetchSellerDetailFromPage(sellerURL, info)
+		detail, err := fetchSellerDetailFromPage(ctx, sellerURL, info)
 		if err != nil {
-			if err == ERROR_VERIFICATION {
+			if ctx.Err() != nil {
+				return details, ctx.Err()
+			} else if isCookieRejected(err) {
 				log.Errorf("Cookie 验证失败，尝试获取新 Cookie")
 				if handleErr := app.handleCookieInvalid(); handleErr != nil {
 					log.Errorf("获取新 Cookie 失败: %v", handleErr)
 				}
 				// 重试一次
-				detail, err = fetchSellerDetailFromPage(sellerURL, info)
+				detail, err = fetchSellerDetailFromPage(ctx, sellerURL, info)
 				if err != nil {
 					log.Errorf("重试后仍然失败: %v", err)
 					continue
@@ -930,6 +909,9 @@ func fetchSellerDetails(sellerMap map[string]*SellerInfo) ([]*SellerDetail, erro
 			} else if err == ERROR_NOT_404 {
 				log.Errorf("请求失败 404: %v", err)
 				continue
+			} else if isRobotsDisallow(err) {
+				log.Errorf("%v", err)
+				continue
 			} else {
 				log.Errorf("获取卖家详情失败: %v", err)
 				continue
@@ -950,40 +932,12 @@ func fetchSellerDetails(sellerMap map[string]*SellerInfo) ([]*SellerDetail, erro
 }
 
 // fetchSellerDetailFromPage 从卖家页面提取详情
-func fetchSellerDetailFromPage(sellerURL string, info *SellerInfo) (*SellerDetail, error) {
-	client := get_client()
-	req, err := http.NewRequest("GET", sellerURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// 设置请求头 - 使用统一的指纹系统
-	ApplyFingerprint(req, GetRandomReferer(app.Domain))
-	if _, err := app.get_cookie(); err == nil {
-		req.Header.Set("Cookie", app.cookie)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		// OK
-	case 404:
-		return nil, ERROR_NOT_404
-	case 503:
-		return nil, ERROR_NOT_503
-	default:
-		return nil, fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+func fetchSellerDetailFromPage(ctx context.Context, sellerURL string, info *SellerInfo) (*SellerDetail, error) {
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: sellerURL, Mode: FETCH_MODE_SELLER})
 	if err != nil {
 		return nil, err
 	}
+	doc := page.Doc
 
 	detail := &SellerDetail{
 		SellerID:   info.SellerID,
@@ -1094,10 +1048,47 @@ func checkSellerInfoComplete(name, address, trn string) int {
 }
 
 // batchSaveAll 批量保存所有数据到数据库（事务）
-func batchSaveAll(keyword string, categoryID int64, products []*ProductInfo, sellerDetails []*SellerDetail) error {
+// message 为部分卖家获取失败等提示，写入任务的 error_message
+func batchSaveAll(task CrawlTask, products []*ProductInfo, sellerDetails []*SellerDetail, message string) error {
 	log.Infof("------------------------")
 	log.Infof("4. 开始批量保存数据到数据库 (事务模式)")
+	setTaskStage(task, TASK_STAGE_SAVE)
+	return saveCrawlResult(task, TASK_STATUS_COMPLETED, message, products, sellerDetails, nil)
+}
+
+// checkpointCrawl 任务被中断时保存已获取的数据，并将任务重置为待执行
+// 已发现但未获取详情的卖家以待处理状态写入 amc_seller，已存在的卖家不受影响
+// 退出时 ctx 已取消，数据库写入不使用 ctx
+func checkpointCrawl(task CrawlTask, products []*ProductInfo, sellerMap map[string]*SellerInfo, details []*SellerDetail) {
+	done := make(map[string]bool, len(details))
+	for _, d := range details {
+		done[d.SellerID] = true
+	}
+	var pending []*SellerDetail
+	for sellerID, info := range sellerMap {
+		if done[sellerID] {
+			continue
+		}
+		pending = append(pending, &SellerDetail{
+			SellerID:   sellerID,
+			SellerName: info.SellerName,
+			Keyword:    info.Keyword,
+		})
+	}
 
+	log.Infof("------------------------")
+	log.Infof("任务被中断，保存进度 ID:%d 关键词:%s", task.ID, task.Keyword)
+	if err := saveCrawlResult(task, TASK_STATUS_PENDING, "", products, details, pending); err != nil {
+		log.Errorf("保存中断任务进度失败 ID:%d 关键词:%s %v", task.ID, task.Keyword, err)
+		return
+	}
+	log.Infof("任务已重置为待执行 ID:%d 待获取详情的卖家=%d", task.ID, len(pending))
+}
+
+// saveCrawlResult 在一个事务中保存商品和卖家，并将任务状态更新为 taskStatus、释放租约，message 写入 error_message
+// pendingSellers 只写入 amc_seller，不同步到 tb_amazon_shop
+// 任务租约已被其他消费者接管时整个事务回滚，避免重复写入
+func saveCrawlResult(task CrawlTask, taskStatus int, message string, products []*ProductInfo, sellerDetails []*SellerDetail, pendingSellers []*SellerDetail) error {
 	tx, err := app.db.Begin()
 	if err != nil {
 		return fmt.Errorf("开始事务失败: %w", err)
@@ -1105,30 +1096,35 @@ func batchSaveAll(keyword string, categoryID int64, products []*ProductInfo, sel
 	defer tx.Rollback()
 
 	// 1. 批量插入商品
-	productCount, err := batchInsertProducts(tx, products)
+	productCount, err := batchInsertProducts(tx, task.domain(), products)
 	if err != nil {
 		return fmt.Errorf("批量插入商品失败: %w", err)
 	}
 	log.Infof("商品插入完成: %d 条", productCount)
 
 	// 2. 批量插入/更新卖家
-	sellerCount, err := batchUpsertSellers(tx, sellerDetails)
+	sellerCount, err := batchUpsertSellers(tx, task.domain(), sellerDetails)
 	if err != nil {
 		return fmt.Errorf("批量插入卖家失败: %w", err)
 	}
 	log.Infof("卖家更新完成: %d 条", sellerCount)
+	if len(pendingSellers) > 0 {
+		pendingCount, err := batchInsertPendingSellers(tx, task.domain(), pendingSellers)
+		if err != nil {
+			return fmt.Errorf("保存待处理卖家失败: %w", err)
+		}
+		log.Infof("待处理卖家插入完成: %d 条", pendingCount)
+	}
 
 	// 3. 批量同步到 tb_amazon_shop
-	shopCount, err := batchSyncToAmazonShop(tx, sellerDetails)
+	shopCount, err := batchSyncToAmazonShop(tx, task.domain(), sellerDetails)
 	if err != nil {
 		return fmt.Errorf("批量同步到 tb_amazon_shop 失败: %w", err)
 	}
 	log.Infof("tb_amazon_shop 同步完成: %d 条", shopCount)
 
 	// 4. 更新任务状态
-	_, err = tx.Exec("UPDATE amc_category SET task_status = ?, updated_at = NOW() WHERE id = ?",
-		TASK_STATUS_COMPLETED, categoryID)
-	if err != nil {
+	if err := finishTask(tx, task, taskStatus, message); err != nil {
 		return fmt.Errorf("更新任务状态失败: %w", err)
 	}
 
@@ -1142,20 +1138,20 @@ func batchSaveAll(keyword string, categoryID int64, products []*ProductInfo, sel
 	return nil
 }
 
-// batchInsertProducts 批量插入商品
-func batchInsertProducts(tx *sql.Tx, products []*ProductInfo) (int, error) {
+// batchInsertProducts 批量插入商品，domain 为商品所属站点
+func batchInsertProducts(tx *sql.Tx, domain string, products []*ProductInfo) (int, error) {
 	if len(products) == 0 {
 		return 0, nil
 	}
 
 	// 构建批量插入 SQL
-	sql := `INSERT IGNORE INTO amc_product (url, param, title, asin, keyword, bought_count, price, rating, review_count, status, app) VALUES `
+	sql := `INSERT IGNORE INTO amc_product (url, param, title, asin, keyword, domain, bought_count, price, rating, review_count, status, app) VALUES `
 	values := make([]string, 0, len(products))
-	args := make([]interface{}, 0, len(products)*11)
+	args := make([]interface{}, 0, len(products)*12)
 
 	for _, p := range products {
-		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
-		args = append(args, p.URL, p.Param, p.Title, p.ASIN, p.Keyword,
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, p.URL, p.Param, p.Title, p.ASIN, p.Keyword, domain,
 			p.BoughtCount, p.Price, p.Rating, p.ReviewCount,
 			MYSQL_PRODUCT_STATUS_OVER, app.Basic.App_id)
 	}
@@ -1171,8 +1167,8 @@ func batchInsertProducts(tx *sql.Tx, products []*ProductInfo) (int, error) {
 	return int(rowsAffected), nil
 }
 
-// batchUpsertSellers 批量插入或更新卖家
-func batchUpsertSellers(tx *sql.Tx, details []*SellerDetail) (int, error) {
+// batchUpsertSellers 批量插入或更新卖家，domain 为卖家所属站点
+func batchUpsertSellers(tx *sql.Tx, domain string, details []*SellerDetail) (int, error) {
 	if len(details) == 0 {
 		return 0, nil
 	}
@@ -1181,26 +1177,26 @@ func batchUpsertSellers(tx *sql.Tx, details []*SellerDetail) (int, error) {
 	for _, d := range details {
 		// 先尝试插入
 		_, err := tx.Exec(
-			`INSERT INTO amc_seller (seller_id, seller_name, keyword, name, address, trn, trn_status, all_status, app_id, fb_1month, fb_3month, fb_12month, fb_lifetime)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			d.SellerID, d.SellerName, d.Keyword, d.Name, d.Address, d.TRN, d.TRNStatus, d.AllStatus, app.Basic.App_id,
+			`INSERT INTO amc_seller (seller_id, seller_name, keyword, domain, name, address, trn, trn_status, all_status, app_id, fb_1month, fb_3month, fb_12month, fb_lifetime)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.SellerID, d.SellerName, d.Keyword, domain, d.Name, d.Address, d.TRN, d.TRNStatus, d.AllStatus, app.Basic.App_id,
 			d.FB1Month, d.FB3Month, d.FB12Month, d.FBLifetime,
 		)
 
-		if err != nil && !is_duplicate_entry(err) {
+		if is_duplicate_entry(err) {
 			// 如果是重复错误，尝试更新
 			_, err = tx.Exec(
 				`UPDATE amc_seller SET
 					seller_name = ?, name = ?, address = ?, trn = ?, trn_status = ?, all_status = ?,
 					app_id = ?, fb_1month = ?, fb_3month = ?, fb_12month = ?, fb_lifetime = ?
-				WHERE seller_id = ?`,
+				WHERE seller_id = ? AND domain = ?`,
 				d.SellerName, d.Name, d.Address, d.TRN, d.TRNStatus, d.AllStatus, app.Basic.App_id,
 				d.FB1Month, d.FB3Month, d.FB12Month, d.FBLifetime,
-				d.SellerID,
+				d.SellerID, domain,
 			)
-			if err != nil {
-				return 0, err
-			}
+		}
+		if err != nil {
+			return 0, err
 		}
 		count++
 	}
@@ -1208,15 +1204,32 @@ func batchUpsertSellers(tx *sql.Tx, details []*SellerDetail) (int, error) {
 	return count, nil
 }
 
-// batchSyncToAmazonShop 批量同步到 tb_amazon_shop
-func batchSyncToAmazonShop(tx *sql.Tx, details []*SellerDetail) (int, error) {
+// batchInsertPendingSellers 以未认领的待处理状态插入尚未获取详情的卖家，已存在的卖家保持不变，domain 为卖家所属站点
+func batchInsertPendingSellers(tx *sql.Tx, domain string, sellers []*SellerDetail) (int, error) {
+	count := 0
+	for _, d := range sellers {
+		result, err := tx.Exec(
+			`INSERT IGNORE INTO amc_seller (seller_id, seller_name, keyword, domain, all_status, app_id) VALUES (?, ?, ?, ?, ?, 0)`,
+			d.SellerID, d.SellerName, d.Keyword, domain, MYSQL_SELLER_STATUS_INFO_INSERT,
+		)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		count += int(n)
+	}
+	return count, nil
+}
+
+// batchSyncToAmazonShop 批量同步到 tb_amazon_shop，marketplace 为站点代码
+func batchSyncToAmazonShop(tx *sql.Tx, domain string, details []*SellerDetail) (int, error) {
 	if len(details) == 0 {
 		return 0, nil
 	}
 
 	count := 0
 	for _, d := range details {
-		shopURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", app.Domain, d.SellerID)
+		shopURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", domain, d.SellerID)
 		brandName := strings.ToLower(d.Keyword)
 
 		// 检查是否存在
@@ -1231,7 +1244,7 @@ func batchSyncToAmazonShop(tx *sql.Tx, details []*SellerDetail) (int, error) {
 					 company_name, company_address, fb_1month, fb_3month, fb_12month, fb_lifetime,
 					 main_products, avg_price, estimated_monthly_sales, crawl_time, create_time, update_time)
 				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', 0, 0, NOW(), NOW(), NOW())
-			`, 1, brandName, d.SellerID, d.SellerName, shopURL, "US",
+			`, 1, brandName, d.SellerID, d.SellerName, shopURL, marketplaceFromDomain(domain),
 				d.Name, d.Address, d.FB1Month, d.FB3Month, d.FB12Month, d.FBLifetime)
 			if err != nil {
 				return 0, err
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q accepted", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	const layout = "2006-01-02 15:04"
+	// 2026-10-18 是周日
+	from := time.Date(2026, 10, 18, 10, 30, 20, 0, time.Local)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2026-10-18 10:31"},
+		{"*/15 * * * *", "2026-10-18 10:45"},
+		{"30 10 * * *", "2026-10-19 10:30"},
+		{"0 3 * * *", "2026-10-19 03:00"},
+		{"@hourly", "2026-10-18 11:00"},
+		{"@daily", "2026-10-19 00:00"},
+		{"@weekly", "2026-10-25 00:00"},
+		{"@monthly", "2026-11-01 00:00"},
+		{"@yearly", "2027-01-01 00:00"},
+		{"0 9 * * MON-FRI", "2026-10-19 09:00"},
+		{"0 9 * * 7", "2026-10-25 09:00"},
+		{"0 0 1,15 * *", "2026-11-01 00:00"},
+		{"0 0 31 * *", "2026-10-31 00:00"},
+		{"0 0 31 NOV,dec *", "2026-12-31 00:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		// 日和周都指定时满足其一即可
+		{"0 0 1 * FRI", "2026-10-23 00:00"},
+		{"5-10/5 8 * * *", "2026-10-19 08:05"},
+	}
+	for _, c := range cases {
+		s, err := parseCron(c.expr)
+		if err != nil {
+			t.Errorf("%q: %v", c.expr, err)
+			continue
+		}
+		assertEqual(t, c.expr, s.Next(from).Format(layout), c.want)
+	}
+
+	s, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(from); !next.IsZero() {
+		t.Errorf("Feb 30 next = %v", next)
+	}
+}
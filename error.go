@@ -19,3 +19,9 @@ var ERROR_NOT_SELLER_URL error = fmt.Errorf("不存在商家链接")
 var ERROR_NOT_503 error = fmt.Errorf("连接失败,503")
 var ERROR_NOT_404 error = fmt.Errorf("连接失败,404")
 var ERROR_VERIFICATION error = fmt.Errorf("连接失败,需要验证")
+var ERROR_ROBOTS_DISALLOW error = fmt.Errorf("robots.txt 不允许访问")
+var ERROR_SIGN_IN error = fmt.Errorf("连接失败,需要登录")
+var ERROR_EMPTY_RESULTS error = fmt.Errorf("搜索无结果")
+var ERROR_REGION_BLOCKED error = fmt.Errorf("连接失败,地区限制")
+var ERROR_UNEXPECTED_LAYOUT error = fmt.Errorf("错误的页面结构")
+var ERROR_TASK_LEASE_LOST error = fmt.Errorf("任务租约已失效")
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/brotli"
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 抓取模式，用于日志和统计
+const (
+	FETCH_MODE_SEARCH  = "search"
+	FETCH_MODE_PRODUCT = "product"
+	FETCH_MODE_SELLER  = "seller"
+	FETCH_MODE_BRAND   = "brand"
+	FETCH_MODE_LINK    = "link"
+	FETCH_MODE_ASIN    = "asin"
+	FETCH_MODE_OFFER   = "offer"
+	FETCH_MODE_ROBOTS  = "robots"
+)
+
+// Fetcher 统一的页面抓取接口
+// 所有爬取模式共用同一套 robots 检查、Cookie、请求头、重试和错误处理
+type Fetcher interface {
+	Fetch(ctx context.Context, req *FetchRequest) (*PageResult, error)
+}
+
+// FetchRequest 单次抓取请求
+type FetchRequest struct {
+	URL        string
+	Mode       string // 调用模式，见 FETCH_MODE_*
+	Referer    string // 为空时随机生成
+	Plain      bool   // 纯文本请求（如 robots.txt），不解析 HTML、不检测验证页
+	SkipRobots bool   // 跳过 robots.txt 检查
+	NoCookie   bool   // 不携带 Cookie
+}
+
+// PageResult 抓取结果
+type PageResult struct {
+	URL        string
+	Domain     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Doc        *goquery.Document // Plain 请求时为空
+	Class      PageClass         // 页面分类
+}
+
+// HTTPFetcher 基于 net/http 的 Fetcher 实现
+type HTTPFetcher struct {
+	transport  http.RoundTripper // 为空时按会话绑定的代理从 transports 中复用传输层
+	timeout    time.Duration
+	maxRetries int // 网络错误的重试次数
+}
+
+// 全局抓取器，测试时可替换为指向 httptest 服务的实例
+var fetcher Fetcher = NewHTTPFetcher(nil)
+
+// NewHTTPFetcher 创建抓取器，transport 为空时按配置（代理）创建客户端
+func NewHTTPFetcher(transport http.RoundTripper) *HTTPFetcher {
+	return &HTTPFetcher{
+		transport:  transport,
+		timeout:    time.Second * 60,
+		maxRetries: 2,
+	}
+}
+
+// client 返回请求使用的客户端，proxyAddr 为会话绑定的代理
+func (f *HTTPFetcher) client(proxyAddr string) *http.Client {
+	if f.transport != nil {
+		return &http.Client{Transport: f.transport, Timeout: f.timeout}
+	}
+	c := transports.Client(proxyAddr)
+	return &c
+}
+
+// Fetch 发送请求并返回结果
+// 状态码与验证页统一映射为 error.go 中的 ERROR_* 错误，result 在收到响应时总是非空
+func (f *HTTPFetcher) Fetch(ctx context.Context, fr *FetchRequest) (*PageResult, error) {
+	u, err := url.Parse(fr.URL)
+	if err != nil {
+		return nil, err
+	}
+	domain := normalizeDomain(u.Host)
+
+	// amc_cookie 中的会话属于配置文件的 domain，其他站点的请求不携带，也不合并其 Set-Cookie
+	useCookie := !fr.NoCookie && cookieDomainMatches(domain)
+	sess := app.beginSession(useCookie)
+	if !useCookie {
+		sess.cookie, sess.cookieID = "", 0
+	}
+
+	if !fr.SkipRobots {
+		robots, err := robotsForDomain(ctx, domain)
+		if err != nil {
+			return nil, err
+		}
+		if err := robots.IsAllow(sess.profile.UserAgent, fr.URL); err != nil {
+			return nil, fmt.Errorf("%w: %v", ERROR_ROBOTS_DISALLOW, err)
+		}
+	}
+
+	key := limiterKey(domain, sess.cookieID)
+	var resp *http.Response
+	var labels []string // 指标标签：站点、模式、cookie、代理
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx, key); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fr.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		f.setHeaders(req, fr, domain, sess)
+
+		client := f.client(sess.proxyAddr)
+		labels = []string{marketplaceFromDomain(domain), fr.Mode, metricCookieLabel(sess.cookieID), metricProxyLabel(sess.proxyAddr)}
+		metricFetchRequests.Inc(labels...)
+		started := time.Now()
+		resp, err = client.Do(req)
+		if err != nil && ctx.Err() != nil {
+			// 主动取消（如程序退出）不计入代理和限速器的失败
+			return nil, ctx.Err()
+		}
+		f.recordProxyOutcome(resp, err, time.Since(started), sess.proxyAddr)
+		recordFetchMetrics(labels, resp, err, time.Since(started))
+		if err == nil {
+			break
+		}
+		if f.transport == nil && app.Proxy.Enable {
+			var switched bool
+			if sess.proxyAddr, switched = app.failoverSession(sess.proxyAddr, err); switched {
+				log.Infof("已切换代理，重试请求")
+			}
+		}
+		if attempt >= f.maxRetries {
+			log.Errorf("内部错误:%v", err)
+			limiter.Penalize(key, RATE_PENALTY_ERROR)
+			instance.recordFetch(err)
+			return nil, err
+		}
+		log.Warnf("请求失败，%d秒后重试(%d/%d): %v", attempt+1, attempt+1, f.maxRetries, err)
+		backoff := time.Duration(attempt+1) * time.Second
+		metricDelay.Observe(backoff.Seconds(), labels[0], DELAY_SCENARIO_RETRY)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	result, err := f.readResult(resp, fr, domain, labels)
+	instance.recordFetch(err)
+	if useCookie {
+		app.endSession(sess, resp, err == ERROR_NOT_503 || isCookieRejected(err))
+		app.recordCookieOutcome(sess.cookieID, isCookieRequestSuccess(err))
+	}
+	switch {
+	case err == ERROR_NOT_503:
+		limiter.Penalize(key, RATE_PENALTY_503)
+	case isCookieRejected(err):
+		limiter.Penalize(key, RATE_PENALTY_CAPTCHA)
+	case isCookieRequestSuccess(err):
+		limiter.Success(key)
+	}
+	return result, err
+}
+
+// cookieDomainMatches 请求的站点是否为 cookie 所属的站点（配置文件的 domain），忽略 www. 前缀
+func cookieDomainMatches(domain string) bool {
+	own := strings.TrimPrefix(normalizeDomain(app.Domain), "www.")
+	return own != "" && strings.TrimPrefix(normalizeDomain(domain), "www.") == own
+}
+
+// recordFetchMetrics 记录一次请求的状态码和耗时
+func recordFetchMetrics(labels []string, resp *http.Response, err error, latency time.Duration) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	metricFetchResponses.Inc(append(labels[:len(labels):len(labels)], status)...)
+	metricFetchDuration.Observe(latency.Seconds(), labels...)
+}
+
+// recordProxyOutcome 记录代理 addr 的请求结果，503 或网络错误计为失败
+// 代理因此被熔断时立即改绑，后续请求使用新的代理
+func (f *HTTPFetcher) recordProxyOutcome(resp *http.Response, err error, latency time.Duration, addr string) {
+	if f.transport != nil || !app.Proxy.Enable || addr == "" {
+		return
+	}
+	switch {
+	case err != nil:
+		proxyPool.RecordFailure(addr, false)
+		return
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		proxyPool.RecordFailure(addr, true)
+	default:
+		proxyPool.RecordSuccess(addr, latency)
+		return
+	}
+	if !proxyPool.Available(addr) {
+		app.failoverSession(addr, ERROR_NOT_503)
+	}
+}
+
+// readResult 读取并分类响应，labels 为记录页面分类指标的标签
+func (f *HTTPFetcher) readResult(resp *http.Response, fr *FetchRequest, domain string, labels []string) (*PageResult, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	// 手动设置了 Accept-Encoding，net/http 不会自动解压，需要自行解码
+	body, err = decodeBody(resp.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		return nil, fmt.Errorf("解压响应失败: %w", err)
+	}
+	result := &PageResult{
+		URL:        fr.URL,
+		Domain:     domain,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound, http.StatusServiceUnavailable:
+	default:
+		return result, fmt.Errorf("状态码:%d", resp.StatusCode)
+	}
+	if fr.Plain {
+		result.Class = classifyPage(resp.StatusCode, nil, fr.Mode)
+		metricPageClasses.Inc(append(labels[:len(labels):len(labels)], result.Class.String())...)
+		return result, result.Class.Err()
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return result, fmt.Errorf("内部错误:%v", err)
+	}
+	result.Doc = doc
+	result.Class = classifyPage(resp.StatusCode, doc, fr.Mode)
+	metricPageClasses.Inc(append(labels[:len(labels):len(labels)], result.Class.String())...)
+
+	switch result.Class {
+	case PAGE_CLASS_OK:
+		return result, nil
+	case PAGE_CLASS_CAPTCHA, PAGE_CLASS_SIGN_IN:
+		log.Warnf("检测到%s页面，Cookie 可能已失效 url:%s", result.Class, fr.URL)
+	case PAGE_CLASS_EMPTY_RESULTS, PAGE_CLASS_DOG_404, PAGE_CLASS_THROTTLED:
+	default:
+		log.Warnf("页面分类:%s url:%s", result.Class, fr.URL)
+	}
+	return result, result.Class.Err()
+}
+
+// setHeaders 设置统一的请求头（会话绑定的浏览器指纹、Referer、Cookie）
+func (f *HTTPFetcher) setHeaders(req *http.Request, fr *FetchRequest, domain string, sess requestSession) {
+	setBrowserHeaders(req, sess.profile, sess.cookie)
+	if sess.cookie == "" {
+		req.Header.Del("Cookie")
+	}
+	referer := fr.Referer
+	if referer == "" && !fr.Plain {
+		referer = GetRandomReferer(domain)
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+}
+
+// decodeBody 按 Content-Encoding 解码响应内容，支持 gzip、deflate、br 及其组合
+func decodeBody(contentEncoding string, body []byte) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	// 多重编码按应用顺序列出，解码时倒序处理
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		var r io.Reader
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			defer gr.Close()
+			r = gr
+		case "deflate":
+			// 标准为 zlib 封装，部分服务器直接返回原始 deflate 数据
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				r = flate.NewReader(bytes.NewReader(body))
+			} else {
+				defer zr.Close()
+				r = zr
+			}
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("不支持的编码:%s", encoding)
+		}
+		decoded, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+// robots.txt 按域名缓存，超过 TTL 后重新加载
+// robotsMu 只保护 robotsCache 本身，加载 robots.txt 时只占用该域名的条目
+var (
+	robotsMu    sync.Mutex
+	robotsCache = map[string]*robotsEntry{}
+	robotsTTL   = 24 * time.Hour
+)
+
+// robotsEntry 一个域名的 robots 规则，robots 和 fetchedAt 只在持有 load 时读写
+type robotsEntry struct {
+	load      chan struct{} // 容量为 1，同一域名同时只有一个请求加载，其余等待后使用其结果
+	robots    *Robots       // 为 nil 表示尚未加载成功
+	fetchedAt time.Time
+}
+
+// robotsEntryFor 获取域名的缓存条目，不存在时创建
+func robotsEntryFor(domain string) *robotsEntry {
+	robotsMu.Lock()
+	defer robotsMu.Unlock()
+	e, ok := robotsCache[domain]
+	if !ok {
+		e = &robotsEntry{load: make(chan struct{}, 1)}
+		robotsCache[domain] = e
+	}
+	return e
+}
+
+// robotsForDomain 获取指定域名的 robots 规则，首次访问或缓存过期时通过 fetcher 加载
+// robots.txt 返回 4xx 时视为没有限制；加载失败时沿用过期的缓存
+func robotsForDomain(ctx context.Context, domain string) (*Robots, error) {
+	domain = normalizeDomain(domain)
+	e := robotsEntryFor(domain)
+	select {
+	case e.load <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-e.load }()
+
+	if e.robots != nil && time.Since(e.fetchedAt) < robotsTTL {
+		return e.robots, nil
+	}
+
+	robotTxt := fmt.Sprintf("https://%s/robots.txt", domain)
+	log.Infof("加载文件: %s", robotTxt)
+	page, err := fetcher.Fetch(ctx, &FetchRequest{
+		URL:        robotTxt,
+		Mode:       FETCH_MODE_ROBOTS,
+		Plain:      true,
+		SkipRobots: true,
+		NoCookie:   true,
+	})
+	var r Robots
+	switch {
+	case err == nil:
+		r = GetRobotFromTxt(string(page.Body))
+	case page != nil && page.StatusCode >= 400 && page.StatusCode < 500:
+		log.Warnf("robots.txt 不存在(状态码:%d)，不限制爬取: %s", page.StatusCode, domain)
+	case e.robots != nil:
+		log.Warnf("加载 robots.txt 失败，继续使用缓存: %v", err)
+		e.fetchedAt = time.Now()
+		return e.robots, nil
+	default:
+		return nil, fmt.Errorf("加载 robots.txt 失败: %w", err)
+	}
+
+	e.robots, e.fetchedAt = &r, time.Now()
+	if delay, ok := r.CrawlDelay(robotsUserAgent()); ok {
+		log.Infof("robots.txt Crawl-delay: %s (%s)", delay, domain)
+		limiter.SetMinInterval(domain, delay)
+	}
+	return &r, nil
+}
+
+// robotsUserAgent 匹配 robots.txt 分组时使用的 User-Agent
+func robotsUserAgent() string {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if app.browserProfile != nil {
+		return app.browserProfile.UserAgent
+	}
+	return userAgent
+}
+
+// isRobotsDisallow 判断错误是否为 robots.txt 限制
+func isRobotsDisallow(err error) bool {
+	return errors.Is(err, ERROR_ROBOTS_DISALLOW)
+}
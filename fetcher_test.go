@@ -0,0 +1,241 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// newTestFetcher 启动一个模拟亚马逊的 TLS 服务，并将全局 fetcher 指向它
+func newTestFetcher(t *testing.T, robotsTxt string, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, robotsTxt)
+	})
+	mux.HandleFunc("/", handler)
+	srv := httptest.NewTLSServer(mux)
+
+	oldFetcher, oldCookie, oldProfile, oldDomain := fetcher, app.cookie, app.browserProfile, app.Domain
+	fetcher = NewHTTPFetcher(srv.Client().Transport)
+	app.cookie = "session-id=123"
+	app.browserProfile = getBrowserProfileByID("chrome-120-win")
+	u, _ := url.Parse(srv.URL)
+	app.Domain = u.Host
+	resetRobotsCache()
+
+	t.Cleanup(func() {
+		srv.Close()
+		fetcher, app.cookie, app.browserProfile, app.Domain = oldFetcher, oldCookie, oldProfile, oldDomain
+		resetRobotsCache()
+	})
+	return srv
+}
+
+func resetRobotsCache() {
+	robotsMu.Lock()
+	robotsCache = map[string]*robotsEntry{}
+	robotsMu.Unlock()
+}
+
+func TestFetchSetsHeadersAndParsesDocument(t *testing.T) {
+	var gotUA, gotCookie, gotReferer string
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		gotCookie = r.Header.Get("Cookie")
+		gotReferer = r.Header.Get("Referer")
+		fmt.Fprint(w, `<html><head><title>Product</title></head><body><span id="productTitle">Widget</span></body></html>`)
+	})
+
+	referer := srv.URL + "/s?k=widget"
+	page, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/dp/B0FNMPQSJC", Mode: FETCH_MODE_PRODUCT, Referer: referer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "title", page.Doc.Find("#productTitle").Text(), "Widget")
+	assertEqual(t, "user agent", gotUA, app.browserProfile.UserAgent)
+	assertEqual(t, "cookie", gotCookie, "session-id=123")
+	assertEqual(t, "referer", gotReferer, referer)
+}
+
+func TestFetchMapsStatusAndVerificationErrors(t *testing.T) {
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/captcha":
+			fmt.Fprint(w, `<html><head><title>Amazon.com</title></head><body><form action="/errors/validateCaptcha/captcha/"></form></body></html>`)
+		}
+	})
+
+	cases := map[string]error{
+		"/missing": ERROR_NOT_404,
+		"/busy":    ERROR_NOT_503,
+		"/captcha": ERROR_VERIFICATION,
+	}
+	for path, want := range cases {
+		_, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + path, Mode: FETCH_MODE_SEARCH})
+		if err != want {
+			t.Fatalf("%s: err = %v, want %v", path, err, want)
+		}
+	}
+}
+
+func TestFetchHonorsRobots(t *testing.T) {
+	hits := 0
+	srv := newTestFetcher(t, "User-agent: *\nDisallow: /gp/\n", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprint(w, "<html></html>")
+	})
+
+	_, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/gp/cart", Mode: FETCH_MODE_PRODUCT})
+	if !isRobotsDisallow(err) {
+		t.Fatalf("err = %v, want robots disallow", err)
+	}
+	if hits != 0 {
+		t.Fatalf("disallowed url was requested %d times", hits)
+	}
+}
+
+func TestFetchSellerInfoFromProductUsesFetcher(t *testing.T) {
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/pages/product_ok.html")
+	})
+
+	sellerID, sellerName, brandName, err := fetchSellerInfoFromProduct(context.Background(), srv.URL+"/dp/B0DKF7HNZX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "seller id", sellerID, "A1B2C3D4E5")
+	assertEqual(t, "seller name", sellerName, "Lightdot Direct")
+	assertEqual(t, "brand", brandName, "lightdot")
+}
+
+func TestFetchReturnsContextErrorWhenCanceled(t *testing.T) {
+	started := make(chan struct{})
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := fetcher.Fetch(ctx, &FetchRequest{URL: srv.URL + "/dp/B0DKF7HNZX", Mode: FETCH_MODE_PRODUCT})
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestCrawlProductsFromMemoryStopsWhenCanceled(t *testing.T) {
+	var hits int
+	newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.ServeFile(w, r, "testdata/pages/product_ok.html")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	products := []*ProductInfo{{URL: "/dp/B0DKF7HNZX", ASIN: "B0DKF7HNZX"}}
+	sellers, err := crawlProductsFromMemory(ctx, "www.amazon.com", products, "lightdot")
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if len(sellers) != 0 || hits != 0 {
+		t.Fatalf("sellers = %d, hits = %d", len(sellers), hits)
+	}
+}
+
+func TestSearchProductsPagesAndLimit(t *testing.T) {
+	var pages []string
+	newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("page"))
+		http.ServeFile(w, r, "testdata/pages/search_ok.html")
+	})
+
+	// 默认只搜索第 1 页
+	products, err := searchProducts(context.Background(), CrawlTask{Keyword: "speakers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || strings.Join(pages, ",") != "1" {
+		t.Fatalf("products = %d, pages = %v", len(products), pages)
+	}
+
+	// 第 2 页没有新商品时停止
+	pages = nil
+	products, _ = searchProducts(context.Background(), CrawlTask{Keyword: "speakers", MaxPages: 5})
+	if len(products) != 2 || strings.Join(pages, ",") != "1,2" {
+		t.Fatalf("products = %d, pages = %v", len(products), pages)
+	}
+
+	pages = nil
+	products, _ = searchProducts(context.Background(), CrawlTask{Keyword: "speakers", MaxPages: 5, MaxASINs: 1})
+	if len(products) != 1 || strings.Join(pages, ",") != "1" {
+		t.Fatalf("products = %d, pages = %v", len(products), pages)
+	}
+}
+
+func TestFetchDecodesCompressedBody(t *testing.T) {
+	page, err := os.ReadFile("testdata/pages/product_ok.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	var gotAcceptEncoding string
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+		encoding := strings.TrimPrefix(r.URL.Path, "/enc/")
+		if encoding == "deflate-raw" {
+			w.Header().Set("Content-Encoding", "deflate")
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			fw.Write(page)
+			fw.Close()
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		ew := encoders[encoding](w)
+		ew.Write(page)
+		ew.Close()
+	})
+
+	for _, encoding := range []string{"gzip", "deflate", "deflate-raw", "br"} {
+		result, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/enc/" + encoding, Mode: FETCH_MODE_PRODUCT})
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		assertEqual(t, encoding+" title", result.Doc.Find("#productTitle").Text(), "Lightdot 2 Pack 150W Wall Pack LED Exterior Light")
+	}
+	assertEqual(t, "accept-encoding", gotAcceptEncoding, app.browserProfile.AcceptEncoding)
+}
+
+func TestDecodeBodyRejectsUnknownEncoding(t *testing.T) {
+	if _, err := decodeBody("compress", []byte("x")); err == nil {
+		t.Fatal("expected unsupported encoding error")
+	}
+	body, err := decodeBody("identity", []byte("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "identity", string(body), "plain")
+}
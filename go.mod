@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/andybalholm/brotli v1.1.0
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/tengfei-xy/go-log v0.1.2
 	golang.org/x/net v0.7.0
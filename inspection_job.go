@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 巡检任务状态
+const (
+	INSPECTION_JOB_PENDING   = 0 // 排队中
+	INSPECTION_JOB_RUNNING   = 1 // 执行中
+	INSPECTION_JOB_COMPLETED = 2 // 已完成
+)
+
+// 巡检条目状态
+const (
+	INSPECTION_ITEM_PENDING = 0 // 待巡检
+	INSPECTION_ITEM_SUCCESS = 1 // 成功
+	INSPECTION_ITEM_FAILED  = 2 // 失败
+)
+
+// ASIN_INSPECTION_JOB_MAX_ITEMS 异步巡检任务单次最多提交的条数
+const ASIN_INSPECTION_JOB_MAX_ITEMS = 500
+
+// InspectionJobConfig 异步巡检任务消费者配置
+type InspectionJobConfig struct {
+	Workers       int `yaml:"workers"`       // 并发执行的巡检任务数，默认 1
+	Lease_seconds int `yaml:"lease_seconds"` // 认领租约时长（秒），执行期间每 1/3 租约续期一次，默认 300
+}
+
+// withDefaults 填充未配置的字段
+func (c InspectionJobConfig) withDefaults() InspectionJobConfig {
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+	if c.Lease_seconds <= 0 {
+		c.Lease_seconds = 300
+	}
+	return c
+}
+
+// 巡检任务通知 channel，提交任务后唤醒消费者
+var inspectionJobNotify = make(chan struct{}, 1)
+
+// notifyInspectionJobWorkers 唤醒一个空闲的巡检消费者
+func notifyInspectionJobWorkers() {
+	select {
+	case inspectionJobNotify <- struct{}{}:
+	default:
+	}
+}
+
+// InspectionJob 异步巡检任务
+type InspectionJob struct {
+	ID         int64                        `json:"id"`
+	JobID      string                       `json:"job_id,omitempty"` // 调用方传入的业务 ID
+	Domain     string                       `json:"domain"`
+	Status     string                       `json:"status"` // pending / running / completed
+	Total      int                          `json:"total"`
+	Done       int                          `json:"done"` // 已完成（含失败）的条数
+	Failed     int                          `json:"failed"`
+	CreatedAt  string                       `json:"created_at,omitempty"`
+	StartedAt  string                       `json:"started_at,omitempty"`
+	FinishedAt string                       `json:"finished_at,omitempty"`
+	Items      []ASINInspectionResponseItem `json:"items,omitempty"`
+
+	status      int
+	options     ASINInspectionOptions
+	callbackURL string
+}
+
+// inspectionJobStatusName 巡检任务状态名
+func inspectionJobStatusName(status int) string {
+	switch status {
+	case INSPECTION_JOB_RUNNING:
+		return "running"
+	case INSPECTION_JOB_COMPLETED:
+		return "completed"
+	default:
+		return "pending"
+	}
+}
+
+// storedInspectionItem amc_inspection_item 中的一条记录
+type storedInspectionItem struct {
+	ID         int64
+	Seq        int
+	Item       LinkInspectionItem
+	Status     int
+	Result     LinkInspectionResult // Status 为待巡检时为空
+	CapturedAt string
+}
+
+// apiItem 转换为接口返回的条目，未巡检的条目状态为 pending
+func (s storedInspectionItem) apiItem() ASINInspectionResponseItem {
+	if s.Status == INSPECTION_ITEM_PENDING {
+		return ASINInspectionResponseItem{
+			Input:        s.Item.Original,
+			URL:          s.Item.URL,
+			Domain:       s.Item.Domain,
+			OriginalASIN: s.Item.ASIN,
+			Status:       "pending",
+		}
+	}
+	result := s.Result
+	result.Item = s.Item
+	return linkInspectionResultToAPIItem(result, s.CapturedAt)
+}
+
+// createInspectionJob 保存巡检任务和全部条目，返回任务 ID
+func createInspectionJob(ctx context.Context, req ASINInspectionRequest, domain string, items []LinkInspectionItem) (int64, error) {
+	options, _ := json.Marshal(req.Options)
+
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	r, err := tx.ExecContext(ctx,
+		"INSERT INTO amc_inspection_job (external_id, domain, options, status, total, callback_url) VALUES (?, ?, ?, ?, ?, ?)",
+		req.JobID, domain, string(options), INSPECTION_JOB_PENDING, len(items), nullableString(req.CallbackURL))
+	if err != nil {
+		return 0, err
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO amc_inspection_item (job_id, seq, input, url, asin, domain, status) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for i, item := range items {
+		if _, err := stmt.ExecContext(ctx, id, i, item.Original, item.URL, item.ASIN, item.Domain, INSPECTION_ITEM_PENDING); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// loadInspectionJob 读取巡检任务及其条目（按提交顺序），withResults 为假时不解析已保存的结果
+func loadInspectionJob(ctx context.Context, id int64, withResults bool) (*InspectionJob, []storedInspectionItem, error) {
+	job := &InspectionJob{ID: id}
+	var options string
+	err := app.db.QueryRowContext(ctx,
+		`SELECT COALESCE(external_id, ''), domain, COALESCE(options, ''), status, total,
+		created_at, COALESCE(started_at, ''), COALESCE(finished_at, ''), COALESCE(callback_url, '')
+		FROM amc_inspection_job WHERE id = ?`, id,
+	).Scan(&job.JobID, &job.Domain, &options, &job.status, &job.Total, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.callbackURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	job.Status = inspectionJobStatusName(job.status)
+	if options != "" {
+		json.Unmarshal([]byte(options), &job.options)
+	}
+
+	items, err := loadInspectionItems(ctx, id, !withResults)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, item := range items {
+		if item.Status != INSPECTION_ITEM_PENDING {
+			job.Done++
+		}
+		if item.Status == INSPECTION_ITEM_FAILED {
+			job.Failed++
+		}
+	}
+	return job, items, nil
+}
+
+// loadInspectionItems 读取任务的条目，statusOnly 为真时不解析结果
+func loadInspectionItems(ctx context.Context, jobID int64, statusOnly bool) ([]storedInspectionItem, error) {
+	rows, err := app.db.QueryContext(ctx,
+		`SELECT id, seq, input, url, asin, domain, status, COALESCE(result, ''), COALESCE(captured_at, '')
+		FROM amc_inspection_item WHERE job_id = ? ORDER BY seq`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []storedInspectionItem
+	for rows.Next() {
+		var s storedInspectionItem
+		var result string
+		if err := rows.Scan(&s.ID, &s.Seq, &s.Item.Original, &s.Item.URL, &s.Item.ASIN, &s.Item.Domain,
+			&s.Status, &result, &s.CapturedAt); err != nil {
+			return nil, err
+		}
+		if !statusOnly && result != "" {
+			if err := json.Unmarshal([]byte(result), &s.Result); err != nil {
+				s.Result.ErrorMessage = fmt.Sprintf("结果解析失败: %v", err)
+			}
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// InspectionJobWorker 异步巡检任务消费者，多台主机共用数据库时通过租约避免重复执行
+type InspectionJobWorker struct {
+	wg      sync.WaitGroup
+	workers int
+	lease   time.Duration
+}
+
+// StartInspectionJobWorker 启动巡检任务消费者，ctx 取消后当前任务停止并重新排队
+// 返回的函数等待所有消费者退出
+func StartInspectionJobWorker(ctx context.Context) (wait func()) {
+	cfg := app.Inspection_job
+	w := &InspectionJobWorker{workers: cfg.Workers, lease: seconds(cfg.Lease_seconds)}
+	log.Infof("启动 %d 个巡检任务消费者", w.workers)
+	for i := 1; i <= w.workers; i++ {
+		w.wg.Add(1)
+		go w.run(ctx, taskWorkerID(i))
+	}
+	return w.wg.Wait
+}
+
+// run 单个巡检消费者的主循环
+func (w *InspectionJobWorker) run(ctx context.Context, workerID string) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(TASK_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		w.processPendingJobs(ctx, workerID)
+		select {
+		case <-ctx.Done():
+			return
+		case <-inspectionJobNotify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processPendingJobs 依次认领并执行巡检任务，直到没有可认领的任务
+func (w *InspectionJobWorker) processPendingJobs(ctx context.Context, workerID string) {
+	for ctx.Err() == nil {
+		id, err := w.claimNextJob(ctx, workerID)
+		if err != nil {
+			if err != sql.ErrNoRows && ctx.Err() == nil {
+				log.Errorf("认领巡检任务失败: %v", err)
+			}
+			return
+		}
+		notifyInspectionJobWorkers()
+		w.runJob(ctx, id, workerID)
+	}
+}
+
+// claimNextJob 认领下一个排队中或租约已过期的巡检任务
+func (w *InspectionJobWorker) claimNextJob(ctx context.Context, workerID string) (int64, error) {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var status int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, status FROM amc_inspection_job
+		WHERE status = ? OR (status = ? AND lease_expires_at < NOW())
+		ORDER BY id ASC LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		INSPECTION_JOB_PENDING, INSPECTION_JOB_RUNNING,
+	).Scan(&id, &status)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE amc_inspection_job SET status = ?, worker_id = ?, lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND),
+		started_at = COALESCE(started_at, NOW()) WHERE id = ?`,
+		INSPECTION_JOB_RUNNING, workerID, int64(w.lease.Seconds()), id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if status == INSPECTION_JOB_RUNNING {
+		log.Warnf("回收租约已过期的巡检任务 ID:%d", id)
+	}
+	return id, nil
+}
+
+// runJob 巡检任务中尚未完成的条目，每完成一条立即保存结果
+// 执行期间在后台续期租约，租约被回收时停止执行
+func (w *InspectionJobWorker) runJob(ctx context.Context, id int64, workerID string) {
+	job, items, err := loadInspectionJob(ctx, id, false)
+	if err != nil {
+		log.Errorf("读取巡检任务失败 ID:%d: %v", id, err)
+		return
+	}
+	log.Infof("开始巡检任务 ID:%d 共 %d 条，已完成 %d 条", id, job.Total, job.Done)
+
+	inspector := NewLinkInspector("", job.Domain, "")
+	inspector.options = job.options
+	done := instance.beginTask(fmt.Sprintf("inspection_job:%d", id))
+	defer done()
+
+	// 单条巡检可能因限速惩罚和重试超过租约时长，不能只在保存结果时续期
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.keepLease(jobCtx, id, workerID, cancel)
+
+	for _, item := range items {
+		if item.Status != INSPECTION_ITEM_PENDING {
+			continue
+		}
+		result := inspector.inspectItem(jobCtx, item.Item)
+		if ctx.Err() != nil {
+			// 当前条目未完成，任务重新排队，下次继续巡检剩余条目
+			w.requeueJob(id, workerID)
+			log.Warnf("巡检任务被中断 ID:%d，已重新排队", id)
+			return
+		}
+		if jobCtx.Err() != nil {
+			log.Warnf("巡检任务租约已被回收，停止执行 ID:%d", id)
+			return
+		}
+		recordTaskResult(METRIC_TASK_INSPECTION_JOB, item.Item.Domain, result.ErrorMessage == "")
+		if err := w.saveItem(ctx, id, workerID, item.ID, result); err != nil {
+			if err == ERROR_TASK_LEASE_LOST {
+				log.Warnf("巡检任务租约已被回收，停止执行 ID:%d", id)
+			} else {
+				log.Errorf("保存巡检结果失败 ID:%d: %v", id, err)
+			}
+			return
+		}
+	}
+
+	r, err := app.db.ExecContext(ctx,
+		"UPDATE amc_inspection_job SET status = ?, worker_id = NULL, lease_expires_at = NULL, finished_at = NOW() WHERE id = ? AND worker_id = ?",
+		INSPECTION_JOB_COMPLETED, id, workerID)
+	if err != nil {
+		log.Errorf("更新巡检任务状态失败 ID:%d: %v", id, err)
+		return
+	}
+	if n, _ := r.RowsAffected(); n > 0 {
+		log.Infof("巡检任务完成 ID:%d", id)
+		if job.callbackURL != "" {
+			enqueueInspectionJobWebhook(id)
+		}
+	}
+}
+
+// enqueueInspectionJobWebhook 登记巡检任务完成的回调，重新读取任务以获得最终的统计
+func enqueueInspectionJobWebhook(id int64) {
+	job, _, err := loadInspectionJob(context.Background(), id, false)
+	if err != nil {
+		log.Errorf("读取巡检任务失败 ID:%d: %v", id, err)
+		return
+	}
+	enqueueWebhook(WEBHOOK_EVENT_INSPECTION_JOB_COMPLETED, WEBHOOK_TARGET_INSPECTION_JOB, id, job.callbackURL, InspectionJobWebhookPayload{
+		Event:      WEBHOOK_EVENT_INSPECTION_JOB_COMPLETED,
+		ID:         job.ID,
+		JobID:      job.JobID,
+		Domain:     job.Domain,
+		Status:     job.Status,
+		Total:      job.Total,
+		Done:       job.Done,
+		Failed:     job.Failed,
+		FinishedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// keepLease 每 1/3 租约时长续期一次，任务已不属于 workerID 时调用 cancel 停止执行
+func (w *InspectionJobWorker) keepLease(ctx context.Context, jobID int64, workerID string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(w.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r, err := app.db.ExecContext(ctx,
+				"UPDATE amc_inspection_job SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ? AND status = ? AND worker_id = ?",
+				int64(w.lease.Seconds()), jobID, INSPECTION_JOB_RUNNING, workerID)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorf("续期巡检任务租约失败 ID:%d: %v", jobID, err)
+				}
+				continue
+			}
+			if n, _ := r.RowsAffected(); n == 0 {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// saveItem 续期任务租约并保存一条巡检结果，租约已被其他消费者接管时返回 ERROR_TASK_LEASE_LOST
+func (w *InspectionJobWorker) saveItem(ctx context.Context, jobID int64, workerID string, itemID int64, result LinkInspectionResult) error {
+	r, err := app.db.ExecContext(ctx,
+		"UPDATE amc_inspection_job SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ? AND status = ? AND worker_id = ?",
+		int64(w.lease.Seconds()), jobID, INSPECTION_JOB_RUNNING, workerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return ERROR_TASK_LEASE_LOST
+	}
+
+	status := INSPECTION_ITEM_SUCCESS
+	if result.ErrorMessage != "" {
+		status = INSPECTION_ITEM_FAILED
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = app.db.ExecContext(ctx,
+		"UPDATE amc_inspection_item SET status = ?, result = ?, captured_at = ? WHERE id = ?",
+		status, string(data), time.Now().UTC().Format(time.RFC3339), itemID)
+	return err
+}
+
+// requeueJob 中断时将任务重置为排队中，退出时 ctx 已取消，因此不使用 context
+func (w *InspectionJobWorker) requeueJob(id int64, workerID string) {
+	_, err := app.db.Exec(
+		"UPDATE amc_inspection_job SET status = ?, worker_id = NULL, lease_expires_at = NULL WHERE id = ? AND worker_id = ?",
+		INSPECTION_JOB_PENDING, id, workerID)
+	if err != nil {
+		log.Errorf("巡检任务重新排队失败 ID:%d: %v", id, err)
+	}
+}
+
+// parseInspectionJobPath 解析 /api/asin-inspection/jobs/{id}[/xlsx]
+func parseInspectionJobPath(path string) (id int64, xlsx bool, ok bool) {
+	rest := strings.Trim(strings.TrimPrefix(path, "/api/asin-inspection/jobs/"), "/")
+	if rest == "" {
+		return 0, false, false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "xlsx") {
+		return 0, false, false
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false, false
+	}
+	return id, len(parts) == 2, true
+}
+
+// handleInspectionJobs 提交异步巡检任务
+func handleInspectionJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 POST 方法",
+		})
+		return
+	}
+
+	var req ASINInspectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{
+			Code:    -1,
+			Message: fmt.Sprintf("请求解析失败: %v", err),
+		})
+		return
+	}
+
+	items, err := buildInspectionItems(req, ASIN_INSPECTION_JOB_MAX_ITEMS)
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{
+			Code:    -1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	domain := normalizeDomain(req.Domain)
+	if domain == "" {
+		domain = normalizeDomain(app.Domain)
+	}
+	id, err := createInspectionJob(r.Context(), req, domain, items)
+	if err != nil {
+		log.Errorf("保存巡检任务失败: %v", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "保存巡检任务失败",
+		})
+		return
+	}
+	log.Infof("收到巡检任务 ID:%d 共 %d 条", id, len(items))
+	notifyInspectionJobWorkers()
+
+	writeJSON(w, http.StatusAccepted, APIResponse{
+		Code:    0,
+		Message: "任务已提交",
+		Data: InspectionJob{
+			ID:     id,
+			JobID:  req.JobID,
+			Domain: domain,
+			Status: inspectionJobStatusName(INSPECTION_JOB_PENDING),
+			Total:  len(items),
+		},
+	})
+}
+
+// handleInspectionJob 查询巡检任务进度和结果，或下载已完成任务的 xlsx
+func handleInspectionJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+	id, xlsx, ok := parseInspectionJobPath(r.URL.Path)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{
+			Code:    -1,
+			Message: "接口不存在",
+		})
+		return
+	}
+
+	job, items, err := loadInspectionJob(r.Context(), id, true)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusNotFound, APIResponse{
+			Code:    -1,
+			Message: "巡检任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		log.Errorf("查询巡检任务失败 ID:%d: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询巡检任务失败",
+		})
+		return
+	}
+
+	if xlsx {
+		if job.status != INSPECTION_JOB_COMPLETED {
+			writeJSON(w, http.StatusConflict, APIResponse{
+				Code:    -1,
+				Message: "巡检任务尚未完成",
+			})
+			return
+		}
+		results := make([]LinkInspectionResult, 0, len(items))
+		for _, item := range items {
+			result := item.Result
+			result.Item = item.Item
+			results = append(results, result)
+		}
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="asin_inspection_%d.xlsx"`, id))
+		if err := writeInspectionXLSXTo(w, inspectionRows(results)); err != nil {
+			log.Errorf("导出巡检任务 xlsx 失败 ID:%d: %v", id, err)
+		}
+		return
+	}
+
+	job.Items = make([]ASINInspectionResponseItem, 0, len(items))
+	for _, item := range items {
+		job.Items = append(job.Items, item.apiItem())
+	}
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data:    job,
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseInspectionJobPath(t *testing.T) {
+	cases := map[string]string{
+		"/api/asin-inspection/jobs/42":       "42 false true",
+		"/api/asin-inspection/jobs/42/":      "42 false true",
+		"/api/asin-inspection/jobs/42/xlsx":  "42 true true",
+		"/api/asin-inspection/jobs/":         "0 false false",
+		"/api/asin-inspection/jobs/abc":      "0 false false",
+		"/api/asin-inspection/jobs/0":        "0 false false",
+		"/api/asin-inspection/jobs/42/csv":   "0 false false",
+		"/api/asin-inspection/jobs/42/xlsx/": "42 true true",
+	}
+	for path, want := range cases {
+		id, xlsx, ok := parseInspectionJobPath(path)
+		assertEqual(t, path, fmt.Sprintf("%d %v %v", id, xlsx, ok), want)
+	}
+}
+
+func TestBuildInspectionItemsHonorsLimit(t *testing.T) {
+	req := ASINInspectionRequest{Domain: "www.amazon.com"}
+	for i := 0; i < ASIN_INSPECTION_MAX_ITEMS+1; i++ {
+		req.Items = append(req.Items, ASINInspectionRequestItem{ASIN: fmt.Sprintf("B0%08d", i)})
+	}
+	if _, err := buildASINInspectionItems(req); err == nil {
+		t.Fatal("expected realtime limit error")
+	}
+	items, err := buildInspectionItems(req, ASIN_INSPECTION_JOB_MAX_ITEMS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "items", fmt.Sprint(len(items)), fmt.Sprint(ASIN_INSPECTION_MAX_ITEMS+1))
+}
+
+func TestStoredInspectionItemAPIItem(t *testing.T) {
+	item := LinkInspectionItem{Original: "B0FNMPQSJC", URL: "https://www.amazon.com/dp/B0FNMPQSJC", ASIN: "B0FNMPQSJC", Domain: "www.amazon.com"}
+
+	pending := storedInspectionItem{Item: item, Status: INSPECTION_ITEM_PENDING}.apiItem()
+	assertEqual(t, "pending status", pending.Status, "pending")
+	assertEqual(t, "pending input", pending.Input, "B0FNMPQSJC")
+
+	done := storedInspectionItem{
+		Item:       item,
+		Status:     INSPECTION_ITEM_SUCCESS,
+		Result:     LinkInspectionResult{ASIN: "B0DWWWP4FF", Product: "Widget", Price: "$29.99"},
+		CapturedAt: "2026-06-06T00:00:00Z",
+	}.apiItem()
+	assertEqual(t, "done status", done.Status, "success")
+	assertEqual(t, "original asin", done.OriginalASIN, "B0FNMPQSJC")
+	assertEqual(t, "asin", done.ASIN, "B0DWWWP4FF")
+	assertEqual(t, "captured", done.CapturedAt, "2026-06-06T00:00:00Z")
+
+	failed := storedInspectionItem{Item: item, Status: INSPECTION_ITEM_FAILED, Result: LinkInspectionResult{ErrorMessage: "连接失败,503"}}.apiItem()
+	assertEqual(t, "failed status", failed.Status, "failed")
+}
+
+func TestWriteInspectionXLSXToWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rows := inspectionRows([]LinkInspectionResult{{
+		Item:    LinkInspectionItem{URL: "https://www.amazon.com/dp/B0FNMPQSJC", ASIN: "B0FNMPQSJC"},
+		Product: "Widget",
+		ASIN:    "B0FNMPQSJC",
+	}})
+	if err := writeInspectionXLSXTo(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range reader.File {
+		found = found || f.Name == "xl/worksheets/sheet1.xml"
+	}
+	if !found {
+		t.Fatal("sheet1.xml missing")
+	}
+}
+
+func TestHandleInspectionJobRejectsBadRequests(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleInspectionJob(rec, httptest.NewRequest(http.MethodGet, "/api/asin-inspection/jobs/abc", nil))
+	assertEqual(t, "bad id", fmt.Sprint(rec.Code), "404")
+
+	rec = httptest.NewRecorder()
+	handleInspectionJob(rec, httptest.NewRequest(http.MethodPost, "/api/asin-inspection/jobs/1", nil))
+	assertEqual(t, "method", fmt.Sprint(rec.Code), "405")
+
+	rec = httptest.NewRecorder()
+	handleInspectionJobs(rec, httptest.NewRequest(http.MethodPost, "/api/asin-inspection/jobs", strings.NewReader(`{"items":[]}`)))
+	assertEqual(t, "empty items", fmt.Sprint(rec.Code), "400")
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// version 程序版本，构建时可通过 -ldflags "-X main.version=v1.2.3" 指定，未指定时使用 git 提交号
+var version = "dev"
+
+// INSTANCE_MISSED_HEARTBEATS 连续错过多少次心跳视为失联
+const INSTANCE_MISSED_HEARTBEATS = 3
+
+// 实例运行模式
+const (
+	INSTANCE_MODE_CLI   = "cli"
+	INSTANCE_MODE_SERVE = "serve"
+	INSTANCE_MODE_BRAND = "brand"
+	INSTANCE_MODE_LINK  = "link"
+	INSTANCE_MODE_ASIN  = "asin"
+)
+
+// InstanceConfig 实例注册与心跳配置
+type InstanceConfig struct {
+	Heartbeat_interval int `yaml:"heartbeat_interval"` // 心跳间隔（秒），默认 10
+}
+
+// withDefaults 填充未配置的字段
+func (c InstanceConfig) withDefaults() InstanceConfig {
+	if c.Heartbeat_interval <= 0 {
+		c.Heartbeat_interval = 10
+	}
+	return c
+}
+
+// InstanceStats 实例运行计数，随心跳写入 amc_application.stats
+type InstanceStats struct {
+	Requests    int64 `json:"requests"`     // 发出的页面请求
+	Failures    int64 `json:"failures"`     // 失败的请求（含 503/验证码）
+	Blocked     int64 `json:"blocked"`      // 其中被 503/验证码/登录墙拦截的请求
+	TasksDone   int64 `json:"tasks_done"`   // 完成的任务（关键词/品牌/巡检条目）
+	TasksFailed int64 `json:"tasks_failed"` // 失败的任务
+}
+
+// instanceState 本进程的注册信息、当前任务和计数
+type instanceState struct {
+	stats InstanceStats // 使用 atomic 读写
+
+	mu    sync.Mutex
+	tasks map[string]int // 执行中的任务，多个消费者并发时可能有多个
+	live  bool           // 已注册且表结构支持心跳
+}
+
+var instance = &instanceState{tasks: map[string]int{}}
+
+// recordFetch 记录一次页面请求的结果
+func (s *instanceState) recordFetch(err error) {
+	atomic.AddInt64(&s.stats.Requests, 1)
+	if err == nil {
+		return
+	}
+	atomic.AddInt64(&s.stats.Failures, 1)
+	if err == ERROR_NOT_503 || isCookieRejected(err) {
+		atomic.AddInt64(&s.stats.Blocked, 1)
+	}
+}
+
+// recordTask 记录一个任务的结果
+func (s *instanceState) recordTask(success bool) {
+	if success {
+		atomic.AddInt64(&s.stats.TasksDone, 1)
+	} else {
+		atomic.AddInt64(&s.stats.TasksFailed, 1)
+	}
+}
+
+// snapshot 读取当前计数
+func (s *instanceState) snapshot() InstanceStats {
+	return InstanceStats{
+		Requests:    atomic.LoadInt64(&s.stats.Requests),
+		Failures:    atomic.LoadInt64(&s.stats.Failures),
+		Blocked:     atomic.LoadInt64(&s.stats.Blocked),
+		TasksDone:   atomic.LoadInt64(&s.stats.TasksDone),
+		TasksFailed: atomic.LoadInt64(&s.stats.TasksFailed),
+	}
+}
+
+// beginTask 标记任务开始执行，返回的函数在任务结束时调用
+func (s *instanceState) beginTask(name string) (done func()) {
+	s.mu.Lock()
+	s.tasks[name]++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		if s.tasks[name]--; s.tasks[name] <= 0 {
+			delete(s.tasks, name)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// currentTask 执行中的任务，多个时按名称排序后以逗号连接
+func (s *instanceState) currentTask() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return truncateRunes(strings.Join(names, ","), 255)
+}
+
+// truncateRunes 按字符截断，避免超出列长度
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// instanceMode 根据命令行参数确定运行模式
+func instanceMode(f flagStruct) string {
+	switch {
+	case f.brand:
+		return INSTANCE_MODE_BRAND
+	case f.linkFile != "":
+		return INSTANCE_MODE_LINK
+	case f.asin != "":
+		return INSTANCE_MODE_ASIN
+	case f.serve != "":
+		return INSTANCE_MODE_SERVE
+	default:
+		return INSTANCE_MODE_CLI
+	}
+}
+
+// buildVersion 程序版本，未通过 -ldflags 指定时读取构建信息中的 git 提交号
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return version + "-" + s.Value[:12]
+		}
+	}
+	return version
+}
+
+// startHeartbeat 每 heartbeat_interval 秒写入心跳、当前任务和计数，ctx 取消后停止
+func (app *appConfig) startHeartbeat(ctx context.Context) {
+	if !instance.live {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(seconds(app.Instance.Heartbeat_interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := app.heartbeat(ctx); err != nil && ctx.Err() == nil {
+					log.Errorf("写入实例心跳失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// heartbeat 写入一次心跳
+func (app *appConfig) heartbeat(ctx context.Context) error {
+	stats, _ := json.Marshal(instance.snapshot())
+	_, err := app.db.ExecContext(ctx,
+		"UPDATE amc_application SET heartbeat_at = NOW(), current_task = ?, stats = ? WHERE id = ?",
+		instance.currentTask(), string(stats), app.primary_id)
+	return err
+}
+
+// InstanceInfo /api/instances 返回的实例信息
+type InstanceInfo struct {
+	ID           int64           `json:"id"`
+	AppID        int             `json:"app_id"`
+	Hostname     string          `json:"hostname"`
+	PID          int             `json:"pid"`
+	Mode         string          `json:"mode"`
+	Version      string          `json:"version"`
+	ConfigHash   string          `json:"config_hash"`
+	StartedAt    string          `json:"started_at"`
+	HeartbeatAt  string          `json:"heartbeat_at"`
+	HeartbeatAge int64           `json:"heartbeat_age"` // 距上次心跳的秒数，-1 表示没有心跳
+	Status       int             `json:"status"`
+	State        string          `json:"state"` // running / stale / ended
+	CurrentTask  string          `json:"current_task"`
+	Stats        json.RawMessage `json:"stats,omitempty"`
+}
+
+// 实例状态
+const (
+	INSTANCE_STATE_RUNNING = "running" // 心跳正常
+	INSTANCE_STATE_STALE   = "stale"   // 错过心跳，可能已崩溃
+	INSTANCE_STATE_ENDED   = "ended"   // 已正常结束或中断退出
+)
+
+// instanceStateOf 根据程序状态和距上次心跳的秒数判断实例是否存活
+func instanceStateOf(status int, heartbeatAge int64, interval int) string {
+	if status == MYSQL_APPLICATION_STATUS_OVER || status == MYSQL_APPLICATION_STATUS_INTERRUPTED {
+		return INSTANCE_STATE_ENDED
+	}
+	if heartbeatAge < 0 || heartbeatAge > int64(interval*INSTANCE_MISSED_HEARTBEATS) {
+		return INSTANCE_STATE_STALE
+	}
+	return INSTANCE_STATE_RUNNING
+}
+
+// listInstances 查询最近注册的实例，activeOnly 为真时只返回未结束的实例
+func listInstances(ctx context.Context, activeOnly bool, limit int) ([]InstanceInfo, error) {
+	query := `SELECT id, app_id, COALESCE(hostname, ''), COALESCE(pid, 0), COALESCE(mode, ''), COALESCE(version, ''),
+		COALESCE(config_hash, ''), COALESCE(started_at, ''), COALESCE(heartbeat_at, ''),
+		COALESCE(TIMESTAMPDIFF(SECOND, heartbeat_at, NOW()), -1), status, COALESCE(current_task, ''), stats
+		FROM amc_application`
+	args := []interface{}{}
+	if activeOnly {
+		query += " WHERE status NOT IN (?, ?)"
+		args = append(args, MYSQL_APPLICATION_STATUS_OVER, MYSQL_APPLICATION_STATUS_INTERRUPTED)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := app.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []InstanceInfo{}
+	for rows.Next() {
+		var i InstanceInfo
+		var stats sql.NullString
+		if err := rows.Scan(&i.ID, &i.AppID, &i.Hostname, &i.PID, &i.Mode, &i.Version, &i.ConfigHash,
+			&i.StartedAt, &i.HeartbeatAt, &i.HeartbeatAge, &i.Status, &i.CurrentTask, &stats); err != nil {
+			return nil, err
+		}
+		if stats.Valid && json.Valid([]byte(stats.String)) {
+			i.Stats = json.RawMessage(stats.String)
+		}
+		i.State = instanceStateOf(i.Status, i.HeartbeatAge, app.Instance.Heartbeat_interval)
+		list = append(list, i)
+	}
+	return list, rows.Err()
+}
+
+// registerInstance 在 amc_application 中登记本进程，返回记录 ID
+// 表结构未升级时退回只登记 app_id，不写心跳
+func (app *appConfig) registerInstance(mode string) (int64, error) {
+	hostname, _ := os.Hostname()
+	r, err := app.db.Exec(
+		`INSERT INTO amc_application (app_id, hostname, pid, mode, version, config_hash, started_at, heartbeat_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())`,
+		app.Basic.App_id, hostname, os.Getpid(), mode, buildVersion(), app.configHash)
+	if err == nil {
+		instance.live = true
+		return r.LastInsertId()
+	}
+	log.Warnf("登记实例信息失败，请执行 sql/alter_application_instance.sql: %v", err)
+	r, err = app.db.Exec("insert into amc_application (app_id) values(?)", app.Basic.App_id)
+	if err != nil {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
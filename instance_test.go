@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestInstanceStateFlagsMissedHeartbeats(t *testing.T) {
+	cases := []struct {
+		status int
+		age    int64
+		want   string
+	}{
+		{MYSQL_APPLICATION_STATUS_SEARCH, 5, INSTANCE_STATE_RUNNING},
+		{MYSQL_APPLICATION_STATUS_START, 30, INSTANCE_STATE_RUNNING},
+		{MYSQL_APPLICATION_STATUS_START, 31, INSTANCE_STATE_STALE},
+		{MYSQL_APPLICATION_STATUS_PRODUCT, -1, INSTANCE_STATE_STALE},
+		{MYSQL_APPLICATION_STATUS_OVER, 9999, INSTANCE_STATE_ENDED},
+		{MYSQL_APPLICATION_STATUS_INTERRUPTED, -1, INSTANCE_STATE_ENDED},
+	}
+	for _, c := range cases {
+		got := instanceStateOf(c.status, c.age, 10)
+		assertEqual(t, fmt.Sprintf("status=%d age=%d", c.status, c.age), got, c.want)
+	}
+}
+
+func TestInstanceTracksConcurrentTasksAndCounters(t *testing.T) {
+	s := &instanceState{tasks: map[string]int{}}
+	doneB := s.beginTask("keyword:nike")
+	doneA := s.beginTask("keyword:adidas")
+	doneB2 := s.beginTask("keyword:nike")
+	assertEqual(t, "tasks", s.currentTask(), "keyword:adidas,keyword:nike")
+
+	doneA()
+	doneB()
+	assertEqual(t, "same keyword still running", s.currentTask(), "keyword:nike")
+	doneB2()
+	assertEqual(t, "idle", s.currentTask(), "")
+
+	s.recordFetch(nil)
+	s.recordFetch(ERROR_NOT_503)
+	s.recordFetch(ERROR_NOT_404)
+	s.recordTask(true)
+	s.recordTask(false)
+	stats := s.snapshot()
+	assertEqual(t, "stats", fmt.Sprintf("%d/%d/%d/%d/%d", stats.Requests, stats.Failures, stats.Blocked, stats.TasksDone, stats.TasksFailed), "3/2/1/1/1")
+}
+
+func TestInstanceModeFromFlags(t *testing.T) {
+	assertEqual(t, "cli", instanceMode(flagStruct{}), INSTANCE_MODE_CLI)
+	assertEqual(t, "serve", instanceMode(flagStruct{serve: ":8080"}), INSTANCE_MODE_SERVE)
+	assertEqual(t, "brand", instanceMode(flagStruct{brand: true, serve: ":8080"}), INSTANCE_MODE_BRAND)
+	assertEqual(t, "link", instanceMode(flagStruct{linkFile: "links.txt"}), INSTANCE_MODE_LINK)
+	assertEqual(t, "asin", instanceMode(flagStruct{asin: "B08N5WRWNW"}), INSTANCE_MODE_ASIN)
+}
@@ -3,11 +3,11 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"math"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -55,8 +55,8 @@ type LinkInspector struct {
 	inputFile     string
 	defaultDomain string
 	outputFile    string
+	options       ASINInspectionOptions // 接口巡检的附加选项，命令行模式不使用
 	results       []LinkInspectionResult
-	robots        map[string]Robots
 }
 
 type LinkInspectionItem struct {
@@ -85,6 +85,12 @@ type LinkInspectionResult struct {
 	FrequentReturn  string
 	NewerModel      string
 	ErrorMessage    string
+
+	// include_seller / include_offer 的附加结果，获取失败不影响巡检结果
+	Seller      *InspectionSeller `json:",omitempty"`
+	SellerError string            `json:",omitempty"`
+	Offers      []InspectionOffer `json:",omitempty"`
+	OfferError  string            `json:",omitempty"`
 }
 
 func NewLinkInspector(inputFile, domain, outputFile string) *LinkInspector {
@@ -93,39 +99,35 @@ func NewLinkInspector(inputFile, domain, outputFile string) *LinkInspector {
 		defaultDomain: normalizeDomain(domain),
 		outputFile:    outputFile,
 		results:       make([]LinkInspectionResult, 0),
-		robots: map[string]Robots{
-			normalizeDomain(app.Domain): robot,
-		},
 	}
 }
 
-func (s *LinkInspector) Run() error {
+// Run 逐条巡检并导出 xlsx，ctx 取消时停止巡检后续链接，已完成的结果仍会导出
+func (s *LinkInspector) Run(ctx context.Context) error {
 	items, err := loadLinkInspectionItems(s.inputFile, s.defaultDomain)
 	if err != nil {
 		return err
 	}
 
 	log.Infof("开始链接巡检，共 %d 条链接/ASIN", len(items))
-	if _, err := app.get_cookie(); err != nil {
-		log.Warnf("获取 Cookie 失败: %v，将不使用 Cookie", err)
-	}
 
 	successCount := 0
 	for i, item := range items {
 		log.Infof("进度: %d/%d - 巡检: %s", i+1, len(items), item.Original)
-		result := s.inspectItem(item)
+		done := instance.beginTask("link:" + item.Original)
+		result := s.inspectItem(ctx, item)
+		done()
+		if ctx.Err() != nil {
+			log.Warnf("收到退出信号，已巡检 %d/%d 条，导出已完成的结果", i, len(items))
+			break
+		}
+		recordTaskResult(METRIC_TASK_LINK, item.Domain, result.ErrorMessage == "")
 		if result.ErrorMessage == "" {
 			successCount++
 		} else {
 			log.Warnf("巡检失败 ASIN:%s URL:%s 错误:%s", item.ASIN, item.URL, result.ErrorMessage)
 		}
 		s.results = append(s.results, result)
-
-		if i < len(items)-1 {
-			delay := 2 + rangdom_range(2)
-			log.Infof("等待 %d 秒后继续...", delay)
-			time.Sleep(time.Duration(delay) * time.Second)
-		}
 	}
 
 	outputFile := s.outputFile
@@ -136,11 +138,11 @@ func (s *LinkInspector) Run() error {
 		return err
 	}
 
-	log.Infof("链接巡检完成: 成功=%d 失败=%d 输出=%s", successCount, len(items)-successCount, outputFile)
+	log.Infof("链接巡检完成: 成功=%d 失败=%d 输出=%s", successCount, len(s.results)-successCount, outputFile)
 	return nil
 }
 
-func (s *LinkInspector) inspectItem(item LinkInspectionItem) LinkInspectionResult {
+func (s *LinkInspector) inspectItem(ctx context.Context, item LinkInspectionItem) LinkInspectionResult {
 	result := LinkInspectionResult{
 		Item:            item,
 		ASIN:            item.ASIN,
@@ -150,7 +152,7 @@ func (s *LinkInspector) inspectItem(item LinkInspectionItem) LinkInspectionResul
 		DisplayDiscount: " ",
 	}
 
-	doc, err := s.fetchDocument(item)
+	doc, err := s.fetchDocument(ctx, item)
 	if err != nil {
 		result.ErrorMessage = err.Error()
 		return result
@@ -158,48 +160,55 @@ func (s *LinkInspector) inspectItem(item LinkInspectionItem) LinkInspectionResul
 
 	extracted := extractLinkInspectionFields(doc, item)
 	extracted.ErrorMessage = result.ErrorMessage
+	if s.options.IncludeSeller {
+		s.inspectSeller(ctx, doc, &extracted)
+	}
+	if s.options.IncludeOffer {
+		s.inspectOffers(ctx, &extracted)
+	}
 	return extracted
 }
 
-func (s *LinkInspector) fetchDocument(item LinkInspectionItem) (*goquery.Document, error) {
-	fp := GetCurrentFingerprint()
-	robots, err := s.robotsForDomain(item.Domain)
+// inspectSeller 从商品页提取购物车卖家并读取其店铺页
+func (s *LinkInspector) inspectSeller(ctx context.Context, doc *goquery.Document, result *LinkInspectionResult) {
+	link, href, ok := findSellerLink(doc)
+	if !ok {
+		result.SellerError = ERROR_NOT_SELLER_URL.Error()
+		return
+	}
+	sellerID := extractSellerID(href)
+	sellerName := strings.TrimSpace(link.Text())
+	seller, err := fetchInspectionSeller(ctx, result.Item.Domain, sellerID, sellerName)
 	if err != nil {
-		return nil, err
+		result.Seller = &InspectionSeller{SellerID: sellerID, SellerName: sellerName}
+		result.SellerError = err.Error()
+		return
 	}
-	if err := robots.IsAllow(fp.UserAgent, item.URL); err != nil {
-		return nil, err
+	result.Seller = seller
+}
+
+// inspectOffers 读取商品的全部报价，变体合并时使用实际 ASIN
+func (s *LinkInspector) inspectOffers(ctx context.Context, result *LinkInspectionResult) {
+	offers, err := fetchOffers(ctx, result.Item.Domain, result.ASIN, result.Item.URL)
+	if err != nil {
+		result.OfferError = err.Error()
+		return
 	}
+	result.Offers = offers
+}
 
+func (s *LinkInspector) fetchDocument(ctx context.Context, item LinkInspectionItem) (*goquery.Document, error) {
 	var lastErr error
 	for attempt := 0; attempt < 2; attempt++ {
-		client := get_client()
-		req, err := http.NewRequest("GET", item.URL, nil)
-		if err != nil {
-			return nil, err
-		}
-		ApplyFingerprint(req, GetRandomReferer(item.Domain))
-		if app.cookie != "" {
-			req.Header.Set("Cookie", app.cookie)
+		page, err := fetcher.Fetch(ctx, &FetchRequest{URL: item.URL, Mode: FETCH_MODE_LINK})
+		if err == nil {
+			return page.Doc, nil
 		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-		doc, readErr := documentFromResponse(resp)
-		resp.Body.Close()
-		if readErr != nil {
-			lastErr = readErr
-			if resp.StatusCode == http.StatusServiceUnavailable && attempt == 0 {
-				RotateFingerprint()
-				continue
-			}
-			continue
+		lastErr = err
+		if isRobotsDisallow(err) || ctx.Err() != nil {
+			return nil, err
 		}
-		if isVerificationDocument(doc) {
-			lastErr = ERROR_VERIFICATION
+		if isCookieRejected(err) {
 			if attempt == 0 {
 				if err := app.handleCookieInvalid(); err != nil {
 					log.Errorf("切换 Cookie 失败: %v", err)
@@ -209,7 +218,6 @@ func (s *LinkInspector) fetchDocument(item LinkInspectionItem) (*goquery.Documen
 			}
 			return nil, lastErr
 		}
-		return doc, nil
 	}
 
 	if lastErr == nil {
@@ -218,32 +226,6 @@ func (s *LinkInspector) fetchDocument(item LinkInspectionItem) (*goquery.Documen
 	return nil, lastErr
 }
 
-func (s *LinkInspector) robotsForDomain(domain string) (Robots, error) {
-	domain = normalizeDomain(domain)
-	if r, ok := s.robots[domain]; ok {
-		return r, nil
-	}
-
-	fp := GetCurrentFingerprint()
-	robotTxt := fmt.Sprintf("https://%s/robots.txt", domain)
-	log.Infof("加载文件: %s", robotTxt)
-	txt, err := request_get(robotTxt, fp.UserAgent)
-	if err != nil {
-		return Robots{}, fmt.Errorf("加载 robots.txt 失败: %w", err)
-	}
-
-	r := GetRobotFromTxt(txt)
-	s.robots[domain] = r
-	return r, nil
-}
-
-func documentFromResponse(resp *http.Response) (*goquery.Document, error) {
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-	return goquery.NewDocumentFromReader(resp.Body)
-}
-
 func extractLinkInspectionFields(doc *goquery.Document, item LinkInspectionItem) LinkInspectionResult {
 	reviewCount := extractReviewCountValue(textBySelectors(doc, []string{
 		"#acrCustomerReviewText",
@@ -902,15 +884,6 @@ func extractRatingValue(text string) string {
 	return strconv.FormatFloat(rating, 'f', 1, 64)
 }
 
-func isVerificationDocument(doc *goquery.Document) bool {
-	title := doc.Find("title").First().Text()
-	h4 := doc.Find("h4").First().Text()
-	return strings.Contains(title, "Enter the characters") ||
-		strings.Contains(title, "Type the characters") ||
-		strings.Contains(title, "Robot check") ||
-		strings.Contains(h4, "Enter the characters")
-}
-
 func inspectionRows(results []LinkInspectionResult) [][]string {
 	rows := make([][]string, 0, len(results)+1)
 	rows = append(rows, inspectionHeaders)
@@ -949,8 +922,12 @@ func writeInspectionXLSX(filename string, rows [][]string) error {
 	}
 	defer file.Close()
 
-	zipWriter := zip.NewWriter(file)
-	defer zipWriter.Close()
+	return writeInspectionXLSXTo(file, rows)
+}
+
+// writeInspectionXLSXTo 将巡检结果以 xlsx 格式写入 w（文件或 HTTP 响应）
+func writeInspectionXLSXTo(w io.Writer, rows [][]string) error {
+	zipWriter := zip.NewWriter(w)
 
 	files := map[string]string{
 		"[Content_Types].xml":        contentTypesXML,
@@ -978,7 +955,7 @@ func writeInspectionXLSX(filename string, rows [][]string) error {
 			return err
 		}
 	}
-	return nil
+	return zipWriter.Close()
 }
 
 func addZipFile(zipWriter *zip.Writer, name, content string) error {
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/tengfei-xy/go-log"
@@ -20,19 +22,35 @@ const MYSQL_APPLICATION_STATUS_OVER int = 1
 const MYSQL_APPLICATION_STATUS_SEARCH int = 2
 const MYSQL_APPLICATION_STATUS_PRODUCT int = 3
 const MYSQL_APPLICATION_STATUS_SELLER int = 4
+const MYSQL_APPLICATION_STATUS_INTERRUPTED int = 5 // 收到退出信号，已保存进度并释放认领
 
 type appConfig struct {
 	Mysql          `yaml:"mysql"`
 	Basic          `yaml:"basic"`
 	Proxy          `yaml:"proxy"`
 	Exec           `yaml:"exec"`
-	Brand          BrandConfig `yaml:"brand"` // 品牌巡查配置
+	Brand          BrandConfig         `yaml:"brand"`          // 品牌巡查配置
+	Cookie         CookieConfig        `yaml:"cookie"`         // Cookie 会话配置
+	Network        NetworkConfig       `yaml:"network"`        // 连接池与超时配置
+	Rate_limit     RateLimitConfig     `yaml:"rate_limit"`     // 请求限速配置
+	Robots_txt     RobotsConfig        `yaml:"robots"`         // robots.txt 缓存配置
+	Task           TaskConfig          `yaml:"task"`           // 关键词任务消费者配置
+	Claim          ClaimConfig         `yaml:"claim"`          // 商品/商家批量认领租约配置
+	Instance       InstanceConfig      `yaml:"instance"`       // 实例登记与心跳配置
+	Inspection_job InspectionJobConfig `yaml:"inspection_job"` // 异步巡检任务配置
+	Webhook        WebhookConfig       `yaml:"webhook"`        // 任务完成回调配置
+	Auth           AuthConfig          `yaml:"auth"`           // HTTP 接口密钥、权限和配额
+	Schedule       ScheduleConfig      `yaml:"schedule"`       // 定时任务配置
 	db             *sql.DB
-	cookie         string
+	cookie         string          // 当前使用的 cookie（已合并响应中的 Set-Cookie）
+	cookieBase     string          // 最近一次从数据库读取或回写的 cookie，用于判断是否被外部修改
 	cookieID       int64           // 当前使用的 cookie 记录 ID
 	browserProfile *BrowserProfile // 绑定的浏览器指纹
 	proxyAddr      string          // 绑定的代理 IP
 	primary_id     int64
+	configHash     string // 配置文件内容的 sha256 前 12 位，登记实例时写入
+
+	rejectedCookieID int64 // 最近一次被拒绝（验证码/登录墙/503）的 cookie，并发请求时避免重复切换
 }
 type Exec struct {
 	Enable          `yaml:"enable"`
@@ -63,7 +81,12 @@ type Basic struct {
 type Proxy struct {
 	Enable bool `yaml:"enable"`
 
-	Sockc5 []string `yaml:"socks5"`
+	Servers []string `yaml:"servers"` // 代理地址，支持 socks5://、http://、https://，可带用户名密码
+	Sockc5  []string `yaml:"socks5"`  // 旧配置，host:port 形式的 SOCKS5 代理
+
+	Probe_interval    int `yaml:"probe_interval"`    // 后台探测间隔（秒），默认 60
+	Failure_threshold int `yaml:"failure_threshold"` // 连续失败多少次后熔断，默认 5
+	Open_seconds      int `yaml:"open_seconds"`      // 熔断持续时间（秒），期满后进入半开状态，默认 300
 }
 type Mysql struct {
 	Ip       string `yaml:"ip"`
@@ -84,7 +107,6 @@ type flagStruct struct {
 }
 
 var app appConfig
-var robot Robots
 
 const userAgent = `Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36`
 
@@ -99,6 +121,7 @@ func init_config(flag flagStruct) {
 	if err != nil {
 		panic(err)
 	}
+	app.configHash = fmt.Sprintf("%x", sha256.Sum256(yamlFile))[:12]
 	if !app.Exec.Enable.Search && !app.Exec.Enable.Product && !app.Exec.Enable.Seller {
 		panic("没有启动功能，检查配置文件的enable配置的选项")
 	}
@@ -117,20 +140,57 @@ func init_config(flag flagStruct) {
 	app.Exec.product_time = 0
 	app.Exec.search_time = 0
 	app.Exec.seller_time = 0
+	if app.Cookie.Save_interval <= 0 {
+		app.Cookie.Save_interval = 60
+	}
+	jar.interval = time.Duration(app.Cookie.Save_interval) * time.Second
+	if app.Cookie.Cooldown <= 0 {
+		app.Cookie.Cooldown = 600
+	}
+	if app.Cookie.Max_strikes <= 0 {
+		app.Cookie.Max_strikes = 3
+	}
+	app.Network = app.Network.withDefaults()
+	transports = newTransportPool(app.Network)
+	app.Rate_limit = app.Rate_limit.withDefaults()
+	limiter = newRateLimiter(app.Rate_limit)
+	if app.Robots_txt.Ttl <= 0 {
+		app.Robots_txt.Ttl = 86400
+	}
+	robotsTTL = seconds(app.Robots_txt.Ttl)
+	app.Task = app.Task.withDefaults()
+	app.Claim = app.Claim.withDefaults()
+	app.Instance = app.Instance.withDefaults()
+	app.Inspection_job = app.Inspection_job.withDefaults()
+	app.Webhook = app.Webhook.withDefaults()
+	app.Auth = app.Auth.withDefaults()
+	app.Schedule = app.Schedule.withDefaults()
+	if apiKeys, err = newAPIKeyStore(app.Auth); err != nil {
+		panic(err)
+	}
+	if app.Proxy.Probe_interval <= 0 {
+		app.Proxy.Probe_interval = 60
+	}
+	if app.Proxy.Failure_threshold <= 0 {
+		app.Proxy.Failure_threshold = 5
+	}
+	if app.Proxy.Open_seconds <= 0 {
+		app.Proxy.Open_seconds = 300
+	}
+	for _, addr := range app.Proxy.servers() {
+		if _, err := parseProxyURL(addr); err != nil {
+			panic(err)
+		}
+	}
+	proxyPool = NewProxyPool(app.Proxy.servers(), app.Proxy.Failure_threshold, seconds(app.Proxy.Open_seconds))
 
 	log.Infof("程序标识:%d 主机标识:%d", app.Basic.App_id, app.Basic.Host_id)
 }
 func init_rebots() {
-	robotTxt := fmt.Sprintf("https://%s/robots.txt", app.Domain)
-	fp := GetCurrentFingerprint()
-
-	log.Infof("加载文件: %s", robotTxt)
-	txt, err := request_get(robotTxt, fp.UserAgent)
-	if err != nil {
+	if _, err := robotsForDomain(context.Background(), app.Domain); err != nil {
 		log.Error("网络错误")
 		panic(err)
 	}
-	robot = GetRobotFromTxt(txt)
 }
 func init_mysql() {
 	DB, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", app.Mysql.Username, app.Mysql.Password, app.Mysql.Ip, app.Mysql.Port, app.Mysql.Database))
@@ -156,14 +216,14 @@ func init_network() {
 
 		var s searchStruct
 		s.en_key = "Hardware+electrician"
-		_, err := s.request(0)
-		if err == nil {
+		_, err := s.request(context.Background(), 0)
+		if err == nil || err == ERROR_EMPTY_RESULTS {
 			log.Info("网络测试通过")
 			return
 		}
 
 		// 检查是否是验证失败错误
-		if err == ERROR_VERIFICATION {
+		if isCookieRejected(err) {
 			log.Warnf("检测到 Cookie 需要验证，尝试获取新的 Cookie (尝试 %d/%d)", attempt, maxRetries)
 			if handleErr := app.handleCookieInvalid(); handleErr != nil {
 				log.Errorf("获取新 Cookie 失败: %v", handleErr)
@@ -182,20 +242,25 @@ func init_network() {
 	log.Error("网络测试失败，已达最大重试次数")
 	panic(fmt.Errorf("网络测试失败，请检查网络或获取新的 Cookie"))
 }
-func init_signal() {
-	// 创建一个通道来接收操作系统的信号
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGABRT)
+
+// init_signal 返回根 context，收到退出信号时取消
+// 各模式完成或保存当前条目后返回，由 main 释放认领并记录状态；再次收到信号时直接退出
+func init_signal() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
 
 	go func() {
-		<-sigCh
+		sig := <-sigCh
 		log.Info("")
-		log.Infof("程序即将结束")
-		app.end()
-		app.db.Close()
-		log.Infof("程序结束")
-		os.Exit(0)
+		log.Infof("收到信号 %s，程序即将结束，正在保存当前进度（再次发送信号将强制退出）", sig)
+		cancel()
+
+		<-sigCh
+		log.Warn("强制退出")
+		os.Exit(1)
 	}()
+	return ctx
 }
 func init_flag() flagStruct {
 	var f flagStruct
@@ -251,61 +316,99 @@ func main() {
 	init_rebots()
 	init_mysql()
 	init_network()
-	init_signal()
+	ctx := init_signal()
+	app.start(instanceMode(f))
+	app.startHeartbeat(ctx)
+	if app.Proxy.Enable {
+		proxyPool.StartProbing(ctx, seconds(app.Proxy.Probe_interval))
+	}
+
+	err := run(ctx, f)
 
-	// 判断运行模式
+	status := MYSQL_APPLICATION_STATUS_OVER
+	if ctx.Err() != nil {
+		status = MYSQL_APPLICATION_STATUS_INTERRUPTED
+	}
+	app.end(status)
+	log.Infof("程序结束")
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// run 按启动参数执行对应模式，ctx 取消后在当前条目结束时返回
+func run(ctx context.Context, f flagStruct) error {
 	if f.brand {
 		// 品牌巡查模式
-		brandMain()
-		return
+		if err := brandMain(ctx); err != nil {
+			return err
+		}
 	} else if f.linkFile != "" {
 		// 链接巡检模式
 		log.Infof("启动链接巡检模式")
 		inspector := NewLinkInspector(f.linkFile, f.domain, f.linkOutput)
-		if err := inspector.Run(); err != nil {
+		if err := inspector.Run(ctx); err != nil {
 			log.Errorf("链接巡检执行失败: %v", err)
-			os.Exit(1)
+			return err
 		}
-		return
 	} else if f.asin != "" {
 		// ASIN 评论爬虫模式
 		log.Infof("启动 ASIN 评论爬虫模式")
 		scraper := NewASINScraper(f.asin, f.domain)
-		if err := scraper.Run(); err != nil {
+		if err := scraper.Run(ctx); err != nil {
 			log.Errorf("ASIN 爬虫执行失败: %v", err)
-			os.Exit(1)
+			return err
 		}
-		return
 	} else if f.serve != "" {
 		// HTTP 服务模式
 		log.Infof("启动 HTTP 服务模式")
 
+		// 回收崩溃实例遗留的商品/商家认领
+		startClaimReaper(ctx)
+		// 将 refresh_days 到期的关键词重新排队
+		startTaskRefresher(ctx)
+		// 异步巡检任务在 API-only 模式下同样执行
+		waitInspectionJobs := StartInspectionJobWorker(ctx)
+		// 投递任务和巡检任务的完成回调
+		waitWebhooks := StartWebhookWorker(ctx)
+		// 到期的定时任务，多台主机只由持有锁的一台执行
+		waitScheduler := StartScheduler(ctx)
+
 		if f.serveOnly {
 			log.Infof("HTTP 服务仅启动 API，跳过关键词任务消费者")
 		} else {
 			// 初始化并启动任务消费者
 			InitTaskWorker()
-			taskWorker.Start()
+			taskWorker.Start(ctx)
 		}
 
-		// 启动 HTTP 服务（阻塞）
-		StartHTTPServer(f.serve)
+		// 启动 HTTP 服务（阻塞至 ctx 取消并关闭服务）
+		err := StartHTTPServer(ctx, f.serve)
+		// 等待正在执行的任务完成或保存进度
+		if taskWorker != nil {
+			taskWorker.Stop()
+		}
+		waitInspectionJobs()
+		waitScheduler()
+		waitWebhooks()
+		return err
 	} else {
 		// 原有命令行模式
 		log.Infof("启动命令行模式")
-		app.start()
+		startClaimReaper(ctx)
 
-		for app.Exec.Loop.all_time = 0; app.Exec.Loop.all_time < app.Exec.Loop.All; app.Exec.Loop.all_time++ {
+		for app.Exec.Loop.all_time = 0; app.Exec.Loop.all_time < app.Exec.Loop.All && ctx.Err() == nil; app.Exec.Loop.all_time++ {
 			var search searchStruct
-			search.main()
+			search.main(ctx)
 
 			var product productStruct
-			product.main()
+			product.main(ctx)
 
 			var seller sellerStruct
-			seller.main()
+			seller.main(ctx)
 		}
 	}
+	return nil
 }
 func (app *appConfig) get_cookie() (string, error) {
 	var cookie string
@@ -317,10 +420,12 @@ func (app *appConfig) get_cookie() (string, error) {
 		return "", fmt.Errorf("配置文件中host_id为0，cookie将为空")
 	}
 
-	// 查询当前 host_id 绑定的正常状态的 cookie（包含浏览器指纹和代理信息）
+	// 查询当前 host_id 绑定的正常状态、不在冷却中的 cookie（包含浏览器指纹和代理信息），优先保持当前 cookie
 	err := app.db.QueryRow(
-		"SELECT id, cookie, browser_profile, proxy_addr FROM amc_cookie WHERE host_id = ? AND status = 1 LIMIT 1",
-		app.Basic.Host_id,
+		`SELECT id, cookie, browser_profile, proxy_addr FROM amc_cookie
+		WHERE host_id = ? AND status = 1 AND (cooldown_until IS NULL OR cooldown_until <= CURRENT_TIMESTAMP)
+		ORDER BY id = ? DESC, id LIMIT 1`,
+		app.Basic.Host_id, app.cookieID,
 	).Scan(&cookieID, &cookie, &browserProfileID, &proxyAddr)
 
 	if err == sql.ErrNoRows {
@@ -349,9 +454,9 @@ func (app *appConfig) get_cookie() (string, error) {
 	if proxyAddr.Valid && proxyAddr.String != "" {
 		app.proxyAddr = proxyAddr.String
 	} else {
-		// 如果数据库中没有保存代理地址，从配置中随机选择一个并更新数据库
-		if app.Proxy.Enable && len(app.Proxy.Sockc5) > 0 {
-			app.proxyAddr = app.Proxy.Sockc5[rand.Intn(len(app.Proxy.Sockc5))]
+		// 如果数据库中没有保存代理地址，从代理池中选择评分最高的并更新数据库
+		if addr, ok := proxyPool.Pick("", nil); app.Proxy.Enable && ok {
+			app.proxyAddr = addr
 			_, _ = app.db.Exec(
 				"UPDATE amc_cookie SET proxy_addr = ? WHERE id = ?",
 				app.proxyAddr, cookieID,
@@ -359,21 +464,31 @@ func (app *appConfig) get_cookie() (string, error) {
 		}
 	}
 
+	if cookieID == app.cookieID {
+		if cookie == app.cookieBase || cookie == app.cookie {
+			// 数据库中的值未被外部修改，继续使用合并了 Set-Cookie 的版本
+			return app.cookie, nil
+		}
+		// 数据库中的 cookie 被手动更新，以数据库为准
+		jar.Forget(cookieID)
+	}
+
 	if app.cookie != cookie {
 		previewLen := 50
 		if len(cookie) < previewLen {
 			previewLen = len(cookie)
 		}
 		log.Infof("使用 cookie (id=%d, profile=%s, proxy=%s): %s...",
-			cookieID, app.browserProfile.ID, app.proxyAddr, cookie[:previewLen])
+			cookieID, app.browserProfile.ID, redactProxyAddr(app.proxyAddr), cookie[:previewLen])
 	}
 
 	app.cookie = cookie
+	app.cookieBase = cookie
 	app.cookieID = cookieID
 	return app.cookie, nil
 }
 
-// acquireNewCookie 从未分配的正常 cookie 中获取一个并绑定到当前 host_id
+// acquireNewCookie 从未分配的正常 cookie 中按健康度挑选一个并绑定到当前 host_id
 func (app *appConfig) acquireNewCookie() (string, error) {
 	tx, err := app.db.Begin()
 	if err != nil {
@@ -381,32 +496,35 @@ func (app *appConfig) acquireNewCookie() (string, error) {
 	}
 	defer tx.Rollback()
 
-	var cookieID int64
-	var cookie string
-
-	// 查找一个未分配的正常 cookie（host_id 为 NULL）
-	err = tx.QueryRow(
-		"SELECT id, cookie FROM amc_cookie WHERE host_id IS NULL AND status = 1 LIMIT 1 FOR UPDATE",
-	).Scan(&cookieID, &cookie)
-
-	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("没有可用的未分配 cookie，请通过 SKILL 获取新的 Session")
-	} else if err != nil {
+	// 查找未分配（host_id 为 NULL）、不在冷却中的正常 cookie
+	candidates, err := queryCookieCandidates(tx)
+	if err != nil {
 		return "", fmt.Errorf("查询未分配 cookie 失败: %w", err)
 	}
+	best := pickHealthiestCookie(candidates)
+	if best < 0 {
+		return "", fmt.Errorf("没有可用的未分配 cookie，请通过 SKILL 获取新的 Session")
+	}
+	c := candidates[best]
 
-	// 随机选择一个浏览器指纹
-	app.browserProfile = getRandomBrowserProfile()
+	// 沿用 cookie 之前绑定的浏览器指纹，没有则随机选择一个
+	if c.BrowserProfile.Valid && c.BrowserProfile.String != "" {
+		app.browserProfile = getBrowserProfileByID(c.BrowserProfile.String)
+	} else {
+		app.browserProfile = getRandomBrowserProfile()
+	}
 
-	// 从配置中随机选择一个代理地址
-	if app.Proxy.Enable && len(app.Proxy.Sockc5) > 0 {
-		app.proxyAddr = app.Proxy.Sockc5[rand.Intn(len(app.Proxy.Sockc5))]
+	// 沿用之前绑定的代理地址，没有则从代理池中选择评分最高的
+	if c.ProxyAddr.Valid && c.ProxyAddr.String != "" {
+		app.proxyAddr = c.ProxyAddr.String
+	} else if addr, ok := proxyPool.Pick("", nil); app.Proxy.Enable && ok {
+		app.proxyAddr = addr
 	}
 
 	// 将 cookie 绑定到当前 host_id，并保存浏览器指纹和代理地址
 	_, err = tx.Exec(
 		"UPDATE amc_cookie SET host_id = ?, browser_profile = ?, proxy_addr = ? WHERE id = ?",
-		app.Basic.Host_id, app.browserProfile.ID, app.proxyAddr, cookieID,
+		app.Basic.Host_id, app.browserProfile.ID, app.proxyAddr, c.ID,
 	)
 	if err != nil {
 		return "", fmt.Errorf("绑定 cookie 失败: %w", err)
@@ -416,64 +534,47 @@ func (app *appConfig) acquireNewCookie() (string, error) {
 		return "", fmt.Errorf("提交事务失败: %w", err)
 	}
 
-	cookie = strings.TrimSpace(cookie)
-	log.Infof("获取新 cookie (id=%d, profile=%s, proxy=%s) 并绑定到 host_id=%d",
-		cookieID, app.browserProfile.ID, app.proxyAddr, app.Basic.Host_id)
+	log.Infof("获取新 cookie (id=%d, score=%.2f, profile=%s, proxy=%s) 并绑定到 host_id=%d",
+		c.ID, cookieHealthScore(c), app.browserProfile.ID, redactProxyAddr(app.proxyAddr), app.Basic.Host_id)
 
-	app.cookie = cookie
-	app.cookieID = cookieID
+	app.cookie = c.Cookie
+	app.cookieBase = c.Cookie
+	app.cookieID = c.ID
 	return app.cookie, nil
 }
 
-// markCookieInvalid 将当前使用的 cookie 标记为失效
-func (app *appConfig) markCookieInvalid() error {
-	if app.cookieID == 0 {
-		return fmt.Errorf("没有正在使用的 cookie")
-	}
-
-	_, err := app.db.Exec(
-		"UPDATE amc_cookie SET status = 0 WHERE id = ?",
-		app.cookieID,
-	)
-	if err != nil {
-		return fmt.Errorf("标记 cookie 失效失败: %w", err)
-	}
-
-	log.Warnf("cookie (id=%d) 已标记为失效", app.cookieID)
-	app.cookie = ""
-	app.cookieID = 0
-	return nil
-}
-
-// handleCookieInvalid 处理 cookie 失效的情况：标记失效并尝试获取新的
+// handleCookieInvalid 处理 cookie 失效的情况：当前 cookie 进入冷却并尝试获取新的
+// 多个消费者同时遇到同一 cookie 被拒绝时只切换一次
 func (app *appConfig) handleCookieInvalid() error {
-	// 标记当前 cookie 为失效
-	if err := app.markCookieInvalid(); err != nil {
-		log.Errorf("标记 cookie 失效出错: %v", err)
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if app.cookieID != 0 && app.cookieID != app.rejectedCookieID {
+		log.Infof("cookie 已被其他任务切换 (id=%d)", app.cookieID)
+		return nil
 	}
 
-	// 轮换浏览器指纹
-	RotateFingerprint()
-	log.Info("已轮换浏览器指纹")
+	// 当前 cookie 进入冷却（连续多次才标记为失效）
+	if err := app.coolDownCookie(); err != nil {
+		log.Errorf("cookie 冷却出错: %v", err)
+	}
 
-	// 尝试获取新的 cookie
+	// 获取新的 cookie，浏览器指纹和代理随新 cookie 的绑定切换
 	_, err := app.acquireNewCookie()
 	return err
 }
-func (app *appConfig) start() {
+
+// start 登记本实例（主机名、进程号、运行模式、版本、配置摘要），各模式启动时调用
+func (app *appConfig) start(mode string) {
 	if app.Basic.Test {
 		log.Infof("测试模式启动")
 		return
 	}
-	r, err := app.db.Exec("insert into amc_application (app_id) values(?)", app.Basic.App_id)
-	if err != nil {
-		panic(err)
-	}
-	id, err := r.LastInsertId()
+	id, err := app.registerInstance(mode)
 	if err != nil {
 		panic(err)
 	}
 	app.primary_id = id
+	log.Infof("实例已登记 ID:%d 模式:%s 版本:%s 配置:%s", id, mode, buildVersion(), app.configHash)
 }
 func (app *appConfig) update(status int) {
 	_, err := app.db.Exec("update amc_application set status=? where id=?", status, app.primary_id)
@@ -481,11 +582,25 @@ func (app *appConfig) update(status int) {
 		panic(err)
 	}
 }
-func (app *appConfig) end() {
-	if app.Basic.Test {
+
+// end 退出前释放本实例的认领、回写 cookie 并记录结束状态
+// status 为 MYSQL_APPLICATION_STATUS_OVER 或 MYSQL_APPLICATION_STATUS_INTERRUPTED
+func (app *appConfig) end(status int) {
+	app.releaseClaims()
+	jar.Flush()
+	transports.CloseIdleConnections()
+	proxyPool.LogSummary()
+	defer app.db.Close()
+	if app.Basic.Test || app.primary_id == 0 {
 		return
 	}
-	if _, err := app.db.Exec("update amc_application set status=? where id=?", MYSQL_APPLICATION_STATUS_OVER, app.primary_id); err != nil {
+	if _, err := app.db.Exec("update amc_application set status=? where id=?", status, app.primary_id); err != nil {
 		log.Error(err)
 	}
+	if instance.live {
+		// 写入最终计数，结束后不再有执行中的任务
+		if err := app.heartbeat(context.Background()); err != nil {
+			log.Error(err)
+		}
+	}
 }
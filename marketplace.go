@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// marketplaces 亚马逊站点域名与站点代码
+var marketplaces = map[string]string{
+	"www.amazon.com":    "US",
+	"www.amazon.ca":     "CA",
+	"www.amazon.com.mx": "MX",
+	"www.amazon.com.br": "BR",
+	"www.amazon.co.uk":  "UK",
+	"www.amazon.de":     "DE",
+	"www.amazon.fr":     "FR",
+	"www.amazon.it":     "IT",
+	"www.amazon.es":     "ES",
+	"www.amazon.nl":     "NL",
+	"www.amazon.se":     "SE",
+	"www.amazon.pl":     "PL",
+	"www.amazon.com.be": "BE",
+	"www.amazon.com.tr": "TR",
+	"www.amazon.ae":     "AE",
+	"www.amazon.sa":     "SA",
+	"www.amazon.eg":     "EG",
+	"www.amazon.in":     "IN",
+	"www.amazon.co.jp":  "JP",
+	"www.amazon.com.au": "AU",
+	"www.amazon.sg":     "SG",
+}
+
+// marketplaceFromDomain 域名对应的站点代码，未知站点按 US 处理（与之前写入 tb_amazon_shop 的值一致）
+func marketplaceFromDomain(domain string) string {
+	if code, ok := marketplaces[normalizeDomain(domain)]; ok {
+		return code
+	}
+	return "US"
+}
+
+// resolveMarketplaceDomain 将站点域名（可省略 www.）或站点代码（如 MX）解析为站点域名
+func resolveMarketplaceDomain(s string) (string, error) {
+	domain := normalizeDomain(s)
+	if domain == "" {
+		return "", fmt.Errorf("站点不能为空")
+	}
+	if _, ok := marketplaces[domain]; ok {
+		return domain, nil
+	}
+	if _, ok := marketplaces["www."+domain]; ok {
+		return "www." + domain, nil
+	}
+	code := strings.ToUpper(domain)
+	if code == "GB" {
+		code = "UK"
+	}
+	for d, c := range marketplaces {
+		if c == code {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("不支持的亚马逊站点: %s", s)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestResolveMarketplaceDomain(t *testing.T) {
+	cases := map[string]string{
+		"www.amazon.com.mx":         "www.amazon.com.mx",
+		"https://www.amazon.co.uk/": "www.amazon.co.uk",
+		"amazon.de":                 "www.amazon.de",
+		"mx":                        "www.amazon.com.mx",
+		"GB":                        "www.amazon.co.uk",
+	}
+	for in, want := range cases {
+		got, err := resolveMarketplaceDomain(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		assertEqual(t, in, got, want)
+	}
+	for _, bad := range []string{"", "www.example.com", "XX"} {
+		if _, err := resolveMarketplaceDomain(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestMarketplaceFromDomain(t *testing.T) {
+	assertEqual(t, "mx", marketplaceFromDomain("www.amazon.com.mx"), "MX")
+	assertEqual(t, "uk", marketplaceFromDomain("www.amazon.co.uk"), "UK")
+	assertEqual(t, "unknown", marketplaceFromDomain("127.0.0.1:8443"), "US")
+}
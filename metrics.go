@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 任务类型，amc_tasks_processed_total 的 mode 标签
+const (
+	METRIC_TASK_KEYWORD        = "keyword"        // 关键词任务
+	METRIC_TASK_BRAND          = "brand"          // 品牌巡查
+	METRIC_TASK_LINK           = "link"           // 命令行链接巡检的一条
+	METRIC_TASK_ASIN           = "asin"           // ASIN 评论爬虫的一个 ASIN
+	METRIC_TASK_INSPECTION_JOB = "inspection_job" // 异步巡检任务的一条
+)
+
+// 请求间隔场景，amc_delay_seconds 的 scenario 标签；被惩罚暂停时为 RATE_PENALTY_*
+const (
+	DELAY_SCENARIO_NORMAL      = "normal"      // 令牌桶限速
+	DELAY_SCENARIO_CRAWL_DELAY = "crawl_delay" // robots.txt 的 Crawl-delay
+	DELAY_SCENARIO_RETRY       = "retry"       // 网络错误后的重试间隔
+)
+
+// METRICS_CONTENT_TYPE Prometheus 文本格式
+const METRICS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// 请求耗时和等待时间的直方图分桶（秒）
+var (
+	fetchDurationBuckets = []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60}
+	delayBuckets         = []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800}
+)
+
+// 抓取和任务指标，/metrics 按注册顺序输出
+var (
+	metricFetchRequests = registerMetric(newCounterVec("amc_fetch_requests_total",
+		"发出的页面请求数（含重试）", "marketplace", "mode", "cookie_id", "proxy"))
+	metricFetchResponses = registerMetric(newCounterVec("amc_fetch_responses_total",
+		"按状态码统计的响应数，网络错误时 status_code 为 error", "marketplace", "mode", "cookie_id", "proxy", "status_code"))
+	metricFetchDuration = registerMetric(newHistogramVec("amc_fetch_duration_seconds",
+		"单次请求耗时（秒）", fetchDurationBuckets, "marketplace", "mode", "cookie_id", "proxy"))
+	metricPageClasses = registerMetric(newCounterVec("amc_page_class_total",
+		"按页面分类统计的响应数", "marketplace", "mode", "cookie_id", "proxy", "class"))
+	metricParseFailures = registerMetric(newCounterVec("amc_parse_failures_total",
+		"页面可以访问但解析不到预期内容的次数", "marketplace", "mode"))
+	metricTasksProcessed = registerMetric(newCounterVec("amc_tasks_processed_total",
+		"处理完的任务数，result 为 success 或 failed", "marketplace", "mode", "result"))
+	metricDelay = registerMetric(newHistogramVec("amc_delay_seconds",
+		"请求前等待的时间（秒），按限速、Crawl-delay、惩罚暂停和重试场景统计", delayBuckets, "marketplace", "scenario"))
+)
+
+// metricSeries 一组标签值对应的计数
+type metricSeries struct {
+	labels  []string
+	value   float64  // 计数器的值，或直方图的观测次数
+	sum     float64  // 直方图观测值之和
+	buckets []uint64 // 直方图各分桶（不累计）的观测次数
+}
+
+// metricVec 带标签的计数器或直方图
+type metricVec struct {
+	name    string
+	help    string
+	kind    string // counter / histogram
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// newCounterVec 创建计数器
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]*metricSeries)}
+}
+
+// newHistogramVec 创建直方图，buckets 为升序的分桶上限
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// seriesLocked 标签值对应的序列，不存在时创建
+func (m *metricVec) seriesLocked(values []string) *metricSeries {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际 %d 个", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), values...)}
+		if m.kind == "histogram" {
+			s.buckets = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Inc 计数器加 1
+func (m *metricVec) Inc(values ...string) {
+	m.Add(1, values...)
+}
+
+// Add 计数器加 v
+func (m *metricVec) Add(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seriesLocked(values).value += v
+}
+
+// Observe 直方图记录一次观测值
+func (m *metricVec) Observe(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.seriesLocked(values)
+	s.value++
+	s.sum += v
+	for i, le := range m.buckets {
+		if v <= le {
+			s.buckets[i]++
+			break
+		}
+	}
+}
+
+// write 按 Prometheus 文本格式输出，序列按标签值排序
+func (m *metricVec) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, escapeMetricHelp(m.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+	for _, k := range keys {
+		s := m.series[k]
+		labels := formatMetricLabels(m.labels, s.labels)
+		if m.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, wrapMetricLabels(labels), formatMetricValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrapMetricLabels(joinMetricLabels(labels, `le="`+formatMetricValue(le)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", m.name, wrapMetricLabels(joinMetricLabels(labels, `le="+Inf"`)), formatMetricValue(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, wrapMetricLabels(labels), formatMetricValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", m.name, wrapMetricLabels(labels), formatMetricValue(s.value))
+	}
+}
+
+// formatMetricLabels 生成 name="value" 列表，以逗号连接
+func formatMetricLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeMetricLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinMetricLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapMetricLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// escapeMetricLabel 转义标签值中的反斜杠、双引号和换行
+func escapeMetricLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// escapeMetricHelp 转义说明中的反斜杠和换行
+func escapeMetricHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// formatMetricValue 数值的文本形式
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 已注册的指标
+var metricsRegistry []*metricVec
+
+// registerMetric 注册指标，/metrics 中按注册顺序输出
+func registerMetric(m *metricVec) *metricVec {
+	metricsRegistry = append(metricsRegistry, m)
+	return m
+}
+
+// writeMetrics 输出全部已注册的指标
+func writeMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range metricsRegistry {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// metricCookieLabel cookie_id 标签，未使用 Cookie 时为 none
+func metricCookieLabel(cookieID int64) string {
+	if cookieID == 0 {
+		return "none"
+	}
+	return strconv.FormatInt(cookieID, 10)
+}
+
+// metricProxyLabel proxy 标签，隐藏密码，直连时为 direct
+func metricProxyLabel(addr string) string {
+	if addr == "" {
+		return "direct"
+	}
+	return redactProxyAddr(addr)
+}
+
+// recordParseFailure 记录一次解析失败
+func recordParseFailure(domain, mode string) {
+	metricParseFailures.Inc(marketplaceFromDomain(domain), mode)
+}
+
+// recordTaskResult 记录任务结果，同时计入实例心跳的任务数
+func recordTaskResult(mode, domain string, success bool) {
+	instance.recordTask(success)
+	result := "success"
+	if !success {
+		result = "failed"
+	}
+	metricTasksProcessed.Inc(marketplaceFromDomain(domain), mode, result)
+}
+
+// handleMetrics 以 Prometheus 文本格式输出指标
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+	w.Header().Set("Content-Type", METRICS_CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	writeMetrics(w)
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"fmt"
-	"io"
 	"math/rand"
 	"net"
 	"net/http"
 	"time"
 
-	"golang.org/x/net/proxy"
+	log "github.com/tengfei-xy/go-log"
 )
 
 // BrowserProfile 完整的浏览器指纹配置（UA 和 sec-ch-ua 必须匹配）
@@ -130,205 +128,60 @@ func getBrowserProfileByID(id string) *BrowserProfile {
 	return &browserProfiles[0]
 }
 
-// HeaderProfile 请求头配置
-type HeaderProfile struct {
-	Accept         string
-	AcceptLanguage string
-	AcceptEncoding string
-	SecFetchDest   string
-	SecFetchMode   string
-	SecFetchSite   string
-	CacheControl   string
-}
-
-// 请求头库：15种不同的浏览器请求头配置
-var headerProfiles = []HeaderProfile{
-	// Chrome 120+ Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "max-age=0",
-	},
-	// Chrome 119 macOS
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9,zh-CN;q=0.8,zh;q=0.7",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "same-origin",
-		CacheControl:   "no-cache",
-	},
-	// Firefox 121 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.5",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "max-age=0",
-	},
-	// Firefox 120 Linux
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.7,es;q=0.3",
-		AcceptEncoding: "gzip, deflate",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "cross-site",
-		CacheControl:   "no-cache",
-	},
-	// Edge 120 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "max-age=0",
-	},
-	// Safari 17 macOS
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "max-age=0",
-	},
-	// Chrome 118 Android
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "same-origin",
-		CacheControl:   "no-cache",
-	},
-	// Chrome 117 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9,fr;q=0.8",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "max-age=0",
-	},
-	// Firefox 119 macOS
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.5",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "cross-site",
-		CacheControl:   "no-cache",
-	},
-	// Edge 119 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9,de;q=0.8",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "same-origin",
-		CacheControl:   "max-age=0",
-	},
-	// Chrome 116 Linux
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "no-cache",
-	},
-	// Safari 16 iOS
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9",
-		AcceptEncoding: "gzip, deflate",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "same-origin",
-		CacheControl:   "max-age=0",
-	},
-	// Firefox 118 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.5,ja;q=0.3",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "none",
-		CacheControl:   "no-cache",
-	},
-	// Chrome 115 macOS
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9,pt;q=0.8",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "cross-site",
-		CacheControl:   "max-age=0",
-	},
-	// Edge 118 Windows
-	{
-		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
-		AcceptLanguage: "en-US,en;q=0.9,it;q=0.8",
-		AcceptEncoding: "gzip, deflate, br",
-		SecFetchDest:   "document",
-		SecFetchMode:   "navigate",
-		SecFetchSite:   "same-origin",
-		CacheControl:   "no-cache",
-	},
+// currentProxyAddr 当前会话的代理地址
+// 优先使用 cookie 绑定的代理；尚未绑定（如未使用 cookie 的模式）时从代理池中选择评分最高的并在本会话内保持不变
+func (app *appConfig) currentProxyAddr() string {
+	if app.proxyAddr == "" {
+		if addr, ok := proxyPool.Pick("", nil); ok {
+			app.proxyAddr = addr
+		}
+	}
+	return app.proxyAddr
 }
 
-// get_random_header_profile 随机获取一个请求头配置
-func get_random_header_profile() HeaderProfile {
-	return headerProfiles[rangdom_range(len(headerProfiles))]
-}
+// 代理可达性检测，测试时可替换
+var proxyReachable = probeProxy
 
-func rangdom_range(max int) int {
-	rand.NewSource(time.Now().UnixNano())
-	return rand.Intn(max)
-}
-func get_socks5_proxy() (proxy.Dialer, error) {
-	// 创建一个SOCKS5代理拨号器
-	len := len(app.Proxy.Sockc5)
-	if len == 0 {
-		return nil, fmt.Errorf("没有可用的代理")
+// failoverProxy 绑定的代理不可达或已被熔断时，改绑到代理池中评分最高的其他可达代理
+// 同时更新 amc_cookie.proxy_addr 并在 amc_cookie_rebind 中记录，返回是否发生了切换
+func (app *appConfig) failoverProxy(cause error) bool {
+	if !app.Proxy.Enable || app.proxyAddr == "" {
+		return false
 	}
-	return proxy.SOCKS5("tcp", app.Proxy.Sockc5[rangdom_range(len)], nil, proxy.Direct)
-}
-func get_client() http.Client {
-
-	proxy, err := get_socks5_proxy()
-	if err != nil {
-		return http.Client{Timeout: time.Second * 60}
+	if proxyPool.Available(app.proxyAddr) && proxyReachable(app.proxyAddr) {
+		// 代理本身可用，属于其他网络问题，不切换
+		return false
+	}
+	next, ok := proxyPool.Pick(app.proxyAddr, proxyReachable)
+	if !ok {
+		log.Errorf("代理 %s 不可用，且没有其他可用的代理", redactProxyAddr(app.proxyAddr))
+		return false
 	}
-	if app.Proxy.Enable {
-		return http.Client{
-			Transport: &http.Transport{
-				Dial: proxy.Dial,
-			},
 
-			Timeout: time.Second * 60,
+	old := app.proxyAddr
+	app.proxyAddr = next
+	log.Warnf("代理 %s 不可用，cookie (id=%d) 改绑到 %s", redactProxyAddr(old), app.cookieID, redactProxyAddr(next))
+
+	if app.db == nil || app.cookieID == 0 {
+		return true
+	}
+	if _, err := app.db.Exec("UPDATE amc_cookie SET proxy_addr = ? WHERE id = ?", next, app.cookieID); err != nil {
+		log.Errorf("更新 cookie 代理失败 (id=%d): %v", app.cookieID, err)
+	}
+	reason := ""
+	if cause != nil {
+		reason = cause.Error()
+		if len(reason) > 255 {
+			reason = reason[:255]
 		}
-	} else {
-		return http.Client{Timeout: time.Second * 60}
 	}
+	if _, err := app.db.Exec(
+		"INSERT INTO amc_cookie_rebind(cookie_id, host_id, old_proxy, new_proxy, reason) VALUES(?,?,?,?,?)",
+		app.cookieID, app.Basic.Host_id, redactProxyAddr(old), redactProxyAddr(next), reason,
+	); err != nil {
+		log.Errorf("记录代理改绑失败 (id=%d): %v", app.cookieID, err)
+	}
+	return true
 }
 
 func telnet(ip string) bool {
@@ -344,55 +197,9 @@ func telnet(ip string) bool {
 		}
 	}
 }
-func request_get(url string, ua string) (string, error) {
-	client := get_client()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	// 随机选择一个请求头配置，模拟不同的浏览器
-	profile := get_random_header_profile()
-
-	// 设置请求头
-	req.Header.Set("User-Agent", ua)
-	req.Header.Set("Accept", profile.Accept)
-	req.Header.Set("Accept-Language", profile.AcceptLanguage)
-	req.Header.Set("Accept-Encoding", profile.AcceptEncoding)
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Sec-Fetch-Dest", profile.SecFetchDest)
-	req.Header.Set("Sec-Fetch-Mode", profile.SecFetchMode)
-	req.Header.Set("Sec-Fetch-Site", profile.SecFetchSite)
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Cache-Control", profile.CacheControl)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	resp_data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	return string(resp_data), nil
-}
-
-// setCommonHeaders 设置统一的请求头（使用绑定的浏览器指纹）
-func (app *appConfig) setCommonHeaders(req *http.Request) {
-	if app.browserProfile == nil {
-		// 如果没有浏览器指纹，随机选择一个（兜底逻辑）
-		app.browserProfile = getRandomBrowserProfile()
-	}
-
-	profile := app.browserProfile
 
+// setBrowserHeaders 按浏览器指纹设置请求头并携带 cookie
+func setBrowserHeaders(req *http.Request, profile *BrowserProfile, cookie string) {
 	// 设置核心浏览器指纹头部
 	req.Header.Set("User-Agent", profile.UserAgent)
 	req.Header.Set("Accept", profile.Accept)
@@ -435,5 +242,5 @@ func (app *appConfig) setCommonHeaders(req *http.Request) {
 	req.Header.Set("Sec-Fetch-User", "?1")
 
 	// 设置 Cookie
-	req.Header.Set("Cookie", app.cookie)
+	req.Header.Set("Cookie", cookie)
 }
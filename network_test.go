@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// listenProxy 启动一个只记录连接的 TCP 监听，用于确认客户端连向哪个代理
+func listenProxy(t *testing.T) (string, chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			hits <- struct{}{}
+			conn.Close()
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String(), hits
+}
+
+func TestFetchUsesSessionBoundProxy(t *testing.T) {
+	bound, boundHits := listenProxy(t)
+	other, otherHits := listenProxy(t)
+
+	oldProxy, oldAddr, oldReachable, oldPool, oldLimiter := app.Proxy, app.proxyAddr, proxyReachable, proxyPool, limiter
+	app.Proxy = Proxy{Enable: true, Sockc5: []string{other, bound}}
+	app.proxyAddr = bound
+	proxyReachable = func(string) bool { return true }
+	proxyPool = NewProxyPool(app.Proxy.Sockc5, 5, time.Minute)
+	limiter = newRateLimiter(RateLimitConfig{})
+	t.Cleanup(func() {
+		app.Proxy, app.proxyAddr, proxyReachable, proxyPool, limiter = oldProxy, oldAddr, oldReachable, oldPool, oldLimiter
+	})
+
+	f := NewHTTPFetcher(nil)
+	f.timeout, f.maxRetries = time.Second, 0
+	for i := 0; i < 3; i++ {
+		f.Fetch(context.Background(), &FetchRequest{URL: "http://www.amazon.com/", Mode: FETCH_MODE_PRODUCT, SkipRobots: true, NoCookie: true})
+	}
+	if len(boundHits) != 3 || len(otherHits) != 0 {
+		t.Fatalf("bound proxy hits = %d, other proxy hits = %d", len(boundHits), len(otherHits))
+	}
+}
+
+func TestFailoverProxyOnlyWhenBoundProxyUnreachable(t *testing.T) {
+	oldProxy, oldAddr, oldReachable, oldPool := app.Proxy, app.proxyAddr, proxyReachable, proxyPool
+	t.Cleanup(func() { app.Proxy, app.proxyAddr, proxyReachable, proxyPool = oldProxy, oldAddr, oldReachable, oldPool })
+
+	up := map[string]bool{"10.0.0.1:1080": true, "10.0.0.2:1080": true}
+	proxyReachable = func(addr string) bool { return up[addr] }
+	app.Proxy = Proxy{Enable: true, Sockc5: []string{"10.0.0.1:1080", "10.0.0.2:1080"}}
+	proxyPool = NewProxyPool(app.Proxy.Sockc5, 5, time.Minute)
+	app.proxyAddr = "10.0.0.1:1080"
+
+	if app.failoverProxy(fmt.Errorf("timeout")) {
+		t.Fatal("reachable proxy should not be rebound")
+	}
+
+	up["10.0.0.1:1080"] = false
+	if !app.failoverProxy(fmt.Errorf("connection refused")) {
+		t.Fatal("unreachable proxy should be rebound")
+	}
+	assertEqual(t, "proxy", app.proxyAddr, "10.0.0.2:1080")
+}
+
+func TestFetchUsesSessionProfileHeaders(t *testing.T) {
+	var gotUA, gotSecChUa string
+	srv := newTestFetcher(t, "User-agent: *\nAllow: /\n", func(w http.ResponseWriter, r *http.Request) {
+		gotUA, gotSecChUa = r.Header.Get("User-Agent"), r.Header.Get("sec-ch-ua")
+		fmt.Fprint(w, `<html><head><title>Product</title></head><body><span id="productTitle">Widget</span></body></html>`)
+	})
+	app.browserProfile = getBrowserProfileByID("firefox-121-win")
+
+	sess := app.beginSession(false)
+	assertEqual(t, "snapshot", sess.profile.ID, "firefox-121-win")
+	if _, err := fetcher.Fetch(context.Background(), &FetchRequest{URL: srv.URL + "/dp/B0FNMPQSJC", Mode: FETCH_MODE_PRODUCT}); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "user agent", gotUA, sess.profile.UserAgent)
+	assertEqual(t, "sec-ch-ua", gotSecChUa, "")
+}
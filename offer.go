@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 配送方式
+const (
+	FULFILLMENT_AMAZON = "AMZ" // 亚马逊自营（Amazon 销售并配送）
+	FULFILLMENT_FBA    = "FBA" // 第三方卖家，亚马逊配送
+	FULFILLMENT_FBM    = "FBM" // 第三方卖家自行配送
+)
+
+// InspectionOffer 商品的一个报价（All Offers Display 中的一行）
+type InspectionOffer struct {
+	SellerID    string `json:"seller_id"`
+	SellerName  string `json:"seller_name"`
+	Price       string `json:"price"`
+	Condition   string `json:"condition"`
+	ShipsFrom   string `json:"ships_from"`
+	Fulfillment string `json:"fulfillment"` // AMZ / FBA / FBM
+	BuyBox      bool   `json:"buy_box"`     // 是否为当前购物车报价
+}
+
+// InspectionSeller 购物车卖家及其店铺页信息
+type InspectionSeller struct {
+	SellerID     string `json:"seller_id"`
+	SellerName   string `json:"seller_name"`
+	BusinessName string `json:"business_name"`
+	Address      string `json:"address"`
+	TRN          string `json:"trn"`
+	FB1Month     int    `json:"fb_1month"`
+	FB3Month     int    `json:"fb_3month"`
+	FB12Month    int    `json:"fb_12month"`
+	FBLifetime   int    `json:"fb_lifetime"`
+}
+
+// offerListURL All Offers Display 的报价列表接口
+func offerListURL(domain, asin string) string {
+	return fmt.Sprintf("https://%s/gp/aod/ajax/ref=dp_aod_ALL_mbc?asin=%s&pc=dp&isonlyrenderofferlist=false&pageno=1", domain, url.QueryEscape(asin))
+}
+
+// fetchOffers 获取 ASIN 的全部报价，购物车报价排在第一位
+func fetchOffers(ctx context.Context, domain, asin, referer string) ([]InspectionOffer, error) {
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: offerListURL(domain, asin), Mode: FETCH_MODE_OFFER, Referer: referer})
+	if err != nil {
+		return nil, err
+	}
+	return parseOffers(page.Doc), nil
+}
+
+// parseOffers 解析报价列表，#aod-pinned-offer 为购物车报价，#aod-offer 为其他报价
+func parseOffers(doc *goquery.Document) []InspectionOffer {
+	offers := []InspectionOffer{}
+	doc.Find("#aod-pinned-offer, #aod-offer").Each(func(i int, s *goquery.Selection) {
+		offer := parseOffer(s)
+		if offer.Price == "" && offer.SellerName == "" {
+			return
+		}
+		offer.BuyBox = s.Is("#aod-pinned-offer")
+		offers = append(offers, offer)
+	})
+	return offers
+}
+
+// parseOffer 解析单个报价
+func parseOffer(s *goquery.Selection) InspectionOffer {
+	offer := InspectionOffer{
+		Price:     strings.TrimSpace(s.Find(".a-price .a-offscreen").First().Text()),
+		Condition: collapseSpaces(s.Find("#aod-offer-heading").First().Text()),
+		ShipsFrom: collapseSpaces(s.Find("#aod-offer-shipsFrom .a-color-base").First().Text()),
+	}
+	if offer.Price == "" {
+		whole := strings.TrimSpace(s.Find(".a-price-whole").First().Text())
+		fraction := strings.TrimSpace(s.Find(".a-price-fraction").First().Text())
+		if whole != "" {
+			offer.Price = strings.TrimSpace(s.Find(".a-price-symbol").First().Text()) + strings.TrimSuffix(whole, ".") + "." + fraction
+		}
+	}
+
+	soldBy := s.Find("#aod-offer-soldBy").First()
+	if link := soldBy.Find("a[href*='seller=']").First(); link.Length() > 0 {
+		href, _ := link.Attr("href")
+		offer.SellerID = extractSellerID(href)
+		offer.SellerName = collapseSpaces(link.Text())
+	} else {
+		offer.SellerName = collapseSpaces(soldBy.Find(".a-color-base").First().Text())
+	}
+	offer.Fulfillment = offerFulfillment(offer.SellerName, offer.ShipsFrom)
+	return offer
+}
+
+// offerFulfillment 根据卖家和发货方判断配送方式
+func offerFulfillment(sellerName, shipsFrom string) string {
+	soldByAmazon := strings.HasPrefix(strings.ToLower(sellerName), "amazon")
+	shipsFromAmazon := strings.HasPrefix(strings.ToLower(shipsFrom), "amazon")
+	switch {
+	case soldByAmazon && (shipsFromAmazon || shipsFrom == ""):
+		return FULFILLMENT_AMAZON
+	case shipsFromAmazon:
+		return FULFILLMENT_FBA
+	default:
+		return FULFILLMENT_FBM
+	}
+}
+
+// collapseSpaces 合并连续空白
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// fetchInspectionSeller 读取购物车卖家的店铺页信息
+func fetchInspectionSeller(ctx context.Context, domain, sellerID, sellerName string) (*InspectionSeller, error) {
+	sellerURL := fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", domain, url.QueryEscape(sellerID))
+	detail, err := fetchSellerDetailFromPage(ctx, sellerURL, &SellerInfo{SellerID: sellerID, SellerName: sellerName})
+	if err != nil {
+		return nil, err
+	}
+	return &InspectionSeller{
+		SellerID:     sellerID,
+		SellerName:   sellerName,
+		BusinessName: detail.Name,
+		Address:      detail.Address,
+		TRN:          detail.TRN,
+		FB1Month:     detail.FB1Month,
+		FB3Month:     detail.FB3Month,
+		FB12Month:    detail.FB12Month,
+		FBLifetime:   detail.FBLifetime,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestFindSellerLink(t *testing.T) {
+	link, href, ok := findSellerLink(loadPageFixture(t, "product_ok.html"))
+	if !ok {
+		t.Fatal("seller link not found")
+	}
+	assertEqual(t, "seller id", extractSellerID(href), "A1B2C3D4E5")
+	assertEqual(t, "seller name", strings.TrimSpace(link.Text()), "Lightdot Direct")
+
+	// 候选选择器都没有时遍历所有链接
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(`<a href="/help">Help</a><a href="/sp?seller=AFALLBACK1">Other</a>`))
+	if _, href, ok = findSellerLink(doc); !ok {
+		t.Fatal("fallback seller link not found")
+	}
+	assertEqual(t, "fallback", extractSellerID(href), "AFALLBACK1")
+
+	doc, _ = goquery.NewDocumentFromReader(strings.NewReader(`<a href="/help">Help</a>`))
+	if _, _, ok = findSellerLink(doc); ok {
+		t.Error("found seller link on page without one")
+	}
+}
+
+func TestParseOffers(t *testing.T) {
+	offers := parseOffers(loadPageFixture(t, "offers_ok.html"))
+	if len(offers) != 3 {
+		t.Fatalf("len(offers) = %d, want 3", len(offers))
+	}
+
+	want := []InspectionOffer{
+		{SellerID: "A1B2C3D4E5", SellerName: "Lightdot Direct", Price: "$199.99", Condition: "New", ShipsFrom: "Amazon", Fulfillment: FULFILLMENT_FBA, BuyBox: true},
+		{SellerID: "AXYZ987654", SellerName: "Lumen Outlet", Price: "$149.50", Condition: "Used - Like New", ShipsFrom: "Lumen Outlet", Fulfillment: FULFILLMENT_FBM},
+		{SellerName: "Amazon.com", Price: "$205.00", Condition: "New", ShipsFrom: "Amazon.com", Fulfillment: FULFILLMENT_AMAZON},
+	}
+	for i, w := range want {
+		if offers[i] != w {
+			t.Errorf("offers[%d] = %+v, want %+v", i, offers[i], w)
+		}
+	}
+}
+
+func TestOfferFulfillment(t *testing.T) {
+	cases := []struct {
+		seller, shipsFrom, want string
+	}{
+		{"Amazon.com", "Amazon.com", FULFILLMENT_AMAZON},
+		{"Amazon", "", FULFILLMENT_AMAZON},
+		{"Lightdot Direct", "Amazon", FULFILLMENT_FBA},
+		{"Lightdot Direct", "Lightdot Direct", FULFILLMENT_FBM},
+		{"Amazon Resale", "Lumen Outlet", FULFILLMENT_FBM},
+	}
+	for _, c := range cases {
+		assertEqual(t, c.seller+"/"+c.shipsFrom, offerFulfillment(c.seller, c.shipsFrom), c.want)
+	}
+}
+
+// newInspectionTestServer 返回商品页、店铺页和报价列表的测试服务
+func newInspectionTestServer(t *testing.T, robotsTxt string) (host string) {
+	t.Helper()
+	page := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", "pages", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	srv := newTestFetcher(t, robotsTxt, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/dp/"):
+			w.Write(page("product_ok.html"))
+		case r.URL.Path == "/sp":
+			w.Write(page("seller_ok.html"))
+		case strings.HasPrefix(r.URL.Path, "/gp/aod/ajax"):
+			if r.URL.Query().Get("asin") != "B0DKF7HNZX" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(page("offers_ok.html"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	u, _ := url.Parse(srv.URL)
+	return u.Host
+}
+
+func TestInspectItemWithSellerAndOffers(t *testing.T) {
+	host := newInspectionTestServer(t, "User-agent: *\nAllow: /\n")
+	item := LinkInspectionItem{Original: "B0DKF7HNZX", URL: "https://" + host + "/dp/B0DKF7HNZX", ASIN: "B0DKF7HNZX", Domain: host}
+
+	inspector := NewLinkInspector("", host, "")
+	result := inspector.inspectItem(context.Background(), item)
+	if result.Seller != nil || result.Offers != nil {
+		t.Fatal("enrichment returned without options")
+	}
+
+	inspector.options = ASINInspectionOptions{IncludeOffer: true, IncludeSeller: true}
+	result = inspector.inspectItem(context.Background(), item)
+	assertEqual(t, "error", result.ErrorMessage, "")
+	assertEqual(t, "seller error", result.SellerError, "")
+	assertEqual(t, "offer error", result.OfferError, "")
+	if result.Seller == nil {
+		t.Fatal("seller is nil")
+	}
+	assertEqual(t, "seller id", result.Seller.SellerID, "A1B2C3D4E5")
+	assertEqual(t, "seller name", result.Seller.SellerName, "Lightdot Direct")
+	if !strings.HasPrefix(result.Seller.BusinessName, "Lightdot Ltd") {
+		t.Errorf("business name = %q", result.Seller.BusinessName)
+	}
+	assertEqual(t, "offers", strconv.Itoa(len(result.Offers)), "3")
+
+	apiItem := linkInspectionResultToAPIItem(result, "")
+	assertEqual(t, "api seller", apiItem.Seller.SellerID, "A1B2C3D4E5")
+	assertEqual(t, "api offers", strconv.Itoa(len(apiItem.Offers)), "3")
+}
+
+func TestInspectItemEnrichmentFailureKeepsResult(t *testing.T) {
+	host := newInspectionTestServer(t, "User-agent: *\nDisallow: /gp/aod/\nDisallow: /sp\n")
+	item := LinkInspectionItem{Original: "B0DKF7HNZX", URL: "https://" + host + "/dp/B0DKF7HNZX", ASIN: "B0DKF7HNZX", Domain: host}
+
+	inspector := NewLinkInspector("", host, "")
+	inspector.options = ASINInspectionOptions{IncludeOffer: true, IncludeSeller: true}
+	result := inspector.inspectItem(context.Background(), item)
+	assertEqual(t, "error", result.ErrorMessage, "")
+	if result.OfferError == "" || result.SellerError == "" {
+		t.Fatalf("enrichment errors not recorded: seller=%q offer=%q", result.SellerError, result.OfferError)
+	}
+	// 店铺页读取失败时仍返回商品页上的卖家
+	if result.Seller == nil || result.Seller.SellerID != "A1B2C3D4E5" {
+		t.Errorf("seller = %+v", result.Seller)
+	}
+}
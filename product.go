@@ -1,8 +1,7 @@
 package main
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 	"net/url"
 	"strings"
 
@@ -31,7 +30,7 @@ const MYSQL_PRODUCT_STATUS_ERROR_OVER int = 3
 const MYSQL_PRODUCT_STATUS_NO_PRODUCT int = 4
 const MYSQL_PRODUCT_STATUS_FROM_SEARCH int = 5 // 从搜索页获取的产品暂时不做查询
 
-func (product *productStruct) main() error {
+func (product *productStruct) main(ctx context.Context) error {
 	if !app.Exec.Enable.Product {
 		log.Warn("跳过 产品")
 		return nil
@@ -50,18 +49,21 @@ func (product *productStruct) main() error {
 	app.Exec.Loop.product_time++
 
 	app.update(MYSQL_APPLICATION_STATUS_PRODUCT)
+	defer instance.beginTask("product")()
 
-	_, err := app.db.Exec("UPDATE amc_product SET status = ? ,app = ? WHERE (status = ? or status=?) and (app=? or app=?)  LIMIT 1000", MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, MYSQL_PRODUCT_STATUS_INSERT, MYSQL_PRODUCT_STATUS_ERROR_OVER, 0, app.Basic.App_id)
+	_, err := app.db.ExecContext(ctx, "UPDATE amc_product SET status = ? ,app = ?, "+CLAIM_LEASE_SET+" WHERE (status = ? or status=?) and (app=? or app=?) and domain = ? LIMIT 1000", MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, app.Claim.Lease_seconds, MYSQL_PRODUCT_STATUS_INSERT, MYSQL_PRODUCT_STATUS_ERROR_OVER, 0, app.Basic.App_id, app.Domain)
 	if err != nil {
 		log.Errorf("更新product表失败,%v", err)
 		return err
 	}
+	defer keepClaims(ctx, "商品", renewProductClaims)()
 
-	row, err := app.db.Query(`select id,url,param,keyword from amc_product where status=? and app = ?`, MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id)
+	row, err := app.db.QueryContext(ctx, `select id,url,param,keyword from amc_product where status=? and app = ? and domain = ?`, MYSQL_PRODUCT_STATUS_CHEKCK, app.Basic.App_id, app.Domain)
 	if err != nil {
 		log.Errorf("查询product表失败,%v", err)
 		return err
 	}
+	defer row.Close()
 	for row.Next() {
 		var primary_id int64
 		var url, param, keyword string
@@ -73,42 +75,35 @@ func (product *productStruct) main() error {
 			continue
 		}
 		url = "https://" + app.Domain + url + param
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, url); err != nil {
-			log.Errorf("%v", err)
-			continue
-		}
 
 		log.Infof("查找商品链接 ID:%d url:%s", primary_id, url)
 
-		// 添加请求间隔
-		SmartDelay("normal")
-
-		err := product.request(url)
+		err := product.request(ctx, url)
 		if err != nil {
-			if err == ERROR_NOT_SELLER_URL {
+			if ctx.Err() != nil {
+				// 收到退出信号，当前商品保持认领状态，退出时统一释放
+				break
+			} else if err == ERROR_NOT_SELLER_URL {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_NO_PRODUCT, "", "", "")
 				continue
+			} else if isRobotsDisallow(err) {
+				log.Errorf("%v", err)
+				continue
 			} else if err == ERROR_NOT_404 || err == ERROR_NOT_503 {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
-				SmartDelay("error")
 				continue
-			} else if err == ERROR_VERIFICATION {
+			} else if isCookieRejected(err) {
 				// Cookie 失效，标记失效并尝试获取新的
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
 				if err := app.handleCookieInvalid(); err != nil {
 					log.Errorf("处理 cookie 失效失败: %v", err)
-				} else {
-					RotateFingerprint()
 				}
-				SmartDelay("captcha")
 				continue
 			} else {
 				product.update_status(primary_id, MYSQL_PRODUCT_STATUS_ERROR_OVER, "", "", "")
 				log.Error(err)
-				SmartDelay("error")
 				continue
 
 			}
@@ -150,94 +145,19 @@ func (product *productStruct) main() error {
 	return nil
 }
 
-func (product *productStruct) request(url string) error {
-	client := get_client()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-
-	if _, err := app.get_cookie(); err != nil {
-		log.Error(err)
-	}
-	app.setCommonHeaders(req)
-	if referer := GetRandomReferer(app.Domain); referer != "" {
-		req.Header.Set("Referer", referer)
-	}
-
-	resp, err := client.Do(req)
+func (product *productStruct) request(ctx context.Context, url string) error {
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: url, Mode: FETCH_MODE_PRODUCT})
 	if err != nil {
-		log.Errorf("内部错误:%v", err)
-		return err
-
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		log.Errorf("状态码:%d", resp.StatusCode)
 		return err
 	}
+	doc := page.Doc
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return fmt.Errorf("内部错误:%v", err)
-	}
-
-	if doc.Find("h4").First().Text() == "Enter the characters you see below" {
-		return ERROR_VERIFICATION
-	}
-
-	// 提取卖家链接 - 尝试多个选择器
-	var sellerLink *goquery.Selection
-	selectors := []string{
-		"a[id=sellerProfileTriggerId]",
-		"a#sellerProfileTriggerId",
-		"#sellerProfileTriggerId",
-		"div#merchant-info a",
-		"div#tabular-buybox-container a",
-		"#merchant-info a",
-		"a[href*='seller=']",
-		"span.tabular-buybox-text a",
-		"div.tabular-buybox-container a",
-		"#vse-seller-link",
-	}
-
-	var foundLink bool
-	for _, selector := range selectors {
-		doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-			if foundLink {
-				return
-			}
-			href, exist := s.Attr("href")
-			if exist && strings.Contains(href, "seller=") {
-				sellerLink = s
-				product.url = href
-				foundLink = true
-			}
-		})
-		if foundLink {
-			break
-		}
-	}
-
-	// 兜底方案：遍历所有 a 标签寻找包含 seller= 的链接
-	if !foundLink {
-		doc.Find("a").Each(func(i int, s *goquery.Selection) {
-			if foundLink {
-				return
-			}
-			href, exist := s.Attr("href")
-			if exist && strings.Contains(href, "seller=") {
-				sellerLink = s
-				product.url = href
-				foundLink = true
-			}
-		})
-	}
-
-	if !foundLink {
+	// 提取卖家链接
+	sellerLink, href, ok := findSellerLink(doc)
+	if !ok {
 		return ERROR_NOT_SELLER_URL
 	}
+	product.url = href
 
 	sellerName := strings.TrimSpace(sellerLink.Text())
 	if sellerName != "" {
@@ -293,6 +213,40 @@ func (product *productStruct) request(url string) error {
 	return nil
 }
 
+// sellerLinkSelectors 商品页中购物车卖家链接的候选选择器，按优先级排列
+var sellerLinkSelectors = []string{
+	"a[id=sellerProfileTriggerId]",
+	"a#sellerProfileTriggerId",
+	"#sellerProfileTriggerId",
+	"div#merchant-info a",
+	"div#tabular-buybox-container a",
+	"#merchant-info a",
+	"a[href*='seller=']",
+	"span.tabular-buybox-text a",
+	"div.tabular-buybox-container a",
+	"#vse-seller-link",
+}
+
+// findSellerLink 查找商品页中的卖家链接（href 含 seller=）
+// 候选选择器都找不到时遍历所有 a 标签兜底
+func findSellerLink(doc *goquery.Document) (link *goquery.Selection, href string, ok bool) {
+	match := func(i int, s *goquery.Selection) bool {
+		h, exist := s.Attr("href")
+		if exist && strings.Contains(h, "seller=") {
+			link, href = s, h
+			return false
+		}
+		return true
+	}
+	for _, selector := range sellerLinkSelectors {
+		if doc.Find(selector).EachWithBreak(match); link != nil {
+			return link, href, true
+		}
+	}
+	doc.Find("a").EachWithBreak(match)
+	return link, href, link != nil
+}
+
 // get_seller_id 从 URL 中提取 seller ID
 func (product *productStruct) get_seller_id() string {
 	if product.url == "" {
@@ -329,7 +283,7 @@ func (product *productStruct) get_seller_id() string {
 
 // insert_selll_id 插入卖家信息到数据库
 func (product *productStruct) insert_selll_id(sellerID, sellerName, keyword string) error {
-	_, err := app.db.Exec("insert into amc_seller (seller_id,seller_name,keyword,app_id) values(?,?,?,?)", sellerID, sellerName, keyword, 0)
+	_, err := app.db.Exec("insert into amc_seller (seller_id,seller_name,keyword,domain,app_id) values(?,?,?,?,?)", sellerID, sellerName, keyword, app.Domain, 0)
 	return err
 }
 
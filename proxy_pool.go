@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 代理熔断状态
+const (
+	PROXY_CIRCUIT_CLOSED    = "closed"    // 正常使用
+	PROXY_CIRCUIT_OPEN      = "open"      // 熔断中，不参与轮换
+	PROXY_CIRCUIT_HALF_OPEN = "half_open" // 熔断期满，允许试探请求
+)
+
+// ProxyStatus 代理状态快照，用于 API 和日志
+type ProxyStatus struct {
+	Addr                string  `json:"addr"`
+	State               string  `json:"state"`
+	Requests            int64   `json:"requests"`
+	Successes           int64   `json:"successes"`
+	Failures            int64   `json:"failures"`
+	Throttled           int64   `json:"throttled"`
+	SuccessRate         float64 `json:"success_rate"`
+	ThrottleRate        float64 `json:"throttle_rate"`
+	AvgLatencyMs        float64 `json:"avg_latency_ms"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	LastProbeAt         string  `json:"last_probe_at,omitempty"`
+	LastProbeOK         bool    `json:"last_probe_ok"`
+	OpenUntil           string  `json:"open_until,omitempty"`
+	Score               float64 `json:"score"`
+}
+
+type proxyEntry struct {
+	addr                string
+	state               string
+	requests            int64
+	successes           int64
+	failures            int64 // 网络错误、探测失败
+	throttled           int64 // 503
+	latencyMs           float64
+	consecutiveFailures int
+	openedAt            time.Time
+	lastProbe           time.Time
+	lastProbeOK         bool
+}
+
+// ProxyPool 代理池：后台探测、按成功率/延迟/503 比例评分，连续失败时熔断
+type ProxyPool struct {
+	mu        sync.Mutex
+	entries   map[string]*proxyEntry
+	order     []string
+	threshold int           // 连续失败多少次后熔断
+	openFor   time.Duration // 熔断持续时间，期满后进入半开
+	now       func() time.Time
+	probe     func(addr string) bool
+}
+
+var proxyPool = NewProxyPool(nil, 5, 5*time.Minute)
+
+// NewProxyPool 创建代理池
+func NewProxyPool(addrs []string, threshold int, openFor time.Duration) *ProxyPool {
+	p := &ProxyPool{
+		entries:   make(map[string]*proxyEntry),
+		threshold: threshold,
+		openFor:   openFor,
+		now:       time.Now,
+		probe:     probeProxy,
+	}
+	for _, addr := range addrs {
+		p.entryLocked(addr)
+	}
+	return p
+}
+
+// entryLocked 获取代理记录，不存在时创建（如数据库中绑定了配置之外的代理）
+func (p *ProxyPool) entryLocked(addr string) *proxyEntry {
+	e, ok := p.entries[addr]
+	if !ok {
+		e = &proxyEntry{addr: addr, state: PROXY_CIRCUIT_CLOSED}
+		p.entries[addr] = e
+		p.order = append(p.order, addr)
+	}
+	return e
+}
+
+// RecordSuccess 记录一次成功请求
+func (p *ProxyPool) RecordSuccess(addr string, latency time.Duration) {
+	if addr == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.entryLocked(addr)
+	e.requests++
+	e.successes++
+	e.consecutiveFailures = 0
+	ms := float64(latency) / float64(time.Millisecond)
+	if e.latencyMs == 0 {
+		e.latencyMs = ms
+	} else {
+		e.latencyMs = 0.8*e.latencyMs + 0.2*ms
+	}
+	if e.state == PROXY_CIRCUIT_HALF_OPEN {
+		e.state = PROXY_CIRCUIT_CLOSED
+		log.Infof("代理 %s 试探成功，恢复使用", redactProxyAddr(addr))
+	}
+}
+
+// RecordFailure 记录一次失败请求，throttled 表示亚马逊返回 503
+func (p *ProxyPool) RecordFailure(addr string, throttled bool) {
+	if addr == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.entryLocked(addr)
+	e.requests++
+	if throttled {
+		e.throttled++
+	} else {
+		e.failures++
+	}
+	p.failLocked(e)
+}
+
+func (p *ProxyPool) failLocked(e *proxyEntry) {
+	e.consecutiveFailures++
+	switch e.state {
+	case PROXY_CIRCUIT_HALF_OPEN:
+		p.openLocked(e)
+	case PROXY_CIRCUIT_CLOSED:
+		if e.consecutiveFailures >= p.threshold {
+			p.openLocked(e)
+		}
+	}
+}
+
+func (p *ProxyPool) openLocked(e *proxyEntry) {
+	e.state = PROXY_CIRCUIT_OPEN
+	e.openedAt = p.now()
+	log.Warnf("代理 %s 连续失败 %d 次，熔断 %s", redactProxyAddr(e.addr), e.consecutiveFailures, p.openFor)
+}
+
+// Available 代理是否可以使用，熔断期满的代理转为半开状态
+func (p *ProxyPool) Available(addr string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.availableLocked(p.entryLocked(addr))
+}
+
+func (p *ProxyPool) availableLocked(e *proxyEntry) bool {
+	if e.state == PROXY_CIRCUIT_OPEN && p.now().Sub(e.openedAt) >= p.openFor {
+		e.state = PROXY_CIRCUIT_HALF_OPEN
+		log.Infof("代理 %s 熔断期满，进入半开状态", redactProxyAddr(e.addr))
+	}
+	return e.state != PROXY_CIRCUIT_OPEN
+}
+
+// scoreLocked 代理评分：平滑成功率为主，扣除 503 比例和延迟
+func (p *ProxyPool) scoreLocked(e *proxyEntry) float64 {
+	score := float64(e.successes+1) / float64(e.requests+2)
+	if e.requests > 0 {
+		score -= 0.5 * float64(e.throttled) / float64(e.requests)
+	}
+	latencyPenalty := e.latencyMs / 10000
+	if latencyPenalty > 0.3 {
+		latencyPenalty = 0.3
+	}
+	score -= latencyPenalty
+	if !e.lastProbe.IsZero() && !e.lastProbeOK {
+		score -= 0.2
+	}
+	return score
+}
+
+// Pick 选出评分最高的可用代理，exclude 为需要排除的地址，reachable 不为空时额外检查可达性
+func (p *ProxyPool) Pick(exclude string, reachable func(string) bool) (string, bool) {
+	p.mu.Lock()
+	type candidate struct {
+		addr  string
+		score float64
+	}
+	var candidates []candidate
+	for _, addr := range p.order {
+		e := p.entries[addr]
+		if addr == exclude || !p.availableLocked(e) {
+			continue
+		}
+		candidates = append(candidates, candidate{addr, p.scoreLocked(e)})
+	}
+	p.mu.Unlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, c := range candidates {
+		if reachable == nil || reachable(c.addr) {
+			return c.addr, true
+		}
+	}
+	return "", false
+}
+
+// ProbeAll 探测所有代理的连通性，探测失败计入连续失败次数
+func (p *ProxyPool) ProbeAll() {
+	p.mu.Lock()
+	addrs := append([]string(nil), p.order...)
+	p.mu.Unlock()
+
+	for _, addr := range addrs {
+		ok := p.probe(addr)
+		p.mu.Lock()
+		e := p.entryLocked(addr)
+		e.lastProbe = p.now()
+		e.lastProbeOK = ok
+		if !ok {
+			e.failures++
+			p.failLocked(e)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// StartProbing 后台定时探测，ctx 取消后退出
+func (p *ProxyPool) StartProbing(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		p.ProbeAll()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.ProbeAll()
+			}
+		}
+	}()
+}
+
+// Snapshot 返回所有代理的状态
+func (p *ProxyPool) Snapshot() []ProxyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]ProxyStatus, 0, len(p.order))
+	for _, addr := range p.order {
+		e := p.entries[addr]
+		p.availableLocked(e)
+		s := ProxyStatus{
+			Addr:                redactProxyAddr(addr),
+			State:               e.state,
+			Requests:            e.requests,
+			Successes:           e.successes,
+			Failures:            e.failures,
+			Throttled:           e.throttled,
+			AvgLatencyMs:        e.latencyMs,
+			ConsecutiveFailures: e.consecutiveFailures,
+			LastProbeOK:         e.lastProbeOK,
+			Score:               p.scoreLocked(e),
+		}
+		if e.requests > 0 {
+			s.SuccessRate = float64(e.successes) / float64(e.requests)
+			s.ThrottleRate = float64(e.throttled) / float64(e.requests)
+		}
+		if !e.lastProbe.IsZero() {
+			s.LastProbeAt = e.lastProbe.Format(time.RFC3339)
+		}
+		if e.state == PROXY_CIRCUIT_OPEN {
+			s.OpenUntil = e.openedAt.Add(p.openFor).Format(time.RFC3339)
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// LogSummary 输出代理池汇总
+func (p *ProxyPool) LogSummary() {
+	list := p.Snapshot()
+	if len(list) == 0 {
+		return
+	}
+	log.Infof("代理池汇总:")
+	for _, s := range list {
+		log.Infof("  %s 状态:%s 请求:%d 成功率:%.2f 503比例:%.2f 平均延迟:%.0fms",
+			s.Addr, s.State, s.Requests, s.SuccessRate, s.ThrottleRate, s.AvgLatencyMs)
+	}
+}
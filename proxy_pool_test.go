@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestProxyPool 使用可控时钟和探测结果的代理池
+func newTestProxyPool(addrs ...string) (*ProxyPool, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewProxyPool(addrs, 3, time.Minute)
+	p.now = func() time.Time { return now }
+	p.probe = func(string) bool { return true }
+	return p, &now
+}
+
+func TestProxyPoolCircuitBreaker(t *testing.T) {
+	p, now := newTestProxyPool("10.0.0.1:1080")
+	addr := "10.0.0.1:1080"
+
+	p.RecordFailure(addr, true)
+	p.RecordFailure(addr, false)
+	if !p.Available(addr) {
+		t.Fatal("proxy should stay closed below the threshold")
+	}
+	p.RecordFailure(addr, false)
+	if p.Available(addr) {
+		t.Fatal("proxy should be open after 3 consecutive failures")
+	}
+
+	*now = now.Add(time.Minute)
+	if !p.Available(addr) {
+		t.Fatal("proxy should be half-open after the open duration")
+	}
+	assertEqual(t, "state", p.Snapshot()[0].State, PROXY_CIRCUIT_HALF_OPEN)
+
+	// 半开状态下一次失败立即重新熔断
+	p.RecordFailure(addr, false)
+	if p.Available(addr) {
+		t.Fatal("failed trial should reopen the circuit")
+	}
+
+	*now = now.Add(time.Minute)
+	p.Available(addr)
+	p.RecordSuccess(addr, 100*time.Millisecond)
+	assertEqual(t, "state", p.Snapshot()[0].State, PROXY_CIRCUIT_CLOSED)
+}
+
+func TestProxyPoolSuccessResetsConsecutiveFailures(t *testing.T) {
+	p, _ := newTestProxyPool("10.0.0.1:1080")
+	addr := "10.0.0.1:1080"
+	for i := 0; i < 10; i++ {
+		p.RecordFailure(addr, false)
+		p.RecordFailure(addr, false)
+		p.RecordSuccess(addr, time.Second)
+	}
+	if !p.Available(addr) {
+		t.Fatal("non-consecutive failures should not open the circuit")
+	}
+}
+
+func TestProxyPoolPickByScore(t *testing.T) {
+	p, _ := newTestProxyPool("10.0.0.1:1080", "10.0.0.2:1080", "10.0.0.3:1080")
+	for i := 0; i < 5; i++ {
+		p.RecordSuccess("10.0.0.1:1080", 2*time.Second)
+		p.RecordSuccess("10.0.0.2:1080", 200*time.Millisecond)
+	}
+	p.RecordFailure("10.0.0.3:1080", true)
+
+	got, ok := p.Pick("", nil)
+	if !ok {
+		t.Fatal("no proxy picked")
+	}
+	assertEqual(t, "lower latency wins", got, "10.0.0.2:1080")
+
+	got, _ = p.Pick("10.0.0.2:1080", nil)
+	assertEqual(t, "exclude", got, "10.0.0.1:1080")
+
+	got, _ = p.Pick("", func(addr string) bool { return addr == "10.0.0.3:1080" })
+	assertEqual(t, "reachable", got, "10.0.0.3:1080")
+
+	for i := 0; i < 3; i++ {
+		p.RecordFailure("10.0.0.2:1080", false)
+	}
+	got, _ = p.Pick("", nil)
+	assertEqual(t, "open proxy skipped", got, "10.0.0.1:1080")
+}
+
+func TestProxyPoolProbeOpensUnreachable(t *testing.T) {
+	p, _ := newTestProxyPool("10.0.0.1:1080", "10.0.0.2:1080")
+	p.probe = func(addr string) bool { return addr == "10.0.0.1:1080" }
+	for i := 0; i < 3; i++ {
+		p.ProbeAll()
+	}
+	if p.Available("10.0.0.2:1080") {
+		t.Fatal("proxy failing every probe should be open")
+	}
+	if !p.Available("10.0.0.1:1080") {
+		t.Fatal("reachable proxy should stay closed")
+	}
+}
+
+func TestHandleProxies(t *testing.T) {
+	oldPool := proxyPool
+	t.Cleanup(func() { proxyPool = oldPool })
+	proxyPool, _ = newTestProxyPool("10.0.0.1:1080")
+	proxyPool.RecordSuccess("10.0.0.1:1080", 150*time.Millisecond)
+	proxyPool.RecordFailure("10.0.0.1:1080", true)
+
+	rr := httptest.NewRecorder()
+	handleProxies(rr, httptest.NewRequest(http.MethodGet, "/api/proxies", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	var resp struct {
+		Data struct {
+			Proxies []ProxyStatus `json:"proxies"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Proxies) != 1 {
+		t.Fatalf("proxies = %+v", resp.Data.Proxies)
+	}
+	s := resp.Data.Proxies[0]
+	if s.Requests != 2 || s.Throttled != 1 || s.ThrottleRate != 0.5 || s.State != PROXY_CIRCUIT_CLOSED {
+		t.Fatalf("status = %+v", s)
+	}
+
+	rr = httptest.NewRecorder()
+	handleProxies(rr, httptest.NewRequest(http.MethodPost, "/api/proxies", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d", rr.Code)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 限速惩罚场景
+const (
+	RATE_PENALTY_ERROR   = "error"   // 网络错误
+	RATE_PENALTY_503     = "503"     // 亚马逊限流
+	RATE_PENALTY_CAPTCHA = "captcha" // 验证码/登录墙
+)
+
+// RateLimitConfig 请求限速配置
+// 每个亚马逊站点（可选再按 cookie 细分）一个令牌桶，所有抓取请求都需先取得令牌
+type RateLimitConfig struct {
+	Rate            float64 `yaml:"rate"`            // 每秒请求数，默认 0.2（平均 5 秒一次）
+	Burst           int     `yaml:"burst"`           // 令牌桶容量，允许的突发请求数，默认 1
+	Per_cookie      bool    `yaml:"per_cookie"`      // 是否按 站点+cookie 分别限速
+	Penalty_error   int     `yaml:"penalty_error"`   // 网络错误后暂停秒数，默认 60
+	Penalty_503     int     `yaml:"penalty_503"`     // 503 后暂停秒数，默认 120
+	Penalty_captcha int     `yaml:"penalty_captcha"` // 验证码/登录墙后暂停秒数，默认 240
+	Penalty_max     int     `yaml:"penalty_max"`     // 连续惩罚时暂停时间逐次翻倍，最长秒数，默认 1800
+}
+
+// withDefaults 未配置的项使用默认值
+func (c RateLimitConfig) withDefaults() RateLimitConfig {
+	if c.Rate <= 0 {
+		c.Rate = 0.2
+	}
+	setDefault := func(v *int, d int) {
+		if *v <= 0 {
+			*v = d
+		}
+	}
+	setDefault(&c.Burst, 1)
+	setDefault(&c.Penalty_error, 60)
+	setDefault(&c.Penalty_503, 120)
+	setDefault(&c.Penalty_captcha, 240)
+	setDefault(&c.Penalty_max, 1800)
+	return c
+}
+
+// penalty 场景对应的基础暂停时间
+func (c RateLimitConfig) penalty(scenario string) time.Duration {
+	switch scenario {
+	case RATE_PENALTY_503:
+		return seconds(c.Penalty_503)
+	case RATE_PENALTY_CAPTCHA:
+		return seconds(c.Penalty_captcha)
+	default:
+		return seconds(c.Penalty_error)
+	}
+}
+
+// tokenBucket 单个限速对象的状态
+type tokenBucket struct {
+	domain      string
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time // 惩罚暂停截止时间
+	pausedFor   string    // 惩罚场景，见 RATE_PENALTY_*
+	strikes     int       // 连续惩罚次数
+}
+
+// crawlDelay 站点的最小请求间隔，同一站点下的所有 cookie 共享
+type crawlDelay struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// rateLimiter 按键（站点或 站点+cookie）限速
+type rateLimiter struct {
+	mu      sync.Mutex
+	cfg     RateLimitConfig
+	buckets map[string]*tokenBucket
+	delays  map[string]*crawlDelay // 按站点的最小请求间隔（robots.txt 的 Crawl-delay）
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// 全局限速器，init_config 中按配置重建；Rate 为 0 时不限速（测试时使用）
+var limiter = newRateLimiter(RateLimitConfig{})
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*tokenBucket),
+		delays:  make(map[string]*crawlDelay),
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+}
+
+// limiterKey 限速键，开启 per_cookie 时按 站点+cookie 区分，格式为 站点#cookieID
+func limiterKey(domain string, cookieID int64) string {
+	if limiter.cfg.Per_cookie && cookieID != 0 {
+		return fmt.Sprintf("%s#%d", domain, cookieID)
+	}
+	return domain
+}
+
+func (l *rateLimiter) bucketLocked(key string) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		domain, _, _ := strings.Cut(key, "#")
+		b = &tokenBucket{domain: domain, tokens: float64(l.cfg.Burst), last: l.now()}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// reserveLocked 尝试取得令牌，取不到时返回需要等待的时间和等待的场景（DELAY_SCENARIO_* 或惩罚场景）
+func (l *rateLimiter) reserveLocked(b *tokenBucket) (time.Duration, string) {
+	now := l.now()
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now), b.pausedFor
+	}
+	delay := l.delays[b.domain]
+	if delay != nil && now.Before(delay.next) {
+		return delay.next.Sub(now), DELAY_SCENARIO_CRAWL_DELAY
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.cfg.Rate
+	if b.tokens > float64(l.cfg.Burst) {
+		b.tokens = float64(l.cfg.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		if delay != nil {
+			delay.next = now.Add(delay.interval)
+		}
+		return 0, ""
+	}
+	return time.Duration((1 - b.tokens) / l.cfg.Rate * float64(time.Second)), DELAY_SCENARIO_NORMAL
+}
+
+// Wait 阻塞直到 key 可以发出下一次请求，ctx 取消时返回错误
+func (l *rateLimiter) Wait(ctx context.Context, key string) error {
+	if l.cfg.Rate <= 0 {
+		return ctx.Err()
+	}
+	for {
+		l.mu.Lock()
+		b := l.bucketLocked(key)
+		wait, scenario := l.reserveLocked(b)
+		l.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		if wait >= time.Second {
+			log.Infof("限速等待 %s (%s)", wait.Round(time.Second), key)
+		}
+		metricDelay.Observe(wait.Seconds(), marketplaceFromDomain(b.domain), scenario)
+		if err := l.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Reserve 不等待地尝试取得令牌，返回 0 表示可以请求，否则为需要等待的时间
+func (l *rateLimiter) Reserve(key string) time.Duration {
+	if l.cfg.Rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wait, _ := l.reserveLocked(l.bucketLocked(key))
+	return wait
+}
+
+// Penalize 遇到错误、503 或验证码后暂停 key 的请求，连续惩罚时暂停时间逐次翻倍
+func (l *rateLimiter) Penalize(key, scenario string) {
+	if l.cfg.Rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucketLocked(key)
+	b.strikes++
+	d := l.cfg.penalty(scenario)
+	limit := seconds(l.cfg.Penalty_max)
+	for i := 1; i < b.strikes && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	b.pausedUntil = l.now().Add(d)
+	b.pausedFor = scenario
+	log.Warnf("请求受限(%s)，%s 暂停 %s", scenario, key, d)
+}
+
+// Success 请求成功后清零连续惩罚次数
+func (l *rateLimiter) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.strikes = 0
+	}
+}
+
+// SetMinInterval 设置站点两次请求的最小间隔，不影响令牌桶速率
+func (l *rateLimiter) SetMinInterval(domain string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d <= 0 {
+		delete(l.delays, domain)
+		return
+	}
+	if delay, ok := l.delays[domain]; ok {
+		delay.interval = d
+		return
+	}
+	l.delays[domain] = &crawlDelay{interval: d}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestLimiter 使用虚拟时钟的限速器，sleep 只推进时钟并记录等待时间
+func newTestLimiter(cfg RateLimitConfig) (*rateLimiter, *[]time.Duration) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	l := newRateLimiter(cfg.withDefaults())
+	l.now = func() time.Time { return now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	return l, &waits
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	l, waits := newTestLimiter(RateLimitConfig{Rate: 0.5, Burst: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, "www.amazon.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 前两次消耗突发容量，第三次需等待一个令牌（2 秒）
+	if len(*waits) != 1 || (*waits)[0] != 2*time.Second {
+		t.Fatalf("waits = %v", *waits)
+	}
+
+	// 不同站点互不影响
+	if err := l.Wait(ctx, "www.amazon.co.uk"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*waits) != 1 {
+		t.Fatalf("other domain should not wait, waits = %v", *waits)
+	}
+}
+
+func TestRateLimiterPenaltyBackoff(t *testing.T) {
+	l, waits := newTestLimiter(RateLimitConfig{Rate: 10, Burst: 1, Penalty_503: 100, Penalty_max: 300})
+	ctx := context.Background()
+	key := "www.amazon.com"
+
+	for _, want := range []time.Duration{100 * time.Second, 200 * time.Second, 300 * time.Second, 300 * time.Second} {
+		*waits = nil
+		l.Penalize(key, RATE_PENALTY_503)
+		if err := l.Wait(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		if len(*waits) != 1 || (*waits)[0] != want {
+			t.Fatalf("waits = %v, want %s", *waits, want)
+		}
+	}
+
+	l.Success(key)
+	*waits = nil
+	l.Penalize(key, RATE_PENALTY_503)
+	l.Wait(ctx, key)
+	if (*waits)[0] != 100*time.Second {
+		t.Fatalf("success should reset backoff, waits = %v", *waits)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l, _ := newTestLimiter(RateLimitConfig{Rate: 0.1})
+	l.Penalize("www.amazon.com", RATE_PENALTY_CAPTCHA)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, "www.amazon.com"); err != context.Canceled {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestLimiterKeyPerCookie(t *testing.T) {
+	old := limiter
+	t.Cleanup(func() { limiter = old })
+
+	limiter = newRateLimiter(RateLimitConfig{Rate: 1})
+	assertEqual(t, "per domain", limiterKey("www.amazon.com", 7), "www.amazon.com")
+
+	limiter = newRateLimiter(RateLimitConfig{Rate: 1, Per_cookie: true})
+	assertEqual(t, "per cookie", limiterKey("www.amazon.com", 7), "www.amazon.com#7")
+	assertEqual(t, "no cookie", limiterKey("www.amazon.com", 0), "www.amazon.com")
+}
+
+func TestRateLimiterCrawlDelaySharedAcrossCookies(t *testing.T) {
+	l, waits := newTestLimiter(RateLimitConfig{Rate: 10, Burst: 5})
+	l.SetMinInterval("www.amazon.com", 3*time.Second)
+	ctx := context.Background()
+
+	l.Wait(ctx, "www.amazon.com#1")
+	l.Wait(ctx, "www.amazon.com#2")
+	if len(*waits) != 1 || (*waits)[0] != 3*time.Second {
+		t.Fatalf("waits = %v", *waits)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 已提交过的关键词再次提交时的处理方式
+const (
+	RECRAWL_SKIP  = "skip"  // 跳过（默认）
+	RECRAWL_FORCE = "force" // 未在排队或执行中时重新执行
+	RECRAWL_STALE = "stale" // 最近一次完成早于 max_age_days 天（或从未完成）时重新执行
+)
+
+// validateRecrawl 校验再次提交的处理方式，stale 需要 maxAgeDays
+func validateRecrawl(mode string, maxAgeDays int) error {
+	switch mode {
+	case "", RECRAWL_SKIP, RECRAWL_FORCE:
+	case RECRAWL_STALE:
+		if maxAgeDays <= 0 {
+			return fmt.Errorf("recrawl 为 stale 时 max_age_days 必须大于 0")
+		}
+	default:
+		return fmt.Errorf("recrawl 取值为 skip、force 或 stale: %s", mode)
+	}
+	if maxAgeDays < 0 {
+		return fmt.Errorf("max_age_days 不能为负数")
+	}
+	return nil
+}
+
+// KEYWORD_TASK_MATCH 同站点的关键词任务，参数为 关键词、配置文件的 domain、站点；站点为空的旧任务视为配置文件的 domain
+const KEYWORD_TASK_MATCH = "en_key = ? AND IF(domain = '', ?, domain) = ?"
+
+// 关键词任务的提交结果
+const (
+	SUBMIT_INSERTED = "inserted" // 新增
+	SUBMIT_REQUEUED = "requeued" // 已存在，重新排队
+	SUBMIT_SKIPPED  = "skipped"  // 已存在，跳过
+)
+
+// submitKeywordTask 写入关键词任务；同站点的关键词已存在时按 t.Recrawl 重新排队或跳过
+// 三种方式都先按 KEYWORD_TASK_MATCH 检查，站点为空的旧任务与配置文件 domain 的新提交视为同一任务
+func submitKeywordTask(t NewKeywordTask) (string, error) {
+	var n int
+	err := app.db.QueryRow("SELECT COUNT(*) FROM amc_category WHERE "+KEYWORD_TASK_MATCH, t.Keyword, app.Domain, t.Domain).Scan(&n)
+	if err != nil {
+		return "", err
+	}
+	if n > 0 {
+		if t.Recrawl != RECRAWL_FORCE && t.Recrawl != RECRAWL_STALE {
+			return SUBMIT_SKIPPED, nil
+		}
+		requeued, err := requeueKeywordTask(t)
+		if err != nil {
+			return "", err
+		}
+		if requeued {
+			return SUBMIT_REQUEUED, nil
+		}
+		return SUBMIT_SKIPPED, nil
+	}
+	err = insertKeywordTask(t)
+	if is_duplicate_entry(err) {
+		return SUBMIT_SKIPPED, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return SUBMIT_INSERTED, nil
+}
+
+// requeueWhere 已存在的同站点关键词任务可以重新排队的条件
+// 排队或执行中的任务不重复排队；stale 模式下最近 max_age_days 天内完成过的任务不重新执行
+func requeueWhere(t NewKeywordTask) (string, []interface{}) {
+	where := " WHERE " + KEYWORD_TASK_MATCH + " AND task_status NOT IN (?, ?)"
+	args := []interface{}{t.Keyword, app.Domain, t.Domain, TASK_STATUS_PENDING, TASK_STATUS_RUNNING}
+	if t.Recrawl == RECRAWL_STALE {
+		where += " AND (completed_at IS NULL OR completed_at < DATE_SUB(NOW(), INTERVAL ? DAY))"
+		args = append(args, t.MaxAgeDays)
+	}
+	return where, args
+}
+
+// requeueKeywordTask 按 t.Recrawl 将已存在的关键词任务重置为待执行，并使用本次提交的选项，返回是否重新排队
+// 不改写 domain：匹配到的任务站点已与本次提交相同，站点为空的旧任务改写后可能与同站点的任务冲突；
+// 同时存在旧任务和新任务时只重新排队 id 最小的一条
+func requeueKeywordTask(t NewKeywordTask) (bool, error) {
+	where, args := requeueWhere(t)
+	r, err := app.db.Exec(
+		`UPDATE amc_category SET task_status = ?, priority = ?, max_pages = ?, max_asins = ?, not_before = ?, refresh_days = ?,
+		callback_url = ?, stage = NULL, error_message = NULL, finished_at = NULL`+where+" ORDER BY id LIMIT 1",
+		append([]interface{}{TASK_STATUS_PENDING, t.Priority, t.MaxPages, t.MaxASINs, t.notBefore(), t.RefreshDays,
+			nullableString(t.CallbackURL)}, args...)...,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := r.RowsAffected()
+	return n > 0, nil
+}
+
+// refreshStaleTasks 将设置了 refresh_days 且最近一次完成已超过该天数的任务重置为待执行
+// 单条 UPDATE，多个实例同时执行也不会重复排队
+func refreshStaleTasks(ctx context.Context) (int64, error) {
+	r, err := app.db.ExecContext(ctx,
+		`UPDATE amc_category SET task_status = ?, stage = NULL, error_message = NULL, finished_at = NULL, not_before = NULL
+		WHERE task_status = ? AND refresh_days > 0 AND completed_at < DATE_SUB(NOW(), INTERVAL refresh_days DAY)`,
+		TASK_STATUS_PENDING, TASK_STATUS_COMPLETED,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// startTaskRefresher 启动后台刷新，立即执行一次，之后每 task.refresh_interval 秒执行一次，ctx 取消后停止
+func startTaskRefresher(ctx context.Context) {
+	if app.Task.Refresh_interval < 0 {
+		log.Infof("task.refresh_interval 小于 0，不自动刷新过期关键词")
+		return
+	}
+	refresh := func() {
+		n, err := refreshStaleTasks(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("刷新过期关键词失败: %v", err)
+			}
+			return
+		}
+		if n > 0 {
+			log.Infof("已将 %d 个过期关键词重置为待执行", n)
+			notifyTaskWorkers()
+		}
+	}
+
+	go func() {
+		refresh()
+		ticker := time.NewTicker(seconds(app.Task.Refresh_interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateRecrawl(t *testing.T) {
+	for _, ok := range []struct {
+		mode string
+		days int
+	}{{"", 0}, {RECRAWL_SKIP, 0}, {RECRAWL_FORCE, 0}, {RECRAWL_STALE, 7}} {
+		if err := validateRecrawl(ok.mode, ok.days); err != nil {
+			t.Errorf("%s/%d: %v", ok.mode, ok.days, err)
+		}
+	}
+	for _, bad := range []struct {
+		mode string
+		days int
+	}{{RECRAWL_STALE, 0}, {"always", 0}, {RECRAWL_FORCE, -1}} {
+		if err := validateRecrawl(bad.mode, bad.days); err == nil {
+			t.Errorf("%s/%d accepted", bad.mode, bad.days)
+		}
+	}
+}
+
+func TestRequeueWhere(t *testing.T) {
+	oldDomain := app.Domain
+	app.Domain = "www.amazon.com"
+	t.Cleanup(func() { app.Domain = oldDomain })
+
+	where, args := requeueWhere(NewKeywordTask{Keyword: "nike", Domain: "www.amazon.com.mx", Recrawl: RECRAWL_FORCE})
+	if strings.Contains(where, "completed_at") {
+		t.Errorf("force where = %q", where)
+	}
+	assertEqual(t, "force args", fmt.Sprint(args...), fmt.Sprint("nike", "www.amazon.com", "www.amazon.com.mx", TASK_STATUS_PENDING, TASK_STATUS_RUNNING))
+
+	where, args = requeueWhere(NewKeywordTask{Keyword: "nike", Domain: "www.amazon.com", Recrawl: RECRAWL_STALE, MaxAgeDays: 7})
+	if !strings.Contains(where, "completed_at < DATE_SUB(NOW(), INTERVAL ? DAY)") {
+		t.Errorf("stale where = %q", where)
+	}
+	assertEqual(t, "stale args", strconv.Itoa(len(args)), "6")
+	assertEqual(t, "stale days", fmt.Sprint(args[5]), "7")
+}
+
+func TestBuildKeywordTasksRecrawlOptions(t *testing.T) {
+	req := CrawlRequest{
+		Keywords:         []string{"nike"},
+		Tasks:            []CrawlTaskRequest{{Keyword: "puma", CrawlTaskOptions: CrawlTaskOptions{Recrawl: RECRAWL_FORCE, RefreshDays: 3}}},
+		CrawlTaskOptions: CrawlTaskOptions{Recrawl: RECRAWL_STALE, MaxAgeDays: 7, RefreshDays: 30},
+	}
+	tasks, err := buildKeywordTasks(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "nike", tasks[0].Recrawl+"/"+strconv.Itoa(tasks[0].MaxAgeDays)+"/"+strconv.Itoa(tasks[0].RefreshDays), "stale/7/30")
+	assertEqual(t, "puma", tasks[1].Recrawl+"/"+strconv.Itoa(tasks[1].RefreshDays), "force/3")
+
+	if _, err := buildKeywordTasks(CrawlRequest{Keywords: []string{"nike"}, CrawlTaskOptions: CrawlTaskOptions{Recrawl: RECRAWL_STALE}}); err == nil {
+		t.Error("stale without max_age_days accepted")
+	}
+	if _, err := buildKeywordTasks(CrawlRequest{Keywords: []string{"nike"}, CrawlTaskOptions: CrawlTaskOptions{RefreshDays: -1}}); err == nil {
+		t.Error("negative refresh_days accepted")
+	}
+}
+
+func TestTaskConfigRefreshInterval(t *testing.T) {
+	assertEqual(t, "default", strconv.Itoa(TaskConfig{}.withDefaults().Refresh_interval), "3600")
+	assertEqual(t, "disabled", strconv.Itoa(TaskConfig{Refresh_interval: -1}.withDefaults().Refresh_interval), "-1")
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 结果查询分页
+const (
+	RESULT_PAGE_SIZE     = 50     // 默认每页条数
+	RESULT_PAGE_SIZE_MAX = 500    // 每页最多条数
+	RESULT_CSV_MAX_ROWS  = 100000 // CSV 单次最多导出的条数
+)
+
+// RESULT_CSV_FLUSH_ROWS 导出 CSV 时每写入多少行刷新一次
+const RESULT_CSV_FLUSH_ROWS = 500
+
+// resultFilter 查询参数到筛选条件的映射
+// 参数值可用逗号分隔多个，expr 中的 %s 替换为对应数量的占位符
+type resultFilter struct {
+	param     string
+	expr      string
+	ints      bool                // 参数值必须是整数
+	normalize func(string) string // 比较前转换参数值，如转为小写
+}
+
+// resultResource 一种结果数据：表、返回列、筛选、排序和日期范围
+type resultResource struct {
+	name       string // 日志和 CSV 文件名
+	table      string
+	columns    string // 与 scan 对应的列
+	scan       func(row rowScanner) (interface{}, []string, error)
+	csvHeader  []string
+	filters    []resultFilter
+	dateColumn string            // date_from / date_to 作用的列
+	sorts      map[string]string // 允许的排序字段
+}
+
+// resultQuery 解析后的查询参数
+type resultQuery struct {
+	res      *resultResource
+	conds    []string
+	args     []interface{}
+	sort     string // 排序列
+	desc     bool
+	Page     int
+	PageSize int
+}
+
+// parseResultValues 拆分逗号分隔的参数值，忽略空值
+func parseResultValues(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseResultDate 解析日期范围，只有日期时 end 为 true 表示取当天结束（次日零点）
+func parseResultDate(param, s string, end bool) (string, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local().Format("2006-01-02 15:04:05"), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t.Format("2006-01-02 15:04:05"), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("%s 格式无效: %s，应为 2006-01-02、2006-01-02 15:04:05 或 RFC3339", param, s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Format("2006-01-02 15:04:05"), nil
+}
+
+// parseResultQuery 解析筛选、排序（sort=字段 或 -字段 表示倒序，默认 -id）和分页参数
+func parseResultQuery(res *resultResource, q url.Values) (resultQuery, error) {
+	rq := resultQuery{res: res, sort: "id", desc: true, Page: 1, PageSize: RESULT_PAGE_SIZE}
+
+	for _, f := range res.filters {
+		values := parseResultValues(q.Get(f.param))
+		if len(values) == 0 {
+			continue
+		}
+		for _, v := range values {
+			if f.ints {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return rq, fmt.Errorf("%s 必须是整数: %s", f.param, v)
+				}
+				rq.args = append(rq.args, n)
+				continue
+			}
+			if f.normalize != nil {
+				v = f.normalize(v)
+			}
+			rq.args = append(rq.args, v)
+		}
+		rq.conds = append(rq.conds, fmt.Sprintf(f.expr, "?"+strings.Repeat(", ?", len(values)-1)))
+	}
+
+	if v := strings.TrimSpace(q.Get("date_from")); v != "" {
+		from, err := parseResultDate("date_from", v, false)
+		if err != nil {
+			return rq, err
+		}
+		rq.conds = append(rq.conds, res.dateColumn+" >= ?")
+		rq.args = append(rq.args, from)
+	}
+	if v := strings.TrimSpace(q.Get("date_to")); v != "" {
+		to, err := parseResultDate("date_to", v, true)
+		if err != nil {
+			return rq, err
+		}
+		// 只有日期时包含当天；带时间时包含该时刻
+		op := " < ?"
+		if strings.Contains(v, ":") {
+			op = " <= ?"
+		}
+		rq.conds = append(rq.conds, res.dateColumn+op)
+		rq.args = append(rq.args, to)
+	}
+
+	if v := strings.TrimSpace(q.Get("sort")); v != "" {
+		name := strings.TrimPrefix(v, "-")
+		column, ok := res.sorts[name]
+		if !ok {
+			return rq, fmt.Errorf("不支持按 %s 排序", name)
+		}
+		rq.sort, rq.desc = column, strings.HasPrefix(v, "-")
+	}
+
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return rq, fmt.Errorf("page 必须是正整数")
+		}
+		rq.Page = n
+	}
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return rq, fmt.Errorf("page_size 必须是正整数")
+		}
+		if n > RESULT_PAGE_SIZE_MAX {
+			n = RESULT_PAGE_SIZE_MAX
+		}
+		rq.PageSize = n
+	}
+	return rq, nil
+}
+
+// where 生成筛选条件，不含筛选时为空
+func (rq resultQuery) where() (string, []interface{}) {
+	if len(rq.conds) == 0 {
+		return "", rq.args
+	}
+	return " WHERE " + strings.Join(rq.conds, " AND "), rq.args
+}
+
+// orderBy 排序子句，排序列相同时按 id 排序，保证分页稳定
+func (rq resultQuery) orderBy() string {
+	dir := " ASC"
+	if rq.desc {
+		dir = " DESC"
+	}
+	if rq.sort == "id" {
+		return " ORDER BY id" + dir
+	}
+	return " ORDER BY " + rq.sort + dir + ", id" + dir
+}
+
+// selectSQL 查询语句和参数，limit 为 0 时不分页
+func (rq resultQuery) selectSQL(limit, offset int) (string, []interface{}) {
+	where, args := rq.where()
+	query := "SELECT " + rq.res.columns + " FROM " + rq.res.table + where + rq.orderBy()
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args[:len(args):len(args)], limit, offset)
+	}
+	return query, args
+}
+
+// list 按页查询，返回本页数据和总数
+func (rq resultQuery) list(ctx context.Context) ([]interface{}, int, error) {
+	where, args := rq.where()
+	var total int
+	if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+rq.res.table+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query, args := rq.selectSQL(rq.PageSize, (rq.Page-1)*rq.PageSize)
+	rows, err := app.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []interface{}{}
+	for rows.Next() {
+		item, _, err := rq.res.scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+// writeCSV 导出全部匹配的数据（最多 RESULT_CSV_MAX_ROWS 条），逐行写出
+func (rq resultQuery) writeCSV(w http.ResponseWriter, r *http.Request) {
+	query, args := rq.selectSQL(RESULT_CSV_MAX_ROWS, 0)
+	rows, err := app.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		log.Errorf("导出%s失败: %v", rq.res.name, err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询失败",
+		})
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, rq.res.table))
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	cw.Write(rq.res.csvHeader)
+	n := 0
+	for rows.Next() {
+		_, record, err := rq.res.scan(rows)
+		if err != nil {
+			// 响应头已发送，只能中止输出
+			log.Errorf("导出%s失败: %v", rq.res.name, err)
+			break
+		}
+		cw.Write(record)
+		if n++; n%RESULT_CSV_FLUSH_ROWS == 0 {
+			cw.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("导出%s失败: %v", rq.res.name, err)
+	}
+	cw.Flush()
+	log.Infof("导出%s %d 条", rq.res.name, n)
+}
+
+// wantsCSV 请求头 Accept 包含 text/csv 或参数 format=csv 时导出 CSV
+func wantsCSV(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/csv") || r.URL.Query().Get("format") == "csv"
+}
+
+// handleResults 返回按 res 查询结果的处理函数
+func handleResults(res *resultResource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+				Code:    -1,
+				Message: "只支持 GET 方法",
+			})
+			return
+		}
+		rq, err := parseResultQuery(res, r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if wantsCSV(r) {
+			rq.writeCSV(w, r)
+			return
+		}
+		items, total, err := rq.list(r.Context())
+		if err != nil {
+			log.Errorf("查询%s失败: %v", res.name, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "查询失败",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, APIResponse{
+			Code:    0,
+			Message: "ok",
+			Data: map[string]interface{}{
+				"total":     total,
+				"page":      rq.Page,
+				"page_size": rq.PageSize,
+				"items":     items,
+			},
+		})
+	}
+}
+
+// ResultProduct amc_product 中的商品
+type ResultProduct struct {
+	ID            int64  `json:"id"`
+	ASIN          string `json:"asin"`
+	Title         string `json:"title"`
+	Price         string `json:"price"`
+	Rating        string `json:"rating"`
+	ReviewCount   string `json:"review_count"`
+	BoughtCount   string `json:"bought_count"`
+	Keyword       string `json:"keyword"`
+	Domain        string `json:"domain"`
+	SellerID      string `json:"seller_id"`
+	BrandName     string `json:"brand_name"`
+	BrandStoreURL string `json:"brand_store_url"`
+	URL           string `json:"url"`
+	Status        int    `json:"status"`
+	App           int    `json:"app"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// ResultSeller amc_seller 中的卖家
+type ResultSeller struct {
+	ID         int64  `json:"id"`
+	SellerID   string `json:"seller_id"`
+	SellerName string `json:"seller_name"`
+	Name       string `json:"name"` // 公司名
+	Address    string `json:"address"`
+	Keyword    string `json:"keyword"`
+	Domain     string `json:"domain"`
+	TRN        string `json:"trn"`
+	TRNStatus  int    `json:"trn_status"`
+	AllStatus  int    `json:"all_status"`
+	AppID      int    `json:"app_id"`
+	CompanyID  string `json:"company_id"`
+	FB1Month   int    `json:"fb_1month"`
+	FB3Month   int    `json:"fb_3month"`
+	FB12Month  int    `json:"fb_12month"`
+	FBLifetime int    `json:"fb_lifetime"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// ResultShop tb_amazon_shop 中的店铺
+type ResultShop struct {
+	ID             int64  `json:"id"`
+	BrandName      string `json:"brand_name"`
+	ShopID         string `json:"shop_id"` // 即 seller_id
+	ShopName       string `json:"shop_name"`
+	ShopURL        string `json:"shop_url"`
+	Marketplace    string `json:"marketplace"`
+	CompanyName    string `json:"company_name"`
+	CompanyAddress string `json:"company_address"`
+	FB1Month       int    `json:"fb_1month"`
+	FB3Month       int    `json:"fb_3month"`
+	FB12Month      int    `json:"fb_12month"`
+	FBLifetime     int    `json:"fb_lifetime"`
+	CrawlTime      string `json:"crawl_time"`
+	CreateTime     string `json:"create_time"`
+	UpdateTime     string `json:"update_time"`
+}
+
+// itoa CSV 中的整数
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+// 商品、卖家与店铺通过 seller_id（店铺为 shop_id）关联，可按另一张表的字段筛选
+const (
+	RESULT_PRODUCT_OF_SELLER = "EXISTS (SELECT 1 FROM amc_product p WHERE p.seller_id = %s.%s AND p.%s IN (%%s))"
+	RESULT_SELLER_OF_ROW     = "EXISTS (SELECT 1 FROM amc_seller s WHERE s.seller_id = %s.%s AND s.%s IN (%%s))"
+)
+
+var productResults = &resultResource{
+	name:  "商品",
+	table: "amc_product",
+	columns: `id, COALESCE(asin, ''), COALESCE(title, ''), COALESCE(price, ''), COALESCE(rating, ''), COALESCE(review_count, ''), COALESCE(bought_count, ''),
+	COALESCE(keyword, ''), domain, COALESCE(seller_id, ''), COALESCE(brand_name, ''), COALESCE(brand_store_url, ''), url, COALESCE(status, 0), app, created_at, updated_at`,
+	scan: func(row rowScanner) (interface{}, []string, error) {
+		var p ResultProduct
+		err := row.Scan(&p.ID, &p.ASIN, &p.Title, &p.Price, &p.Rating, &p.ReviewCount, &p.BoughtCount,
+			&p.Keyword, &p.Domain, &p.SellerID, &p.BrandName, &p.BrandStoreURL, &p.URL, &p.Status, &p.App, &p.CreatedAt, &p.UpdatedAt)
+		return p, []string{strconv.FormatInt(p.ID, 10), p.ASIN, p.Title, p.Price, p.Rating, p.ReviewCount, p.BoughtCount,
+			p.Keyword, p.Domain, p.SellerID, p.BrandName, p.BrandStoreURL, p.URL, itoa(p.Status), itoa(p.App), p.CreatedAt, p.UpdatedAt}, err
+	},
+	csvHeader: []string{"id", "asin", "title", "price", "rating", "review_count", "bought_count",
+		"keyword", "domain", "seller_id", "brand_name", "brand_store_url", "url", "status", "app", "created_at", "updated_at"},
+	filters: []resultFilter{
+		{param: "keyword", expr: "keyword IN (%s)"},
+		{param: "domain", expr: "domain IN (%s)", normalize: normalizeDomain},
+		{param: "brand", expr: "brand_name IN (%s)"},
+		{param: "asin", expr: "asin IN (%s)", normalize: strings.ToUpper},
+		{param: "seller_id", expr: "seller_id IN (%s)"},
+		{param: "status", expr: "status IN (%s)", ints: true},
+		{param: "trn_status", expr: fmt.Sprintf(RESULT_SELLER_OF_ROW, "amc_product", "seller_id", "trn_status"), ints: true},
+		{param: "all_status", expr: fmt.Sprintf(RESULT_SELLER_OF_ROW, "amc_product", "seller_id", "all_status"), ints: true},
+	},
+	dateColumn: "created_at",
+	sorts: map[string]string{
+		"id": "id", "created_at": "created_at", "updated_at": "updated_at", "keyword": "keyword",
+		"brand_name": "brand_name", "asin": "asin", "seller_id": "seller_id", "status": "status",
+	},
+}
+
+var sellerResults = &resultResource{
+	name:  "卖家",
+	table: "amc_seller",
+	columns: `id, seller_id, COALESCE(seller_name, ''), COALESCE(name, ''), COALESCE(address, ''), COALESCE(keyword, ''), domain, COALESCE(trn, ''),
+	trn_status, COALESCE(all_status, 0), COALESCE(app_id, 0), COALESCE(company_id, ''), fb_1month, fb_3month, fb_12month, fb_lifetime, created_at, updated_at`,
+	scan: func(row rowScanner) (interface{}, []string, error) {
+		var s ResultSeller
+		err := row.Scan(&s.ID, &s.SellerID, &s.SellerName, &s.Name, &s.Address, &s.Keyword, &s.Domain, &s.TRN,
+			&s.TRNStatus, &s.AllStatus, &s.AppID, &s.CompanyID, &s.FB1Month, &s.FB3Month, &s.FB12Month, &s.FBLifetime, &s.CreatedAt, &s.UpdatedAt)
+		return s, []string{strconv.FormatInt(s.ID, 10), s.SellerID, s.SellerName, s.Name, s.Address, s.Keyword, s.Domain, s.TRN,
+			itoa(s.TRNStatus), itoa(s.AllStatus), itoa(s.AppID), s.CompanyID, itoa(s.FB1Month), itoa(s.FB3Month), itoa(s.FB12Month), itoa(s.FBLifetime),
+			s.CreatedAt, s.UpdatedAt}, err
+	},
+	csvHeader: []string{"id", "seller_id", "seller_name", "name", "address", "keyword", "domain", "trn",
+		"trn_status", "all_status", "app_id", "company_id", "fb_1month", "fb_3month", "fb_12month", "fb_lifetime", "created_at", "updated_at"},
+	filters: []resultFilter{
+		{param: "keyword", expr: "keyword IN (%s)"},
+		{param: "domain", expr: "domain IN (%s)", normalize: normalizeDomain},
+		{param: "brand", expr: fmt.Sprintf(RESULT_PRODUCT_OF_SELLER, "amc_seller", "seller_id", "brand_name")},
+		{param: "asin", expr: fmt.Sprintf(RESULT_PRODUCT_OF_SELLER, "amc_seller", "seller_id", "asin"), normalize: strings.ToUpper},
+		{param: "seller_id", expr: "seller_id IN (%s)"},
+		{param: "trn_status", expr: "trn_status IN (%s)", ints: true},
+		{param: "all_status", expr: "all_status IN (%s)", ints: true},
+	},
+	dateColumn: "created_at",
+	sorts: map[string]string{
+		"id": "id", "created_at": "created_at", "updated_at": "updated_at", "keyword": "keyword", "seller_id": "seller_id",
+		"trn_status": "trn_status", "all_status": "all_status",
+		"fb_1month": "fb_1month", "fb_3month": "fb_3month", "fb_12month": "fb_12month", "fb_lifetime": "fb_lifetime",
+	},
+}
+
+var shopResults = &resultResource{
+	name:  "店铺",
+	table: "tb_amazon_shop",
+	columns: `id, COALESCE(brand_name, ''), COALESCE(shop_id, ''), COALESCE(shop_name, ''), COALESCE(shop_url, ''), COALESCE(marketplace, ''),
+	COALESCE(company_name, ''), COALESCE(company_address, ''), COALESCE(fb_1month, 0), COALESCE(fb_3month, 0), COALESCE(fb_12month, 0), COALESCE(fb_lifetime, 0),
+	COALESCE(crawl_time, ''), COALESCE(create_time, ''), COALESCE(update_time, '')`,
+	scan: func(row rowScanner) (interface{}, []string, error) {
+		var s ResultShop
+		err := row.Scan(&s.ID, &s.BrandName, &s.ShopID, &s.ShopName, &s.ShopURL, &s.Marketplace,
+			&s.CompanyName, &s.CompanyAddress, &s.FB1Month, &s.FB3Month, &s.FB12Month, &s.FBLifetime, &s.CrawlTime, &s.CreateTime, &s.UpdateTime)
+		return s, []string{strconv.FormatInt(s.ID, 10), s.BrandName, s.ShopID, s.ShopName, s.ShopURL, s.Marketplace,
+			s.CompanyName, s.CompanyAddress, itoa(s.FB1Month), itoa(s.FB3Month), itoa(s.FB12Month), itoa(s.FBLifetime),
+			s.CrawlTime, s.CreateTime, s.UpdateTime}, err
+	},
+	csvHeader: []string{"id", "brand_name", "shop_id", "shop_name", "shop_url", "marketplace",
+		"company_name", "company_address", "fb_1month", "fb_3month", "fb_12month", "fb_lifetime", "crawl_time", "create_time", "update_time"},
+	filters: []resultFilter{
+		// 店铺的 brand_name 是小写的关键词
+		{param: "keyword", expr: "brand_name IN (%s)", normalize: strings.ToLower},
+		{param: "brand", expr: "brand_name IN (%s)", normalize: strings.ToLower},
+		{param: "asin", expr: fmt.Sprintf(RESULT_PRODUCT_OF_SELLER, "tb_amazon_shop", "shop_id", "asin"), normalize: strings.ToUpper},
+		{param: "seller_id", expr: "shop_id IN (%s)"},
+		{param: "marketplace", expr: "marketplace IN (%s)", normalize: strings.ToUpper},
+		{param: "trn_status", expr: fmt.Sprintf(RESULT_SELLER_OF_ROW, "tb_amazon_shop", "shop_id", "trn_status"), ints: true},
+		{param: "all_status", expr: fmt.Sprintf(RESULT_SELLER_OF_ROW, "tb_amazon_shop", "shop_id", "all_status"), ints: true},
+	},
+	dateColumn: "crawl_time",
+	sorts: map[string]string{
+		"id": "id", "crawl_time": "crawl_time", "create_time": "create_time", "update_time": "update_time",
+		"brand_name": "brand_name", "shop_id": "shop_id", "marketplace": "marketplace",
+		"fb_1month": "fb_1month", "fb_3month": "fb_3month", "fb_12month": "fb_12month", "fb_lifetime": "fb_lifetime",
+	},
+}
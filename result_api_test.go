@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestParseResultQueryDefaults(t *testing.T) {
+	rq, err := parseResultQuery(productResults, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "page", fmt.Sprint(rq.Page, rq.PageSize), fmt.Sprint(1, RESULT_PAGE_SIZE))
+	where, args := rq.where()
+	assertEqual(t, "where", where, "")
+	assertEqual(t, "args", strconv.Itoa(len(args)), "0")
+	assertEqual(t, "order", rq.orderBy(), " ORDER BY id DESC")
+
+	rq, err = parseResultQuery(productResults, url.Values{"page": {"2"}, "page_size": {"9999"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "page_size capped", fmt.Sprint(rq.Page, rq.PageSize), fmt.Sprint(2, RESULT_PAGE_SIZE_MAX))
+	query, args := rq.selectSQL(rq.PageSize, (rq.Page-1)*rq.PageSize)
+	assertEqual(t, "limit args", fmt.Sprint(args), "[500 500]")
+	if want := " LIMIT ? OFFSET ?"; query[len(query)-len(want):] != want {
+		t.Errorf("query = %s", query)
+	}
+}
+
+func TestParseResultQueryFilters(t *testing.T) {
+	rq, err := parseResultQuery(productResults, url.Values{
+		"keyword":    {"phone case"},
+		"asin":       {"b0aaaaaaaa, B0BBBBBBBB,"},
+		"trn_status": {"1"},
+		"date_from":  {"2024-06-01"},
+		"date_to":    {"2024-06-30"},
+		"sort":       {"-created_at"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, args := rq.where()
+	assertEqual(t, "where", where, " WHERE keyword IN (?) AND asin IN (?, ?)"+
+		" AND EXISTS (SELECT 1 FROM amc_seller s WHERE s.seller_id = amc_product.seller_id AND s.trn_status IN (?))"+
+		" AND created_at >= ? AND created_at < ?")
+	assertEqual(t, "args", fmt.Sprint(args), "[phone case B0AAAAAAAA B0BBBBBBBB 1 2024-06-01 00:00:00 2024-07-01 00:00:00]")
+	assertEqual(t, "order", rq.orderBy(), " ORDER BY created_at DESC, id DESC")
+
+	rq, err = parseResultQuery(sellerResults, url.Values{"brand": {"Acme"}, "domain": {"https://WWW.Amazon.co.uk"}, "date_to": {"2024-06-30 12:00:00"}, "sort": {"fb_12month"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, args = rq.where()
+	assertEqual(t, "seller where", where,
+		" WHERE domain IN (?) AND EXISTS (SELECT 1 FROM amc_product p WHERE p.seller_id = amc_seller.seller_id AND p.brand_name IN (?)) AND created_at <= ?")
+	assertEqual(t, "seller args", fmt.Sprint(args), "[www.amazon.co.uk Acme 2024-06-30 12:00:00]")
+	assertEqual(t, "seller order", rq.orderBy(), " ORDER BY fb_12month ASC, id ASC")
+
+	rq, err = parseResultQuery(shopResults, url.Values{"keyword": {"Phone Case"}, "marketplace": {"us,uk"}, "seller_id": {"A1B2C3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, args = rq.where()
+	assertEqual(t, "shop where", where, " WHERE brand_name IN (?) AND shop_id IN (?) AND marketplace IN (?, ?)")
+	assertEqual(t, "shop args", fmt.Sprint(args), "[phone case A1B2C3 US UK]")
+}
+
+func TestParseResultQueryRejectsBadValues(t *testing.T) {
+	cases := []struct {
+		res *resultResource
+		q   url.Values
+	}{
+		{productResults, url.Values{"status": {"done"}}},
+		{sellerResults, url.Values{"all_status": {"1,x"}}},
+		{productResults, url.Values{"sort": {"title"}}},
+		{shopResults, url.Values{"sort": {"-created_at"}}},
+		{productResults, url.Values{"date_from": {"06/01/2024"}}},
+		{productResults, url.Values{"page": {"0"}}},
+		{productResults, url.Values{"page_size": {"x"}}},
+	}
+	for _, c := range cases {
+		if _, err := parseResultQuery(c.res, c.q); err == nil {
+			t.Errorf("%s %v accepted", c.res.table, c.q)
+		}
+	}
+}
+
+func TestResultCSVHeaderMatchesScan(t *testing.T) {
+	for _, res := range []*resultResource{productResults, sellerResults, shopResults} {
+		_, record, _ := res.scan(fakeRow{})
+		assertEqual(t, res.table, strconv.Itoa(len(record)), strconv.Itoa(len(res.csvHeader)))
+	}
+}
+
+// fakeRow 不写入任何值的 rowScanner
+type fakeRow struct{}
+
+func (fakeRow) Scan(dest ...interface{}) error { return nil }
+
+func TestHandleResultsRejectsBadRequests(t *testing.T) {
+	cases := []struct {
+		res          *resultResource
+		method, path string
+		want         int
+	}{
+		{productResults, http.MethodPost, "/api/products", http.StatusMethodNotAllowed},
+		{productResults, http.MethodGet, "/api/products?sort=title", http.StatusBadRequest},
+		{sellerResults, http.MethodGet, "/api/sellers?date_to=yesterday", http.StatusBadRequest},
+		{shopResults, http.MethodGet, "/api/shops?page=-1&format=csv", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		handleResults(c.res)(rec, httptest.NewRequest(c.method, c.path, nil))
+		assertEqual(t, c.method+" "+c.path, strconv.Itoa(rec.Code), strconv.Itoa(c.want))
+	}
+}
+
+func TestWantsCSV(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	assertEqual(t, "default", fmt.Sprint(wantsCSV(r)), "false")
+	r.Header.Set("Accept", "text/csv, */*;q=0.1")
+	assertEqual(t, "accept", fmt.Sprint(wantsCSV(r)), "true")
+	r = httptest.NewRequest(http.MethodGet, "/api/products?format=csv", nil)
+	assertEqual(t, "format", fmt.Sprint(wantsCSV(r)), "true")
+}
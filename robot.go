@@ -2,80 +2,222 @@ package main
 
 import (
 	"fmt"
-	"regexp"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// RobotsConfig robots.txt 配置
+type RobotsConfig struct {
+	Ttl int `yaml:"ttl"` // 缓存时间（秒），过期后重新加载，默认 86400
+}
+
+// Robots robots.txt 规则，按 RFC 9309 解析
 type Robots struct {
-	robot []Robot
+	groups   []robotsGroup
+	Sitemaps []string // Sitemap 声明，不属于任何分组
 }
-type Robot struct {
-	ua_name string
-	ua_re   *regexp.Regexp
-	ua      []uastruct
+
+// robotsGroup 一组 User-agent 及其规则
+type robotsGroup struct {
+	agents     []string // 小写的 User-agent 名称
+	rules      []robotsRule
+	crawlDelay time.Duration
+	hasDelay   bool
 }
-type uastruct struct {
-	url    string
-	url_re *regexp.Regexp
-	allow  bool
+
+type robotsRule struct {
+	pattern string
+	allow   bool
 }
 
+// GetRobotFromTxt 解析 robots.txt
+// 连续的 User-agent 行属于同一分组；出现在任何 User-agent 之前的规则会被忽略
 func GetRobotFromTxt(txt string) Robots {
-	ua := ""
-	ua_name := ""
-	ua_list := Robots{}
+	var r Robots
+	var current *robotsGroup
+	inRules := false // 当前分组是否已经出现规则行，之后的 User-agent 将开始新分组
+
 	for _, line := range strings.Split(txt, "\n") {
-		if strings.HasPrefix(line, "User-agent: ") {
-			ua = strings.TrimPrefix(line, "User-agent: ")
-			ua_name = ua
-			ua_list.robot = append(ua_list.robot, Robot{ua_name, regexp.MustCompile(strings.ReplaceAll(ua_name, "*", ".*")), []uastruct{}})
-		} else if strings.HasPrefix(line, "Disallow: ") {
-			u := strings.TrimPrefix(line, "Disallow: ")
-
-			ua_list.robot[len(ua_list.robot)-1].ua = append(ua_list.robot[len(ua_list.robot)-1].ua, uastruct{u, regexp.MustCompile(strings.ReplaceAll(u, "*", ".*")), false})
-		} else if strings.HasPrefix(line, "Allow: ") {
-			u := strings.TrimPrefix(line, "Allow: ")
-			ua_list.robot[len(ua_list.robot)-1].ua = append(ua_list.robot[len(ua_list.robot)-1].ua, uastruct{u, regexp.MustCompile(strings.ReplaceAll(u, "*", ".*")), true})
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				r.groups = append(r.groups, robotsGroup{})
+				current = &r.groups[len(r.groups)-1]
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// 空的 Disallow 表示不限制，空的 Allow 没有意义
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{pattern: value, allow: key == "allow"})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if sec, err := strconv.ParseFloat(value, 64); err == nil && sec >= 0 {
+				current.crawlDelay = time.Duration(sec * float64(time.Second))
+				current.hasDelay = true
+			}
+		case "sitemap":
+			if value != "" {
+				r.Sitemaps = append(r.Sitemaps, value)
+			}
 		}
 	}
-	return ua_list
+	return r
+}
+
+// robotsProductToken 从 User-Agent 中取出产品标识，如 "Mozilla/5.0 (...)" 取 "mozilla"
+func robotsProductToken(ua string) string {
+	token := ua
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(token))
 }
-func (r *Robots) IsAllow(ua string, url string) error {
-	for _, robot := range r.robot {
-		var allow bool
-		var err error
-		if robot.ua_re.MatchString(ua) {
-			for _, ua := range robot.ua {
-
-				if !ua.allow && ua.url_re.MatchString(url) {
-					err = fmt.Errorf("由于robots.txt限制,不允许爬取(UA:%s URL:%s ),当前目标链接:%s", robot.ua_name, ua.url, url)
-					allow = false
-				}
+
+// matchGroups 返回适用于 ua 的分组：优先精确匹配产品标识，没有时使用 *，多个分组时合并
+func (r *Robots) matchGroups(ua string) []*robotsGroup {
+	token := robotsProductToken(ua)
+	var named, wildcard []*robotsGroup
+	for i := range r.groups {
+		g := &r.groups[i]
+		for _, agent := range g.agents {
+			if agent == "*" {
+				wildcard = append(wildcard, g)
+				break
 			}
-			for _, ua := range robot.ua {
-				if ua.allow && ua.url_re.MatchString(url) {
-					if !allow {
-						return nil
-					}
-				}
+			if token != "" && agent == token {
+				named = append(named, g)
+				break
 			}
-			if !allow {
-				return err
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return wildcard
+}
+
+// robotsPath 取出用于匹配的路径（含查询参数），支持完整链接和相对路径
+func robotsPath(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// robotsMatch 判断路径是否匹配规则，* 匹配任意字符，结尾的 $ 表示路径必须在此结束
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || path == ""
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(path, part)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(path, last)
+	}
+	return strings.Contains(path, last)
+}
+
+// IsAllow 判断 ua 是否允许访问 link
+// 匹配规则中路径最长的一条生效，长度相同时 Allow 优先，没有匹配的规则时允许访问
+func (r *Robots) IsAllow(ua string, link string) error {
+	path := robotsPath(link)
+	if path == "/robots.txt" {
+		return nil
+	}
+
+	var best *robotsRule
+	for _, g := range r.matchGroups(ua) {
+		for i := range g.rules {
+			rule := &g.rules[i]
+			if !robotsMatch(rule.pattern, path) {
+				continue
+			}
+			if best == nil || len(rule.pattern) > len(best.pattern) ||
+				(len(rule.pattern) == len(best.pattern) && rule.allow && !best.allow) {
+				best = rule
 			}
 		}
 	}
-	return nil
+	if best == nil || best.allow {
+		return nil
+	}
+	return fmt.Errorf("由于robots.txt限制,不允许爬取(UA:%s URL:%s ),当前目标链接:%s", robotsProductToken(ua), best.pattern, link)
+}
+
+// CrawlDelay 返回适用于 ua 的 Crawl-delay，多个分组时取最大值
+func (r *Robots) CrawlDelay(ua string) (time.Duration, bool) {
+	var delay time.Duration
+	found := false
+	for _, g := range r.matchGroups(ua) {
+		if g.hasDelay && (!found || g.crawlDelay > delay) {
+			delay, found = g.crawlDelay, true
+		}
+	}
+	return delay, found
 }
 
 func (r *Robots) Output() {
-	for _, robot := range r.robot {
-		fmt.Printf("User-agent: %s\n", robot.ua_name)
-		for _, ua := range robot.ua {
-			if ua.allow {
-				fmt.Printf("Allow: %s\n", ua.url)
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			fmt.Printf("User-agent: %s\n", agent)
+		}
+		for _, rule := range g.rules {
+			if rule.allow {
+				fmt.Printf("Allow: %s\n", rule.pattern)
 			} else {
-				fmt.Printf("Disallow: %s\n", ua.url)
+				fmt.Printf("Disallow: %s\n", rule.pattern)
 			}
 		}
+		if g.hasDelay {
+			fmt.Printf("Crawl-delay: %s\n", g.crawlDelay)
+		}
+	}
+	for _, sitemap := range r.Sitemaps {
+		fmt.Printf("Sitemap: %s\n", sitemap)
 	}
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testRobotsTxt = `# amazon 风格的 robots.txt
+Disallow: /orphan
+
+User-agent: Googlebot
+User-agent: Bingbot
+Disallow: /
+
+User-agent: *
+Disallow: /gp/cart
+Disallow: /*/dp/*/ref=
+Disallow: /s?k=*&rh=
+Allow: /gp/cart/view.html$
+Disallow: /exec/obidos/account-access-login
+Allow: /exec/obidos/
+Disallow: /dp/product-description/
+Allow: /dp/product-description/
+Disallow: /*.pdf$
+Crawl-delay: 2.5
+
+Sitemap: https://www.amazon.com/sitemaps.f3053414d236e84.SitemapIndex_0.xml.gz
+`
+
+func TestRobotsIsAllow(t *testing.T) {
+	r := GetRobotFromTxt(testRobotsTxt)
+	ua := getBrowserProfileByID("chrome-120-win").UserAgent
+	cases := []struct {
+		link  string
+		allow bool
+	}{
+		{"https://www.amazon.com/dp/B0FNMPQSJC", true},
+		{"https://www.amazon.com/orphan", true},
+		{"https://www.amazon.com/gp/cart/add.html", false},
+		{"/gp/cart/view.html", true},
+		{"/gp/cart/view.html?x=1", false},
+		{"/Widget/dp/B0FNMPQSJC/ref=sr_1_1", false},
+		{"/Widget/dp/B0FNMPQSJC", true},
+		{"/s?k=shoes&rh=n%3A1", false},
+		{"/s?k=shoes", true},
+		{"/exec/obidos/account-access-login", false},
+		{"/exec/obidos/tg/detail", true},
+		{"/dp/product-description/B0FNMPQSJC", true},
+		{"/manual.pdf", false},
+		{"/manual.pdf.html", true},
+		{"/robots.txt", true},
+	}
+	for _, c := range cases {
+		err := r.IsAllow(ua, c.link)
+		if (err == nil) != c.allow {
+			t.Errorf("%s: allow = %v, want %v (%v)", c.link, err == nil, c.allow, err)
+		}
+	}
+
+	if err := r.IsAllow("Googlebot/2.1 (+http://www.google.com/bot.html)", "/dp/B0FNMPQSJC"); err == nil {
+		t.Error("googlebot group should disallow everything")
+	}
+	if err := r.IsAllow("bingbot/2.0", "/dp/B0FNMPQSJC"); err == nil {
+		t.Error("consecutive user-agent lines should share one group")
+	}
+}
+
+func TestRobotsMatchSpecialCharacters(t *testing.T) {
+	// . 和 ? 按字面匹配，不是正则
+	if robotsMatch("/a.b", "/axb") {
+		t.Error(". should be literal")
+	}
+	if robotsMatch("/a?b", "/b") {
+		t.Error("? should be literal")
+	}
+	if !robotsMatch("/a?b", "/a?bc") {
+		t.Error("literal ? should match")
+	}
+	if !robotsMatch("*", "/anything") || !robotsMatch("/*$", "/x") {
+		t.Error("* should match anything")
+	}
+	if robotsMatch("/x$", "/x/") {
+		t.Error("$ should anchor the end")
+	}
+}
+
+func TestRobotsCrawlDelayAndSitemap(t *testing.T) {
+	r := GetRobotFromTxt(testRobotsTxt)
+	delay, ok := r.CrawlDelay(userAgent)
+	if !ok || delay != 2500*time.Millisecond {
+		t.Fatalf("crawl delay = %s, %v", delay, ok)
+	}
+	if _, ok := r.CrawlDelay("Googlebot/2.1"); ok {
+		t.Fatal("googlebot group has no crawl delay")
+	}
+	if len(r.Sitemaps) != 1 {
+		t.Fatalf("sitemaps = %v", r.Sitemaps)
+	}
+}
+
+func TestRobotsNoPanicOnMalformedInput(t *testing.T) {
+	r := GetRobotFromTxt("Disallow: /x\nAllow: /y\nCrawl-delay: 5\ngarbage\nUser-agent:\n")
+	if err := r.IsAllow(userAgent, "/x"); err != nil {
+		t.Fatalf("orphan rules should be ignored: %v", err)
+	}
+}
+
+func TestRobotsForDomainCacheAndCrawlDelay(t *testing.T) {
+	var loads int
+	status := http.StatusOK
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads++
+		w.WriteHeader(status)
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 3\n")
+	}))
+	oldFetcher, oldTTL, oldLimiter := fetcher, robotsTTL, limiter
+	fetcher = NewHTTPFetcher(srv.Client().Transport)
+	limiter = newRateLimiter(RateLimitConfig{})
+	resetRobotsCache()
+	t.Cleanup(func() {
+		srv.Close()
+		fetcher, robotsTTL, limiter = oldFetcher, oldTTL, oldLimiter
+		resetRobotsCache()
+	})
+	u, _ := url.Parse(srv.URL)
+	domain := u.Host
+	ctx := context.Background()
+
+	robotsTTL = time.Hour
+	for i := 0; i < 3; i++ {
+		if _, err := robotsForDomain(ctx, domain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1", loads)
+	}
+	if d := limiter.delays[domain]; d == nil || d.interval != 3*time.Second {
+		t.Fatalf("crawl delay not passed to limiter: %+v", d)
+	}
+
+	// 过期后重新加载；加载失败时沿用旧规则
+	robotsTTL = 0
+	status = http.StatusServiceUnavailable
+	r, err := robotsForDomain(ctx, domain)
+	if err != nil || loads != 2 {
+		t.Fatalf("err = %v, loads = %d", err, loads)
+	}
+	if r.IsAllow(userAgent, "/private") == nil {
+		t.Fatal("stale rules should still apply")
+	}
+
+	// robots.txt 不存在时不限制
+	resetRobotsCache()
+	status = http.StatusNotFound
+	r, err = robotsForDomain(ctx, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.IsAllow(userAgent, "/private"); err != nil {
+		t.Fatalf("missing robots.txt should allow everything: %v", err)
+	}
+}
+
+func TestRobotsForDomainLoadsDoNotBlockOtherDomains(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var loads int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads++
+		close(started)
+		<-release
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	oldFetcher, oldLimiter := fetcher, limiter
+	fetcher = NewHTTPFetcher(srv.Client().Transport)
+	limiter = newRateLimiter(RateLimitConfig{})
+	resetRobotsCache()
+	t.Cleanup(func() {
+		srv.Close()
+		fetcher, limiter = oldFetcher, oldLimiter
+		resetRobotsCache()
+	})
+	u, _ := url.Parse(srv.URL)
+	slow := u.Host
+
+	cached := robotsEntryFor("www.amazon.de")
+	r := GetRobotFromTxt("User-agent: *\nAllow: /\n")
+	cached.robots, cached.fetchedAt = &r, time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := robotsForDomain(context.Background(), slow)
+		done <- err
+	}()
+	<-started
+
+	// 其他域名不等待正在加载的域名
+	if _, err := robotsForDomain(context.Background(), "www.amazon.de"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一域名等待加载完成，可以被取消
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := robotsForDomain(ctx, slow); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	robots, err := robotsForDomain(context.Background(), slow)
+	if err != nil || loads != 1 {
+		t.Fatalf("err = %v, loads = %d", err, loads)
+	}
+	if robots.IsAllow(userAgent, "/private") == nil {
+		t.Fatal("loaded rules should apply")
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 定时任务的执行对象
+const (
+	SCHEDULE_TARGET_KEYWORD_GROUP   = "keyword_group"   // 一组关键词，payload 同 /api/crawl 的请求体
+	SCHEDULE_TARGET_BRAND_PATROL    = "brand_patrol"    // 一批品牌巡查，payload 见 BrandPatrolTarget
+	SCHEDULE_TARGET_LINK_INSPECTION = "link_inspection" // ASIN/链接巡检清单，payload 同 /api/asin-inspection/jobs 的请求体
+)
+
+// 定时任务最近一次执行的结果
+const (
+	SCHEDULE_RUN_OK      = "ok"      // 已提交或已完成
+	SCHEDULE_RUN_FAILED  = "failed"  // 执行失败
+	SCHEDULE_RUN_RUNNING = "running" // 品牌巡查执行中
+	SCHEDULE_RUN_SKIPPED = "skipped" // 上一次品牌巡查尚未结束，本次跳过
+)
+
+// SCHEDULER_LOCK 多台主机共用数据库时，持有该 MySQL 命名锁的主机执行到期的定时任务
+const SCHEDULER_LOCK = "amc_scheduler"
+
+// SCHEDULE_TIME_LAYOUT next_run_at / last_run_at 的格式，按本地时间保存和比较
+const SCHEDULE_TIME_LAYOUT = "2006-01-02 15:04:05"
+
+// ScheduleConfig 定时任务配置
+type ScheduleConfig struct {
+	Poll_seconds int `yaml:"poll_seconds"` // 检查到期定时任务的间隔（秒），默认 30，小于 0 时不执行定时任务
+}
+
+// withDefaults 填充未配置的字段
+func (c ScheduleConfig) withDefaults() ScheduleConfig {
+	if c.Poll_seconds == 0 {
+		c.Poll_seconds = 30
+	}
+	return c
+}
+
+// BrandPatrolTarget 品牌巡查的定时任务选项，未填写的项使用配置文件 brand 中的值
+type BrandPatrolTarget struct {
+	Batch    int  `json:"batch,omitempty"`     // 本次最多巡查的品牌数
+	MaxASINs int  `json:"max_asins,omitempty"` // 每个品牌最多搜索的 ASIN 数
+	Restart  bool `json:"restart,omitempty"`   // 没有待巡查的品牌时，将已完成、失败和无结果的品牌重置为待巡查，开始新一轮
+}
+
+// withDefaults 未填写的项使用配置文件 brand 中的值
+func (b BrandPatrolTarget) withDefaults() BrandPatrolTarget {
+	if b.Batch == 0 {
+		b.Batch = app.Brand.Batch
+	}
+	if b.Batch == 0 {
+		b.Batch = 100
+	}
+	if b.MaxASINs == 0 {
+		b.MaxASINs = app.Brand.MaxASINs
+	}
+	if b.MaxASINs == 0 {
+		b.MaxASINs = 5
+	}
+	return b
+}
+
+// Schedule amc_schedule 中的一个定时任务
+type Schedule struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Cron        string          `json:"cron"`   // 5 段 cron 表达式（分 时 日 月 周）或 @daily 等简写，按本地时间
+	Target      string          `json:"target"` // keyword_group / brand_patrol / link_inspection
+	Payload     json.RawMessage `json:"payload"`
+	Enabled     bool            `json:"enabled"`
+	NextRunAt   string          `json:"next_run_at"`
+	LastRunAt   string          `json:"last_run_at"`
+	LastStatus  string          `json:"last_status"`  // ok / failed / running / skipped
+	LastMessage string          `json:"last_message"` // 执行结果摘要或失败原因
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// SCHEDULE_COLUMNS 与 scanSchedule 对应的列
+const SCHEDULE_COLUMNS = `id, name, cron, target, payload, enabled, COALESCE(next_run_at, ''), COALESCE(last_run_at, ''),
+	COALESCE(last_status, ''), COALESCE(last_message, ''), created_at, updated_at`
+
+// scanSchedule 读取 SCHEDULE_COLUMNS
+func scanSchedule(row rowScanner) (Schedule, error) {
+	var s Schedule
+	var payload string
+	err := row.Scan(&s.ID, &s.Name, &s.Cron, &s.Target, &payload, &s.Enabled, &s.NextRunAt, &s.LastRunAt,
+		&s.LastStatus, &s.LastMessage, &s.CreatedAt, &s.UpdatedAt)
+	s.Payload = json.RawMessage(payload)
+	return s, err
+}
+
+// validateSchedulePayload 校验执行对象和对应的 payload
+func validateSchedulePayload(target string, payload json.RawMessage) error {
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	switch target {
+	case SCHEDULE_TARGET_KEYWORD_GROUP:
+		_, err := scheduleKeywordTasks(payload)
+		return err
+	case SCHEDULE_TARGET_BRAND_PATROL:
+		var b BrandPatrolTarget
+		if err := json.Unmarshal(payload, &b); err != nil {
+			return fmt.Errorf("payload 解析失败: %v", err)
+		}
+		if b.Batch < 0 || b.MaxASINs < 0 {
+			return fmt.Errorf("batch 和 max_asins 不能为负数")
+		}
+		return nil
+	case SCHEDULE_TARGET_LINK_INSPECTION:
+		_, _, err := scheduleInspectionItems(payload)
+		return err
+	default:
+		return fmt.Errorf("target 取值为 %s、%s 或 %s: %s",
+			SCHEDULE_TARGET_KEYWORD_GROUP, SCHEDULE_TARGET_BRAND_PATROL, SCHEDULE_TARGET_LINK_INSPECTION, target)
+	}
+}
+
+// scheduleKeywordTasks 解析关键词组，未指定 recrawl 时按 force 处理，使每次执行都重新爬取
+func scheduleKeywordTasks(payload json.RawMessage) ([]NewKeywordTask, error) {
+	var req CrawlRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("payload 解析失败: %v", err)
+	}
+	if len(req.Keywords) == 0 && len(req.Tasks) == 0 {
+		return nil, fmt.Errorf("keywords 和 tasks 不能都为空")
+	}
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		return nil, err
+	}
+	if req.Recrawl == "" {
+		req.Recrawl = RECRAWL_FORCE
+	}
+	return buildKeywordTasks(req)
+}
+
+// scheduleInspectionItems 解析巡检清单
+func scheduleInspectionItems(payload json.RawMessage) (ASINInspectionRequest, []LinkInspectionItem, error) {
+	var req ASINInspectionRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, nil, fmt.Errorf("payload 解析失败: %v", err)
+	}
+	items, err := buildInspectionItems(req, ASIN_INSPECTION_JOB_MAX_ITEMS)
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	return req, items, err
+}
+
+// nextScheduleRun cron 表达式在 now 之后的下一次执行时间，不会再执行时返回 NULL
+func nextScheduleRun(expr string, now time.Time) (interface{}, error) {
+	c, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	next := c.Next(now.Local())
+	if next.IsZero() {
+		return nil, nil
+	}
+	return next.Format(SCHEDULE_TIME_LAYOUT), nil
+}
+
+// 定时任务通知 channel，立即执行定时任务后唤醒调度器
+var scheduleNotify = make(chan struct{}, 1)
+
+// notifyScheduler 唤醒调度器
+func notifyScheduler() {
+	select {
+	case scheduleNotify <- struct{}{}:
+	default:
+	}
+}
+
+// Scheduler 定时任务调度器
+// 每台 HTTP 服务主机都运行调度器，每轮检查前通过 GET_LOCK 争用 SCHEDULER_LOCK，只有持有锁的主机执行到期的定时任务
+type Scheduler struct {
+	wg    sync.WaitGroup
+	brand sync.Mutex // 同一进程内同时只执行一个品牌巡查
+}
+
+// StartScheduler 启动定时任务调度器，返回的函数等待调度器和执行中的品牌巡查退出
+func StartScheduler(ctx context.Context) (wait func()) {
+	s := &Scheduler{}
+	if app.Schedule.Poll_seconds < 0 {
+		log.Infof("schedule.poll_seconds 小于 0，不执行定时任务")
+		return s.wg.Wait
+	}
+	s.wg.Add(1)
+	go s.run(ctx)
+	return s.wg.Wait
+}
+
+// run 调度器主循环
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(seconds(app.Schedule.Poll_seconds))
+	defer ticker.Stop()
+
+	for {
+		s.runDueSchedules(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-scheduleNotify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueSchedules 持有 SCHEDULER_LOCK 时执行所有到期的定时任务
+// 命名锁属于数据库连接，加锁和解锁必须使用同一个连接
+func (s *Scheduler) runDueSchedules(ctx context.Context) {
+	conn, err := app.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("定时任务获取数据库连接失败: %v", err)
+		}
+		return
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", SCHEDULER_LOCK).Scan(&locked); err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("获取定时任务锁失败: %v", err)
+		}
+		return
+	}
+	if locked.Int64 != 1 {
+		// 其他主机正在执行
+		return
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", SCHEDULER_LOCK); err != nil {
+			log.Warnf("释放定时任务锁失败: %v", err)
+		}
+	}()
+
+	due, err := loadDueSchedules(ctx, time.Now())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("读取定时任务失败: %v", err)
+		}
+		return
+	}
+	for _, sc := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.runSchedule(ctx, sc)
+	}
+}
+
+// loadDueSchedules 读取已启用且 next_run_at 不晚于 now 的定时任务；next_run_at 为空的按 cron 补上
+func loadDueSchedules(ctx context.Context, now time.Time) ([]Schedule, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT "+SCHEDULE_COLUMNS+" FROM amc_schedule WHERE enabled = 1 ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Schedule
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if sc.NextRunAt == "" {
+			next, err := nextScheduleRun(sc.Cron, now)
+			if err == nil && next != nil {
+				app.db.ExecContext(ctx, "UPDATE amc_schedule SET next_run_at = ? WHERE id = ? AND next_run_at IS NULL", next, sc.ID)
+			}
+			continue
+		}
+		at, err := time.ParseInLocation(SCHEDULE_TIME_LAYOUT, sc.NextRunAt, time.Local)
+		if err != nil {
+			log.Warnf("定时任务 ID:%d 的 next_run_at 无效: %s", sc.ID, sc.NextRunAt)
+			continue
+		}
+		if !at.After(now) {
+			due = append(due, sc)
+		}
+	}
+	return due, rows.Err()
+}
+
+// runSchedule 先将 next_run_at 推进到下一次，再执行定时任务并记录结果
+// 错过的多次执行（如服务停机期间）只补执行一次
+func (s *Scheduler) runSchedule(ctx context.Context, sc Schedule) {
+	now := time.Now()
+	next, err := nextScheduleRun(sc.Cron, now)
+	if err != nil {
+		log.Errorf("定时任务 %s (ID:%d) 的 cron 表达式无效: %v", sc.Name, sc.ID, err)
+		s.record(sc.ID, SCHEDULE_RUN_FAILED, err.Error())
+		app.db.Exec("UPDATE amc_schedule SET next_run_at = NULL, enabled = 0 WHERE id = ?", sc.ID)
+		return
+	}
+	// 以读到的 next_run_at 为条件，防止期间被修改或已被执行
+	r, err := app.db.ExecContext(ctx, "UPDATE amc_schedule SET next_run_at = ?, last_run_at = ? WHERE id = ? AND enabled = 1 AND next_run_at = ?",
+		next, now.Format(SCHEDULE_TIME_LAYOUT), sc.ID, sc.NextRunAt)
+	if err != nil {
+		log.Errorf("更新定时任务 ID:%d 失败: %v", sc.ID, err)
+		return
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return
+	}
+
+	log.Infof("执行定时任务 %s (ID:%d, %s)", sc.Name, sc.ID, sc.Target)
+	status, message := s.execute(ctx, sc)
+	if status == SCHEDULE_RUN_FAILED {
+		log.Errorf("定时任务 %s (ID:%d) 执行失败: %s", sc.Name, sc.ID, message)
+	} else {
+		log.Infof("定时任务 %s (ID:%d): %s", sc.Name, sc.ID, message)
+	}
+	s.record(sc.ID, status, message)
+}
+
+// record 记录最近一次执行的结果
+func (s *Scheduler) record(id int64, status, message string) {
+	_, err := app.db.Exec("UPDATE amc_schedule SET last_status = ?, last_message = ? WHERE id = ?",
+		status, truncateRunes(message, 1024), id)
+	if err != nil {
+		log.Errorf("记录定时任务 ID:%d 执行结果失败: %v", id, err)
+	}
+}
+
+// execute 按执行对象提交任务，返回执行结果和摘要
+func (s *Scheduler) execute(ctx context.Context, sc Schedule) (string, string) {
+	switch sc.Target {
+	case SCHEDULE_TARGET_KEYWORD_GROUP:
+		return runScheduledKeywordGroup(sc.Payload)
+	case SCHEDULE_TARGET_LINK_INSPECTION:
+		return runScheduledInspection(ctx, sc.Payload)
+	case SCHEDULE_TARGET_BRAND_PATROL:
+		return s.startBrandPatrol(ctx, sc)
+	default:
+		return SCHEDULE_RUN_FAILED, fmt.Sprintf("未知的 target: %s", sc.Target)
+	}
+}
+
+// runScheduledKeywordGroup 将关键词组写入 amc_category，已存在的关键词按 recrawl 重新排队
+func runScheduledKeywordGroup(payload json.RawMessage) (string, string) {
+	tasks, err := scheduleKeywordTasks(payload)
+	if err != nil {
+		return SCHEDULE_RUN_FAILED, err.Error()
+	}
+	var inserted, requeued, skipped int
+	var failed []string
+	for _, t := range tasks {
+		result, err := submitKeywordTask(t)
+		switch {
+		case err != nil:
+			log.Errorf("定时任务插入关键词失败: %s, 错误: %v", t.Keyword, err)
+			failed = append(failed, t.Keyword)
+		case result == SUBMIT_INSERTED:
+			inserted++
+		case result == SUBMIT_REQUEUED:
+			requeued++
+		default:
+			skipped++
+		}
+	}
+	notifyTaskWorkers()
+
+	message := fmt.Sprintf("共 %d 个关键词，新增 %d 个，重新排队 %d 个，跳过 %d 个", len(tasks), inserted, requeued, skipped)
+	if len(failed) > 0 {
+		return SCHEDULE_RUN_FAILED, message + fmt.Sprintf("，写入失败 %d 个: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return SCHEDULE_RUN_OK, message
+}
+
+// runScheduledInspection 将巡检清单保存为异步巡检任务
+func runScheduledInspection(ctx context.Context, payload json.RawMessage) (string, string) {
+	req, items, err := scheduleInspectionItems(payload)
+	if err != nil {
+		return SCHEDULE_RUN_FAILED, err.Error()
+	}
+	domain := normalizeDomain(req.Domain)
+	if domain == "" {
+		domain = normalizeDomain(app.Domain)
+	}
+	id, err := createInspectionJob(ctx, req, domain, items)
+	if err != nil {
+		return SCHEDULE_RUN_FAILED, fmt.Sprintf("保存巡检任务失败: %v", err)
+	}
+	notifyInspectionJobWorkers()
+	return SCHEDULE_RUN_OK, fmt.Sprintf("已提交巡检任务 ID:%d 共 %d 条", id, len(items))
+}
+
+// startBrandPatrol 在后台执行一批品牌巡查，结束后记录结果；上一次尚未结束时跳过
+func (s *Scheduler) startBrandPatrol(ctx context.Context, sc Schedule) (string, string) {
+	var b BrandPatrolTarget
+	if len(sc.Payload) > 0 {
+		if err := json.Unmarshal(sc.Payload, &b); err != nil {
+			return SCHEDULE_RUN_FAILED, fmt.Sprintf("payload 解析失败: %v", err)
+		}
+	}
+	b = b.withDefaults()
+	if !s.brand.TryLock() {
+		return SCHEDULE_RUN_SKIPPED, "上一次品牌巡查尚未结束"
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.brand.Unlock()
+		status, message := runBrandPatrolBatch(ctx, b)
+		log.Infof("定时任务 %s (ID:%d) 品牌巡查结束: %s", sc.Name, sc.ID, message)
+		s.record(sc.ID, status, message)
+	}()
+	return SCHEDULE_RUN_RUNNING, fmt.Sprintf("品牌巡查已开始，本次最多 %d 个品牌", b.Batch)
+}
+
+// runBrandPatrolBatch 巡查一批品牌
+func runBrandPatrolBatch(ctx context.Context, b BrandPatrolTarget) (string, string) {
+	brandConsecutiveFailures = 0
+	if affected := releaseBrandClaims(); affected > 0 {
+		log.Infof("恢复上次中断的 %d 个品牌", affected)
+	}
+	if b.Restart {
+		if n, err := restartBrandPatrol(ctx); err != nil {
+			return SCHEDULE_RUN_FAILED, fmt.Sprintf("重置品牌巡查状态失败: %v", err)
+		} else if n > 0 {
+			log.Infof("没有待巡查的品牌，已将 %d 个品牌重置为待巡查", n)
+		}
+	}
+
+	processed, err := processBrandBatch(ctx, b.Batch, b.MaxASINs)
+	if ctx.Err() != nil {
+		log.Infof("品牌巡查被中断，释放 %d 个未处理的品牌", releaseBrandClaims())
+		return SCHEDULE_RUN_FAILED, fmt.Sprintf("服务退出，已巡查 %d 个品牌", processed)
+	}
+	if err != nil {
+		// 本批其余已认领的品牌重置为待处理
+		log.Infof("品牌巡查暂停，释放 %d 个未处理的品牌", releaseBrandClaims())
+	}
+	if err == ERROR_NOT_503 {
+		return SCHEDULE_RUN_FAILED, fmt.Sprintf("遇到503错误，已巡查 %d 个品牌，请检查网络或更换Cookie", processed)
+	}
+	if err != nil {
+		return SCHEDULE_RUN_FAILED, fmt.Sprintf("Cookie验证页面，已巡查 %d 个品牌，请获取新Cookie", processed)
+	}
+	return SCHEDULE_RUN_OK, fmt.Sprintf("已巡查 %d 个品牌", processed)
+}
+
+// restartBrandPatrol 没有待巡查的品牌时，将已完成、失败和无结果的品牌重置为待巡查
+func restartBrandPatrol(ctx context.Context) (int64, error) {
+	var pending int
+	if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM available_brand_domains WHERE patrol_status = ?", BRAND_PATROL_PENDING).Scan(&pending); err != nil {
+		return 0, err
+	}
+	if pending > 0 {
+		return 0, nil
+	}
+	r, err := app.db.ExecContext(ctx, "UPDATE available_brand_domains SET patrol_status = ? WHERE patrol_status IN (?, ?, ?)",
+		BRAND_PATROL_PENDING, BRAND_PATROL_COMPLETED, BRAND_PATROL_FAILED, BRAND_PATROL_NO_RESULT)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
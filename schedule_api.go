@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// ScheduleRequest 新增或修改定时任务的请求体，修改时未填写的项保持不变
+type ScheduleRequest struct {
+	Name    string          `json:"name"`
+	Cron    string          `json:"cron"`
+	Target  string          `json:"target"`
+	Payload json.RawMessage `json:"payload"`
+	Enabled *bool           `json:"enabled"` // 新增时默认 true
+}
+
+// apply 将请求合并到 s 并校验
+func (req ScheduleRequest) apply(s Schedule) (Schedule, error) {
+	if req.Name != "" {
+		s.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Cron != "" {
+		s.Cron = strings.TrimSpace(req.Cron)
+	}
+	if req.Target != "" {
+		s.Target = req.Target
+	}
+	if len(req.Payload) > 0 {
+		s.Payload = req.Payload
+	}
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+
+	if s.Name == "" {
+		return s, fmt.Errorf("name 不能为空")
+	}
+	if s.Cron == "" {
+		return s, fmt.Errorf("cron 不能为空")
+	}
+	if _, err := parseCron(s.Cron); err != nil {
+		return s, err
+	}
+	if len(s.Payload) == 0 {
+		s.Payload = json.RawMessage("{}")
+	}
+	if err := validateSchedulePayload(s.Target, s.Payload); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// parseSchedulePath 解析 /api/schedules/{id}[/run]
+func parseSchedulePath(path string) (id int64, action string, ok bool) {
+	rest := strings.Trim(strings.TrimPrefix(path, "/api/schedules/"), "/")
+	if rest == "" {
+		return 0, "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "run") {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", false
+	}
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	return id, action, true
+}
+
+// loadSchedule 读取定时任务
+func loadSchedule(ctx context.Context, id int64) (Schedule, error) {
+	return scanSchedule(app.db.QueryRowContext(ctx, "SELECT "+SCHEDULE_COLUMNS+" FROM amc_schedule WHERE id = ?", id))
+}
+
+// listSchedules 全部定时任务，按 ID 排序
+func listSchedules(ctx context.Context) ([]Schedule, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT "+SCHEDULE_COLUMNS+" FROM amc_schedule ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// handleSchedules 查询全部定时任务或新增定时任务
+func handleSchedules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := listSchedules(r.Context())
+		if err != nil {
+			log.Errorf("查询定时任务失败: %v", err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "查询定时任务失败",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, APIResponse{
+			Code:    0,
+			Message: "ok",
+			Data:    list,
+		})
+
+	case http.MethodPost:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: fmt.Sprintf("请求解析失败: %v", err),
+			})
+			return
+		}
+		s, err := req.apply(Schedule{Enabled: true})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: err.Error(),
+			})
+			return
+		}
+		next, _ := nextScheduleRun(s.Cron, time.Now())
+		res, err := app.db.ExecContext(r.Context(),
+			"INSERT INTO amc_schedule (name, cron, target, payload, enabled, next_run_at) VALUES (?, ?, ?, ?, ?, ?)",
+			s.Name, s.Cron, s.Target, string(s.Payload), s.Enabled, next)
+		if err != nil {
+			log.Errorf("保存定时任务失败: %v", err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "保存定时任务失败",
+			})
+			return
+		}
+		id, _ := res.LastInsertId()
+		log.Infof("新增定时任务 %s (ID:%d, %s, %s)", s.Name, id, s.Cron, s.Target)
+		writeSchedule(w, r, http.StatusCreated, id)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 和 POST 方法",
+		})
+	}
+}
+
+// handleSchedule 查看、修改、删除或立即执行定时任务
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, action, ok := parseSchedulePath(r.URL.Path)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{
+			Code:    -1,
+			Message: "定时任务不存在",
+		})
+		return
+	}
+
+	if action == "run" {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+				Code:    -1,
+				Message: "只支持 POST 方法",
+			})
+			return
+		}
+		// 由调度器在持有锁的主机上执行，避免与定时执行重复
+		res, err := app.db.ExecContext(r.Context(), "UPDATE amc_schedule SET next_run_at = ? WHERE id = ? AND enabled = 1",
+			time.Now().Format(SCHEDULE_TIME_LAYOUT), id)
+		if err != nil {
+			log.Errorf("更新定时任务失败 ID:%d: %v", id, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "更新定时任务失败",
+			})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			if _, err := loadSchedule(r.Context(), id); err == sql.ErrNoRows {
+				writeJSON(w, http.StatusNotFound, APIResponse{
+					Code:    -1,
+					Message: "定时任务不存在",
+				})
+				return
+			}
+			writeJSON(w, http.StatusConflict, APIResponse{
+				Code:    -1,
+				Message: "定时任务已停用或已在等待执行",
+			})
+			return
+		}
+		log.Infof("定时任务 ID:%d 将立即执行", id)
+		notifyScheduler()
+		writeSchedule(w, r, http.StatusAccepted, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeSchedule(w, r, http.StatusOK, id)
+
+	case http.MethodPut:
+		current, err := loadSchedule(r.Context(), id)
+		if err == sql.ErrNoRows {
+			writeJSON(w, http.StatusNotFound, APIResponse{
+				Code:    -1,
+				Message: "定时任务不存在",
+			})
+			return
+		}
+		if err != nil {
+			log.Errorf("查询定时任务失败 ID:%d: %v", id, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "查询定时任务失败",
+			})
+			return
+		}
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: fmt.Sprintf("请求解析失败: %v", err),
+			})
+			return
+		}
+		s, err := req.apply(current)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, APIResponse{
+				Code:    -1,
+				Message: err.Error(),
+			})
+			return
+		}
+		// 修改后按新的 cron 重新计算下一次执行时间
+		next, _ := nextScheduleRun(s.Cron, time.Now())
+		_, err = app.db.ExecContext(r.Context(),
+			"UPDATE amc_schedule SET name = ?, cron = ?, target = ?, payload = ?, enabled = ?, next_run_at = ? WHERE id = ?",
+			s.Name, s.Cron, s.Target, string(s.Payload), s.Enabled, next, id)
+		if err != nil {
+			log.Errorf("更新定时任务失败 ID:%d: %v", id, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "更新定时任务失败",
+			})
+			return
+		}
+		log.Infof("修改定时任务 %s (ID:%d, %s, %s)", s.Name, id, s.Cron, s.Target)
+		writeSchedule(w, r, http.StatusOK, id)
+
+	case http.MethodDelete:
+		res, err := app.db.ExecContext(r.Context(), "DELETE FROM amc_schedule WHERE id = ?", id)
+		if err != nil {
+			log.Errorf("删除定时任务失败 ID:%d: %v", id, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "删除定时任务失败",
+			})
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeJSON(w, http.StatusNotFound, APIResponse{
+				Code:    -1,
+				Message: "定时任务不存在",
+			})
+			return
+		}
+		log.Infof("删除定时任务 ID:%d", id)
+		writeJSON(w, http.StatusOK, APIResponse{
+			Code:    0,
+			Message: "ok",
+		})
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET、PUT 和 DELETE 方法",
+		})
+	}
+}
+
+// writeSchedule 返回定时任务的当前状态
+func writeSchedule(w http.ResponseWriter, r *http.Request, code int, id int64) {
+	s, err := loadSchedule(r.Context(), id)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusNotFound, APIResponse{
+			Code:    -1,
+			Message: "定时任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		log.Errorf("查询定时任务失败 ID:%d: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询定时任务失败",
+		})
+		return
+	}
+	writeJSON(w, code, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data:    s,
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSchedulePayload(t *testing.T) {
+	ok := []struct {
+		target, payload string
+	}{
+		{SCHEDULE_TARGET_KEYWORD_GROUP, `{"keywords": ["nike"], "domain": "MX"}`},
+		{SCHEDULE_TARGET_BRAND_PATROL, `{}`},
+		{SCHEDULE_TARGET_BRAND_PATROL, ``},
+		{SCHEDULE_TARGET_BRAND_PATROL, `{"batch": 50, "restart": true}`},
+		{SCHEDULE_TARGET_LINK_INSPECTION, `{"items": [{"asin": "B0C1234567"}]}`},
+	}
+	for _, c := range ok {
+		if err := validateSchedulePayload(c.target, json.RawMessage(c.payload)); err != nil {
+			t.Errorf("%s %s: %v", c.target, c.payload, err)
+		}
+	}
+	bad := []struct {
+		target, payload string
+	}{
+		{"crawl", `{}`},
+		{SCHEDULE_TARGET_KEYWORD_GROUP, `{}`},
+		{SCHEDULE_TARGET_KEYWORD_GROUP, `{"keywords": ["nike"], "domain": "ZZ"}`},
+		{SCHEDULE_TARGET_KEYWORD_GROUP, `{"keywords": ["nike"], "callback_url": "ftp://example.com"}`},
+		{SCHEDULE_TARGET_BRAND_PATROL, `{"batch": -1}`},
+		{SCHEDULE_TARGET_BRAND_PATROL, `[]`},
+		{SCHEDULE_TARGET_LINK_INSPECTION, `{"items": []}`},
+	}
+	for _, c := range bad {
+		if err := validateSchedulePayload(c.target, json.RawMessage(c.payload)); err == nil {
+			t.Errorf("%s %s accepted", c.target, c.payload)
+		}
+	}
+}
+
+func TestScheduleKeywordTasksDefaultsToForce(t *testing.T) {
+	tasks, err := scheduleKeywordTasks(json.RawMessage(`{"keywords": ["nike"], "tasks": [{"keyword": "puma", "recrawl": "skip"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "nike", tasks[0].Recrawl, RECRAWL_FORCE)
+	assertEqual(t, "puma", tasks[1].Recrawl, RECRAWL_SKIP)
+}
+
+func TestBrandPatrolTargetDefaults(t *testing.T) {
+	old := app.Brand
+	t.Cleanup(func() { app.Brand = old })
+
+	app.Brand = BrandConfig{}
+	b := BrandPatrolTarget{}.withDefaults()
+	assertEqual(t, "built-in", fmt.Sprintf("%d/%d", b.Batch, b.MaxASINs), "100/5")
+
+	app.Brand = BrandConfig{Batch: 20, MaxASINs: 3}
+	b = BrandPatrolTarget{MaxASINs: 8}.withDefaults()
+	assertEqual(t, "config", fmt.Sprintf("%d/%d", b.Batch, b.MaxASINs), "20/8")
+}
+
+func TestNextScheduleRun(t *testing.T) {
+	next, err := nextScheduleRun("0 3 * * *", time.Date(2026, 10, 18, 10, 30, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "next", fmt.Sprint(next), "2026-10-19 03:00:00")
+
+	next, err = nextScheduleRun("0 0 30 2 *", time.Now())
+	if err != nil || next != nil {
+		t.Errorf("never = %v, %v", next, err)
+	}
+	if _, err := nextScheduleRun("daily", time.Now()); err == nil {
+		t.Error("invalid cron accepted")
+	}
+}
+
+func TestScheduleRequestApply(t *testing.T) {
+	enabled := false
+	s, err := ScheduleRequest{Name: " nightly ", Cron: "@daily", Target: SCHEDULE_TARGET_BRAND_PATROL}.apply(Schedule{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "created", fmt.Sprintf("%s|%s|%s|%v", s.Name, s.Cron, s.Payload, s.Enabled), "nightly|@daily|{}|true")
+
+	s, err = ScheduleRequest{Cron: "0 */6 * * *", Enabled: &enabled}.apply(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "updated", fmt.Sprintf("%s|%s|%s|%v", s.Name, s.Cron, s.Target, s.Enabled), "nightly|0 */6 * * *|brand_patrol|false")
+
+	for _, req := range []ScheduleRequest{
+		{Cron: "@daily", Target: SCHEDULE_TARGET_BRAND_PATROL},
+		{Name: "x", Target: SCHEDULE_TARGET_BRAND_PATROL},
+		{Name: "x", Cron: "61 * * * *", Target: SCHEDULE_TARGET_BRAND_PATROL},
+		{Name: "x", Cron: "@daily", Target: SCHEDULE_TARGET_KEYWORD_GROUP},
+	} {
+		if _, err := req.apply(Schedule{}); err == nil {
+			t.Errorf("%+v accepted", req)
+		}
+	}
+}
+
+func TestParseSchedulePath(t *testing.T) {
+	cases := []struct {
+		path   string
+		id     int64
+		action string
+		ok     bool
+	}{
+		{"/api/schedules/3", 3, "", true},
+		{"/api/schedules/3/", 3, "", true},
+		{"/api/schedules/3/run", 3, "run", true},
+		{"/api/schedules/", 0, "", false},
+		{"/api/schedules/x", 0, "", false},
+		{"/api/schedules/3/pause", 0, "", false},
+		{"/api/schedules/3/run/now", 0, "", false},
+	}
+	for _, c := range cases {
+		id, action, ok := parseSchedulePath(c.path)
+		assertEqual(t, c.path, fmt.Sprintf("%d %s %v", id, action, ok), fmt.Sprintf("%d %s %v", c.id, c.action, c.ok))
+	}
+}
+
+func TestHandleSchedulesRejectsBadRequests(t *testing.T) {
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/schedules", `{`, http.StatusBadRequest},
+		{http.MethodPost, "/api/schedules", `{"name": "x", "cron": "@sometimes", "target": "brand_patrol"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/schedules", ``, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/schedules/x", ``, http.StatusNotFound},
+		{http.MethodGet, "/api/schedules/3/run", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/schedules/3", ``, http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if strings.HasSuffix(c.path, "/api/schedules") {
+			handleSchedules(rec, req)
+		} else {
+			handleSchedule(rec, req)
+		}
+		assertEqual(t, c.method+" "+c.path+" "+c.body, strconv.Itoa(rec.Code), strconv.Itoa(c.want))
+	}
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strings"
 
@@ -27,7 +27,7 @@ type searchStruct struct {
 	product_param string
 }
 
-func (s *searchStruct) main() error {
+func (s *searchStruct) main(ctx context.Context) error {
 	if !app.Exec.Enable.Search {
 		log.Warn("跳过 搜索")
 		return nil
@@ -48,12 +48,15 @@ func (s *searchStruct) main() error {
 	app.Exec.Loop.search_time++
 
 	app.update(MYSQL_APPLICATION_STATUS_SEARCH)
+	defer instance.beginTask("search")()
 
-	row, err := s.get_category()
+	row, err := s.get_category(ctx)
 	if err != nil {
 		log.Error(err)
 		log.Infof("------------------------")
+		return err
 	}
+	defer row.Close()
 	s.start = 1
 	s.end = 2 // 为了适应亚马逊系统，这里只搜索首页，
 	for row.Next() {
@@ -65,22 +68,24 @@ func (s *searchStruct) main() error {
 			log.Errorf("插入失败 关键词:%s %v", s.zh_key, err)
 			continue
 		}
-		for ; s.start < s.end; s.start++ {
-			h, err := s.request(s.start)
-			switch err {
-			case nil:
+		for ; s.start < s.end && ctx.Err() == nil; s.start++ {
+			h, err := s.request(ctx, s.start)
+			switch {
+			case ctx.Err() != nil:
+				continue
+			case err == nil:
 				break
-			case ERROR_NOT_404:
-			case ERROR_NOT_503:
+			case err == ERROR_EMPTY_RESULTS:
+				log.Infof("搜索无结果 关键词:%s 页面:%d", s.zh_key, s.start)
+				continue
+			case err == ERROR_NOT_404:
+				continue
+			case err == ERROR_NOT_503:
 				s.start--
 				log.Warn("遇到503错误，尝试获取新的Cookie")
+				// 切换成功后，新 cookie 会带上其绑定的浏览器指纹和代理
 				if handleErr := app.handleCookieInvalid(); handleErr != nil {
 					log.Errorf("获取新Cookie失败: %v，等待后重试", handleErr)
-					SmartDelay("503")
-				} else {
-					// Cookie 切换成功，同时轮换指纹
-					RotateFingerprint()
-					SmartDelay("503")
 				}
 				continue
 
@@ -88,7 +93,7 @@ func (s *searchStruct) main() error {
 				log.Error(err)
 				continue
 			}
-			s.get_product_url(h)
+			s.get_product_url(ctx, h)
 		}
 		err = s.search_end(insert_id)
 		if err != nil {
@@ -96,21 +101,25 @@ func (s *searchStruct) main() error {
 			continue
 		}
 		s.start = 1
+		if ctx.Err() != nil {
+			log.Infof("收到退出信号，停止搜索")
+			break
+		}
 	}
 	log.Infof("------------------------")
 	return nil
 }
-func (s *searchStruct) get_category() (*sql.Rows, error) {
+func (s *searchStruct) get_category(ctx context.Context) (*sql.Rows, error) {
 	switch app.Exec.Search_priority {
 	case 1:
 		log.Infof("搜索优先级优先")
-		return app.db.Query(`select id,zh_key,en_key from amc_category order by priority DESC`)
+		return app.db.QueryContext(ctx, `select id,zh_key,en_key from amc_category order by priority DESC`)
 	case 2:
 		log.Infof("搜索次数少优先")
-		return app.db.Query(`SELECT c.id, c.zh_key, c.en_key  FROM amc_category c LEFT JOIN amc_search_statistics s ON s.category_id = c.id GROUP BY c.id ORDER BY COUNT(s.category_id),id`)
+		return app.db.QueryContext(ctx, `SELECT c.id, c.zh_key, c.en_key  FROM amc_category c LEFT JOIN amc_search_statistics s ON s.category_id = c.id GROUP BY c.id ORDER BY COUNT(s.category_id),id`)
 	}
 	log.Infof("错误的输入，按搜索优先级优先")
-	return app.db.Query(`select id,zh_key,en_key from amc_category order by priority DESC `)
+	return app.db.QueryContext(ctx, `select id,zh_key,en_key from amc_category order by priority DESC `)
 }
 func (s *searchStruct) search_start() (int64, error) {
 	r, err := app.db.Exec("insert into amc_search_statistics(category_id,app) values(?,?)", s.category_id, app.Basic.App_id)
@@ -136,70 +145,19 @@ func (s *searchStruct) search_end(insert_id int64) error {
 func (s *searchStruct) set_en_key() string {
 	return strings.ReplaceAll(strings.ReplaceAll(s.en_key, " ", "+"), "'", "%27")
 }
-func (s *searchStruct) request(seq int) (*goquery.Document, error) {
+func (s *searchStruct) request(ctx context.Context, seq int) (*goquery.Document, error) {
 	url := fmt.Sprintf("https://%s/s?k=%s&page=%d&dc&crid=2V9436DZJ6IJF&qid=1699839233&sprefix=clothe%%2Caps%%2C552&ref=sr_pg_2", app.Domain, s.en_key, seq)
 	// 链接增加 &dc 表示直接搜索，避免转移到其他关键词
-	fp := GetCurrentFingerprint()
-	err := robot.IsAllow(fp.UserAgent, url)
-	if err != nil {
-		return nil, err
-	}
 	log.Infof("开始搜索 关键词:%s 页面:%d url:%s", s.zh_key, seq, url)
 
-	client := get_client()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	SmartDelay("normal")
-	if _, err := app.get_cookie(); err != nil {
-		log.Error(err)
-	}
-	app.setCommonHeaders(req)
-	if referer := GetRandomReferer(app.Domain); referer != "" {
-		req.Header.Set("Referer", referer)
-	}
-
-	resp, err := client.Do(req)
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: url, Mode: FETCH_MODE_SEARCH})
 	if err != nil {
-		log.Errorf("内部错误:%v", err)
 		return nil, err
-
-	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		break
-	case 404:
-		return nil, ERROR_NOT_404
-	case 503:
-		return nil, ERROR_NOT_503
-	default:
-		return nil, fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("内部错误:%v", err)
 	}
-
-	// 检测验证页面（亚马逊会要求人机验证）
-	title := doc.Find("title").Text()
-	if strings.Contains(title, "Enter the characters you see below") ||
-		strings.Contains(title, "Type the characters you see in this image") ||
-		strings.Contains(title, "Robot check") ||
-		doc.Find("form[action*=/captcha/").Length() > 0 ||
-		doc.Find("[method=post]").Find("input[type=text][name*=field-keywords]").Length() > 0 {
-		log.Warn("检测到验证页面，Cookie 可能已失效")
-		return nil, ERROR_VERIFICATION
-	}
-
-	return doc, nil
+	return page.Doc, nil
 }
 
-func (s *searchStruct) get_product_url(doc *goquery.Document) {
+func (s *searchStruct) get_product_url(ctx context.Context, doc *goquery.Document) {
 
 	defer func() {
 		if err := recover(); err != nil {
@@ -214,6 +172,7 @@ func (s *searchStruct) get_product_url(doc *goquery.Document) {
 		res = doc.Find(".s-main-slot").First()
 		if res.Length() == 0 {
 			log.Errorf("错误的页面结构 关键词:%s", s.zh_key)
+			recordParseFailure(app.Domain, FETCH_MODE_SEARCH)
 			return
 		}
 	}
@@ -221,10 +180,17 @@ func (s *searchStruct) get_product_url(doc *goquery.Document) {
 	data_index := res.Find("div[data-index]")
 	if data_index.Length() == 0 {
 		log.Errorf("没有找到商品项 关键词:%s", s.zh_key)
+		recordParseFailure(app.Domain, FETCH_MODE_SEARCH)
 		return
 	}
 	log.Infof("找到商品项数:%d 关键词:%s", data_index.Length(), s.zh_key)
 
+	robots, err := robotsForDomain(ctx, app.Domain)
+	if err != nil {
+		log.Errorf("获取 robots.txt 失败 关键词:%s %v", s.zh_key, err)
+		return
+	}
+
 	// ASIN 计数器
 	withBoughtCount := 0    // 有销量标签的数量
 	noBoughtCount := 0      // 无销量标签的数量
@@ -294,7 +260,7 @@ func (s *searchStruct) get_product_url(doc *goquery.Document) {
 				reviewCount = reviewText
 			}
 
-			if err := robot.IsAllow(userAgent, link); err != nil {
+			if err := robots.IsAllow(robotsUserAgent(), link); err != nil {
 				log.Errorf("此链接不允许访问 关键词:%s %v", s.zh_key, err)
 				return
 			}
@@ -330,7 +296,7 @@ func (s *searchStruct) deal_prouct_url(link string, title string, boughtCount st
 	if strings.Contains(url[0], "/dp/") {
 		asin = strings.Split(url[0], "/dp/")[1]
 	}
-	_, err := app.db.Exec(`INSERT INTO amc_product(url,param,title,asin,keyword,bought_count,price,rating,review_count) values(?,?,?,?,?,?,?,?,?)`, url[0], "/ref="+url[1], title, asin, s.en_key, boughtCount, price, rating, reviewCount)
+	_, err := app.db.Exec(`INSERT INTO amc_product(url,param,title,asin,keyword,domain,bought_count,price,rating,review_count) values(?,?,?,?,?,?,?,?,?,?)`, url[0], "/ref="+url[1], title, asin, s.en_key, app.Domain, boughtCount, price, rating, reviewCount)
 
 	link = fmt.Sprintf("https://%s%s", app.Domain, link)
 	if is_duplicate_entry(err) {
@@ -349,7 +315,7 @@ func (s *searchStruct) deal_prouct_url(link string, title string, boughtCount st
 // searchStartForAPI 为 API 模式插入搜索统计记录
 // category_id 设为 0 表示来自 API 调用
 func (s *searchStruct) searchStartForAPI() (int64, error) {
-	r, err := app.db.Exec("INSERT INTO amc_search_statistics(category_id, app) VALUES(0, ?)", app.Basic.App_id)
+	r, err := app.db.Exec("INSERT INTO amc_search_statistics(category_id, app) VALUES(?, ?)", s.category_id, app.Basic.App_id)
 	if err != nil {
 		return 0, err
 	}
@@ -1,12 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"net/http"
 	"strings"
 
-	"github.com/PuerkitoBio/goquery"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/tengfei-xy/go-log"
 )
@@ -48,15 +47,15 @@ func (seller *sellerStruct) over() {
 	log.Infof("3. 结束 根据商家页获取商家信息")
 	log.Infof("------------------------")
 }
-func (seller *sellerStruct) start() error {
-	_, err := app.db.Exec("UPDATE amc_seller SET app_id = ? WHERE all_status = ? and (app_id=? or app_id=?) LIMIT 100", app.Basic.App_id, MYSQL_SELLER_STATUS_INFO_INSERT, 0, app.Basic.App_id)
+func (seller *sellerStruct) start(ctx context.Context) error {
+	_, err := app.db.ExecContext(ctx, "UPDATE amc_seller SET app_id = ?, "+CLAIM_LEASE_SET+" WHERE all_status = ? and (app_id=? or app_id=?) and domain = ? LIMIT 100", app.Basic.App_id, app.Claim.Lease_seconds, MYSQL_SELLER_STATUS_INFO_INSERT, 0, app.Basic.App_id, app.Domain)
 	if err != nil {
 		log.Errorf("更新seller表失败,%v", err)
 		return err
 	}
 	return nil
 }
-func (seller *sellerStruct) main() error {
+func (seller *sellerStruct) main(ctx context.Context) error {
 
 	if !app.Exec.Enable.Seller {
 		log.Warn("跳过 获取商家信息")
@@ -68,6 +67,7 @@ func (seller *sellerStruct) main() error {
 	}
 
 	seller.prepare()
+	defer instance.beginTask("seller")()
 
 	if app.Exec.Loop.Seller == 0 {
 		log.Info("循环次数无限")
@@ -76,11 +76,12 @@ func (seller *sellerStruct) main() error {
 	}
 	app.Exec.Loop.seller_time++
 
-	if err := seller.start(); err != nil {
+	if err := seller.start(ctx); err != nil {
 		return err
 	}
+	defer keepClaims(ctx, "商家", renewSellerClaims)()
 
-	row, err := app.db.Query("select id,seller_id,seller_name,keyword from amc_seller where all_status =? and app_id=?", MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id)
+	row, err := app.db.QueryContext(ctx, "select id,seller_id,seller_name,keyword from amc_seller where all_status =? and app_id=? and domain = ?", MYSQL_SELLER_STATUS_INFO_INSERT, app.Basic.App_id, app.Domain)
 	switch err {
 	case nil:
 		break
@@ -92,6 +93,7 @@ func (seller *sellerStruct) main() error {
 		return err
 
 	}
+	defer row.Close()
 	for row.Next() {
 		seller.seller_name = ""
 		seller.keyword = ""
@@ -109,30 +111,29 @@ func (seller *sellerStruct) main() error {
 		}
 		seller.url = fmt.Sprintf("https://%s/sp?ie=UTF8&seller=%s", app.Domain, seller.seller_id)
 
-		fp := GetCurrentFingerprint()
-		if err := robot.IsAllow(fp.UserAgent, seller.url); err != nil {
-			log.Errorf("%v", err)
-			continue
-		}
-
-		// 添加请求间隔
-		SmartDelay("normal")
-
-		for err := seller.request(); err != nil; {
+		err := seller.request(ctx)
+		for err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			log.Error(err)
-			if err == ERROR_VERIFICATION {
+			if isPageUnrecoverable(err) {
+				break
+			} else if isCookieRejected(err) {
 				// Cookie 失效，标记失效并尝试获取新的
 				if err := app.handleCookieInvalid(); err != nil {
 					log.Errorf("处理 cookie 失效失败: %v", err)
-				} else {
-					RotateFingerprint()
 				}
-				SmartDelay("captcha")
-			} else if err == ERROR_NOT_503 {
-				SmartDelay("503")
-			} else {
-				SmartDelay("error")
 			}
+			// 重试前的等待由限速器统一控制
+			err = seller.request(ctx)
+		}
+		if ctx.Err() != nil {
+			// 收到退出信号，当前商家保持认领状态，退出时统一释放
+			break
+		}
+		if err != nil {
+			continue
 		}
 
 		seller.trnCheck()
@@ -154,47 +155,15 @@ func (seller *sellerStruct) main() error {
 
 // 作用: 根据 seller.url 请求商家信息
 // 举例: 根据 https://www.amazon.co.uk/sp?ie=UTF8&seller=A272CUATTYX3C4 请求商家信息
-func (seller *sellerStruct) request() error {
+func (seller *sellerStruct) request(ctx context.Context) error {
 
 	log.Infof("请求链接 %s", seller.url)
 
-	client := get_client()
-	req, err := http.NewRequest("GET", seller.url, nil)
+	page, err := fetcher.Fetch(ctx, &FetchRequest{URL: seller.url, Mode: FETCH_MODE_SELLER})
 	if err != nil {
 		return err
 	}
-
-	if _, err := app.get_cookie(); err != nil {
-		log.Error(err)
-	}
-	app.setCommonHeaders(req)
-	if referer := GetRandomReferer(app.Domain); referer != "" {
-		req.Header.Set("Referer", referer)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Errorf("内部错误:%v", err)
-		return err
-
-	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case 200:
-		break
-	case 404:
-		return ERROR_NOT_404
-	case 503:
-		return ERROR_NOT_503
-	default:
-		return fmt.Errorf("状态码:%d", resp.StatusCode)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return fmt.Errorf("内部错误:%v", err)
-	}
+	doc := page.Doc
 
 	sellerTxt := doc.Find("div#page-section-detail-seller-info").Find("span").Text()
 
@@ -251,6 +220,7 @@ func (seller *sellerStruct) request() error {
 		}
 	} else {
 		log.Warn("未找到 FB 摘要元素")
+		recordParseFailure(page.Domain, FETCH_MODE_SELLER)
 	}
 
 	seller.all_status = MYSQL_SELLER_STATUS_INFO_OK
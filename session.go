@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// sessionMu 保护 app 中的会话状态（cookie、浏览器指纹、代理）
+// 多个任务消费者并发请求时共用同一会话，读写这些字段都需要持有此锁
+var sessionMu sync.Mutex
+
+// requestSession 一次请求开始时的会话快照，请求过程中会话被其他消费者切换也不受影响
+type requestSession struct {
+	cookie    string
+	cookieID  int64
+	profile   *BrowserProfile
+	proxyAddr string
+}
+
+// beginSession 刷新 cookie 并返回当前会话快照
+func (app *appConfig) beginSession(useCookie bool) requestSession {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	if useCookie && app.db != nil {
+		if _, err := app.get_cookie(); err != nil {
+			log.Warnf("获取 cookie 失败: %v", err)
+		}
+	}
+	if app.browserProfile == nil {
+		app.browserProfile = getRandomBrowserProfile()
+	}
+	s := requestSession{
+		cookie:   app.cookie,
+		cookieID: app.cookieID,
+		profile:  app.browserProfile,
+	}
+	if app.Proxy.Enable {
+		s.proxyAddr = app.currentProxyAddr()
+	}
+	return s
+}
+
+// failoverSession 会话代理 addr 请求失败后尝试改绑，返回之后使用的代理和是否发生了切换
+// 其他消费者已经改绑时直接沿用新代理
+func (app *appConfig) failoverSession(addr string, cause error) (string, bool) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if app.proxyAddr != addr {
+		return app.proxyAddr, app.proxyAddr != ""
+	}
+	if app.failoverProxy(cause) {
+		return app.proxyAddr, true
+	}
+	return addr, false
+}
+
+// endSession 合并响应中的 Set-Cookie；会话已切换到其他 cookie 时丢弃
+// rejected 为真时记下被拒绝的 cookie，供 handleCookieInvalid 判断是否需要切换
+func (app *appConfig) endSession(s requestSession, resp *http.Response, rejected bool) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if app.cookieID != s.cookieID {
+		return
+	}
+	if resp != nil {
+		app.storeResponseCookies(resp)
+	}
+	if rejected {
+		app.rejectedCookieID = s.cookieID
+	}
+}
@@ -0,0 +1,25 @@
+-- 数据库扩展脚本：HTTP 接口密钥用量与审计
+-- 用途：配置 auth.keys 后，每个密钥的当日请求数记录在 amc_api_usage（多实例共享每日配额），
+--       写请求以及被拒绝的请求记录在 amc_api_audit，可追溯谁提交了什么
+-- 依赖：无
+
+CREATE TABLE IF NOT EXISTS `amc_api_usage` (
+  `key_name` VARCHAR(64) NOT NULL COMMENT '密钥名',
+  `day` DATE NOT NULL COMMENT '日期',
+  `requests` BIGINT NOT NULL DEFAULT 0 COMMENT '当日请求数',
+  PRIMARY KEY (`key_name`, `day`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='API 密钥每日用量';
+
+CREATE TABLE IF NOT EXISTS `amc_api_audit` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `key_name` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '密钥名，令牌无效时为空',
+  `method` VARCHAR(16) NOT NULL COMMENT '请求方法',
+  `path` VARCHAR(1024) NOT NULL COMMENT '请求路径及查询参数',
+  `status_code` INT NOT NULL COMMENT '响应状态码',
+  `remote_addr` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '来源地址',
+  `body` TEXT COMMENT '请求体（截断至 4096 个字符）',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '请求时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_key_created` (`key_name`, `created_at`),
+  KEY `idx_created` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='API 调用审计日志';
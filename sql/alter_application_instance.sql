@@ -0,0 +1,22 @@
+-- 数据库扩展脚本：amc_application 实例登记与心跳
+-- 用途：各模式（命令行、HTTP 服务、品牌巡查、链接巡检、ASIN）启动时登记主机名、进程号、模式、版本和配置摘要，
+--       运行期间定期写入心跳、当前任务和计数；超过 3 次心跳间隔未更新的实例视为失联（可能已崩溃）
+-- 依赖：sql/alter_application_status.sql（状态 5=中断）
+
+ALTER TABLE `amc_application`
+ADD COLUMN `hostname` VARCHAR(255) DEFAULT NULL COMMENT '主机名' AFTER `app_id`,
+ADD COLUMN `pid` INT DEFAULT NULL COMMENT '进程号' AFTER `hostname`,
+ADD COLUMN `mode` VARCHAR(16) DEFAULT NULL COMMENT '运行模式: cli/serve/brand/link/asin' AFTER `pid`,
+ADD COLUMN `version` VARCHAR(64) DEFAULT NULL COMMENT '程序版本' AFTER `mode`,
+ADD COLUMN `config_hash` CHAR(12) DEFAULT NULL COMMENT '配置文件 sha256 前 12 位' AFTER `version`,
+ADD COLUMN `started_at` DATETIME DEFAULT NULL COMMENT '启动时间' AFTER `config_hash`,
+ADD COLUMN `heartbeat_at` DATETIME DEFAULT NULL COMMENT '最后一次心跳时间' AFTER `started_at`,
+ADD COLUMN `current_task` VARCHAR(255) DEFAULT NULL COMMENT '执行中的任务' AFTER `heartbeat_at`,
+ADD COLUMN `stats` TEXT DEFAULT NULL COMMENT '运行计数（JSON）' AFTER `current_task`;
+
+ALTER TABLE `amc_application`
+ADD INDEX `idx_status_heartbeat` (`status`, `heartbeat_at`);
+
+-- 查看失联的实例（可选，心跳间隔为 10 秒时），也可调用 GET /api/instances?active=1
+-- SELECT id, app_id, hostname, pid, mode, heartbeat_at, current_task FROM `amc_application`
+-- WHERE `status` NOT IN (1, 5) AND (`heartbeat_at` IS NULL OR `heartbeat_at` < NOW() - INTERVAL 30 SECOND);
@@ -0,0 +1,17 @@
+-- 数据库扩展脚本：程序状态增加「中断」
+-- 用途：收到退出信号并保存进度后，amc_application.status 记为 5
+
+CREATE OR REPLACE VIEW `程序状态表` AS
+SELECT
+  `amc_application`.`app_id` AS `app_id`,
+  (CASE
+    WHEN (`amc_application`.`status` = 0) THEN '启动中'
+    WHEN (`amc_application`.`status` = 1) THEN '结束'
+    WHEN (`amc_application`.`status` = 2) THEN '1.搜索页面中'
+    WHEN (`amc_application`.`status` = 3) THEN '2.查找商家中'
+    WHEN (`amc_application`.`status` = 4) THEN '3.确定TRN中'
+    WHEN (`amc_application`.`status` = 5) THEN '中断'
+  END) AS `状态`,
+  `amc_application`.`update` AS `更新时间`
+FROM `amc_application`
+ORDER BY `amc_application`.`update` DESC;
@@ -0,0 +1,26 @@
+-- 数据库扩展脚本：amc_product / amc_seller 批量认领租约
+-- 用途：记录认领时间和租约到期时间，处理期间定期续期；实例崩溃后租约过期的记录由其他实例回收到待处理池
+-- 依赖：无
+
+ALTER TABLE `amc_product`
+ADD COLUMN `claimed_at` DATETIME DEFAULT NULL COMMENT '被 app 认领的时间',
+ADD COLUMN `lease_expires_at` DATETIME DEFAULT NULL COMMENT '认领租约到期时间，过期后回收为未认领';
+
+ALTER TABLE `amc_product`
+ADD INDEX `idx_status_lease` (`status`, `lease_expires_at`);
+
+ALTER TABLE `amc_seller`
+ADD COLUMN `claimed_at` DATETIME DEFAULT NULL COMMENT '被 app_id 认领的时间',
+ADD COLUMN `lease_expires_at` DATETIME DEFAULT NULL COMMENT '认领租约到期时间，过期后回收为未认领';
+
+ALTER TABLE `amc_seller`
+ADD INDEX `idx_all_status_lease` (`all_status`, `lease_expires_at`);
+
+-- 升级前遗留的认领没有租约，不会被自动回收
+-- 确认所有实例已停止后，可执行以下语句让它们在下次启动时被回收（可选）
+-- UPDATE `amc_product` SET `lease_expires_at` = NOW() WHERE `status` IN (1, 3) AND `app` <> 0 AND `lease_expires_at` IS NULL;
+-- UPDATE `amc_seller` SET `lease_expires_at` = NOW() WHERE `all_status` = 0 AND `app_id` <> 0 AND `lease_expires_at` IS NULL;
+
+-- 查看各 app_id 持有的认领（可选，也可调用 GET /api/claims）
+-- SELECT app, COUNT(*), MIN(claimed_at), MAX(lease_expires_at) FROM `amc_product` WHERE `status` = 1 GROUP BY app;
+-- SELECT app_id, COUNT(*), MIN(claimed_at), MAX(lease_expires_at) FROM `amc_seller` WHERE `all_status` = 0 AND `app_id` <> 0 GROUP BY app_id;
@@ -0,0 +1,17 @@
+-- 数据库扩展脚本：amc_cookie 健康度与冷却
+-- 用途：按健康度（成功率、休息时间、验证码次数）挑选 cookie，被拒绝后进入冷却而不是直接失效
+-- 依赖：sql/alter_cookie_table.sql（request_count、success_count、last_request）
+
+ALTER TABLE `amc_cookie`
+ADD COLUMN `captcha_count` INT NOT NULL DEFAULT 0 COMMENT '连续被拒绝（验证码/登录墙/503）次数，成功请求后清零' AFTER `last_request`,
+ADD COLUMN `cooldown_until` DATETIME DEFAULT NULL COMMENT '冷却结束时间，冷却期间不会被选用' AFTER `captcha_count`;
+
+ALTER TABLE `amc_cookie`
+ADD INDEX `idx_cooldown_until` (`cooldown_until`);
+
+-- 历史数据中 request_count/success_count 可能为 NULL
+UPDATE `amc_cookie` SET `request_count` = 0 WHERE `request_count` IS NULL;
+UPDATE `amc_cookie` SET `success_count` = 0 WHERE `success_count` IS NULL;
+
+-- 查看 cookie 健康情况（可选）
+-- SELECT id, host_id, status, request_count, success_count, captcha_count, cooldown_until, last_request FROM `amc_cookie`;
@@ -0,0 +1,14 @@
+-- 数据库扩展脚本：cookie 代理改绑记录
+-- 用途：cookie 绑定的代理不可达时，程序会自动改绑到其他可达代理并记录到此表
+
+CREATE TABLE IF NOT EXISTS `amc_cookie_rebind` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `cookie_id` int(11) NOT NULL COMMENT 'amc_cookie.id',
+  `host_id` tinyint(1) DEFAULT NULL COMMENT '发生改绑的主机标识',
+  `old_proxy` varchar(100) NOT NULL DEFAULT '' COMMENT '原代理地址',
+  `new_proxy` varchar(100) NOT NULL DEFAULT '' COMMENT '新代理地址',
+  `reason` varchar(255) NOT NULL DEFAULT '' COMMENT '改绑原因（请求错误信息）',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_cookie_id` (`cookie_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Cookie 代理改绑记录';
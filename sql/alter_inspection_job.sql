@@ -0,0 +1,36 @@
+-- 数据库扩展脚本：异步 ASIN 巡检任务
+-- 用途：POST /api/asin-inspection/jobs 提交的任务和每条巡检结果，HTTP 服务模式的巡检消费者认领执行，
+--       每完成一条保存结果，GET /api/asin-inspection/jobs/{id} 可查看进度和部分结果
+-- 依赖：MySQL 8.0 及以上（认领使用 SELECT ... FOR UPDATE SKIP LOCKED）
+
+CREATE TABLE IF NOT EXISTS `amc_inspection_job` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `external_id` VARCHAR(128) DEFAULT NULL COMMENT '调用方传入的 job_id',
+  `domain` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '默认亚马逊域名',
+  `options` TEXT DEFAULT NULL COMMENT '巡检选项（JSON）',
+  `status` TINYINT NOT NULL DEFAULT 0 COMMENT '任务状态: 0=排队中, 1=执行中, 2=已完成',
+  `total` INT NOT NULL DEFAULT 0 COMMENT '条目总数',
+  `worker_id` VARCHAR(128) DEFAULT NULL COMMENT '认领任务的消费者（主机名:进程号:序号）',
+  `lease_expires_at` DATETIME DEFAULT NULL COMMENT '认领租约到期时间，过期后可被其他消费者重新认领',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '提交时间',
+  `started_at` DATETIME DEFAULT NULL COMMENT '首次开始执行时间',
+  `finished_at` DATETIME DEFAULT NULL COMMENT '完成时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_status_lease` (`status`, `lease_expires_at`),
+  KEY `idx_external_id` (`external_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='异步 ASIN 巡检任务';
+
+CREATE TABLE IF NOT EXISTS `amc_inspection_item` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `job_id` BIGINT NOT NULL COMMENT 'amc_inspection_job.id',
+  `seq` INT NOT NULL COMMENT '提交顺序，xlsx 按此顺序输出',
+  `input` VARCHAR(2048) NOT NULL COMMENT '原始输入（ASIN 或链接）',
+  `url` VARCHAR(2048) NOT NULL COMMENT '巡检的商品链接',
+  `asin` VARCHAR(16) NOT NULL DEFAULT '' COMMENT '输入 ASIN',
+  `domain` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '亚马逊域名',
+  `status` TINYINT NOT NULL DEFAULT 0 COMMENT '条目状态: 0=待巡检, 1=成功, 2=失败',
+  `result` MEDIUMTEXT DEFAULT NULL COMMENT '巡检结果（JSON）',
+  `captured_at` VARCHAR(32) DEFAULT NULL COMMENT '巡检时间（RFC3339，UTC）',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_job_seq` (`job_id`, `seq`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='异步 ASIN 巡检条目';
@@ -0,0 +1,25 @@
+-- 数据库扩展脚本：商品、卖家所属站点
+-- 用途：同一关键词可以提交到多个亚马逊站点，商品和卖家按 (url, domain)、(seller_id, domain) 唯一，
+--       不同站点的同一商品路径或卖家各自保存，任务详情和 GET /api/products、/api/sellers 可按站点区分
+-- 依赖：sql/alter_task_options.sql、sql/alter_result_timestamps.sql
+
+ALTER TABLE `amc_product`
+ADD COLUMN `domain` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '亚马逊站点域名' AFTER `keyword`;
+
+ALTER TABLE `amc_seller`
+ADD COLUMN `domain` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '亚马逊站点域名' AFTER `keyword`;
+
+-- 已有的商品和卖家都来自配置文件的 domain。将 @domain 改为配置文件 basic.domain 的值后回填
+SET @domain = 'www.amazon.com';
+UPDATE `amc_product` SET `domain` = @domain WHERE `domain` = '';
+UPDATE `amc_seller` SET `domain` = @domain WHERE `domain` = '';
+
+ALTER TABLE `amc_product`
+DROP INDEX `url`,
+ADD UNIQUE KEY `uk_url_domain` (`url`, `domain`),
+ADD INDEX `idx_keyword_domain` (`keyword`, `domain`);
+
+ALTER TABLE `amc_seller`
+DROP INDEX `seller_id_UNIQUE`,
+ADD UNIQUE KEY `uk_seller_id_domain` (`seller_id`, `domain`),
+ADD INDEX `idx_keyword_domain` (`keyword`, `domain`);
@@ -0,0 +1,24 @@
+-- 数据库扩展脚本：商品、卖家入库时间
+-- 用途：GET /api/products、/api/sellers 按入库时间（date_from / date_to）筛选和排序，并为常用筛选字段加索引
+-- 依赖：无；tb_amazon_shop 按已有的 crawl_time 筛选，无需变更
+
+ALTER TABLE `amc_product`
+ADD COLUMN `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '入库时间',
+ADD COLUMN `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '最后修改时间';
+
+ALTER TABLE `amc_product`
+ADD INDEX `idx_keyword` (`keyword`),
+ADD INDEX `idx_asin` (`asin`),
+ADD INDEX `idx_seller_id` (`seller_id`),
+ADD INDEX `idx_brand_name` (`brand_name`),
+ADD INDEX `idx_created_at` (`created_at`);
+
+ALTER TABLE `amc_seller`
+ADD COLUMN `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '入库时间',
+ADD COLUMN `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '最后修改时间';
+
+ALTER TABLE `amc_seller`
+ADD INDEX `idx_keyword` (`keyword`),
+ADD INDEX `idx_created_at` (`created_at`);
+
+-- 执行前已有的记录 created_at 为执行本脚本的时间
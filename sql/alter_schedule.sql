@@ -0,0 +1,21 @@
+-- 数据库扩展脚本：定时任务
+-- 用途：按 cron 表达式定时提交关键词组、执行一批品牌巡查或提交 ASIN/链接巡检清单，通过 /api/schedules 管理；
+--       每台 HTTP 服务主机都运行调度器，通过 GET_LOCK('amc_scheduler') 保证同一时刻只有一台主机执行到期的定时任务
+-- 依赖：sql/alter_task_recrawl.sql（关键词组默认按 recrawl=force 重新排队）、sql/alter_inspection_job.sql
+
+CREATE TABLE IF NOT EXISTS `amc_schedule` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(128) NOT NULL COMMENT '名称',
+  `cron` VARCHAR(128) NOT NULL COMMENT 'cron 表达式（分 时 日 月 周）或 @daily 等简写，按服务所在主机的本地时间',
+  `target` VARCHAR(32) NOT NULL COMMENT '执行对象: keyword_group / brand_patrol / link_inspection',
+  `payload` TEXT NOT NULL COMMENT '执行对象的选项（JSON）',
+  `enabled` TINYINT(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+  `next_run_at` DATETIME DEFAULT NULL COMMENT '下一次执行时间（本地时间）',
+  `last_run_at` DATETIME DEFAULT NULL COMMENT '最近一次执行时间',
+  `last_status` VARCHAR(16) DEFAULT NULL COMMENT '最近一次执行结果: ok / failed / running / skipped',
+  `last_message` VARCHAR(1024) DEFAULT NULL COMMENT '最近一次执行的摘要或失败原因',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_enabled_next` (`enabled`, `next_run_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='定时任务';
@@ -0,0 +1,15 @@
+-- 数据库扩展脚本：amc_category 任务认领与租约
+-- 用途：多个任务消费者（可在不同主机上）通过 SELECT ... FOR UPDATE SKIP LOCKED 原子认领任务，
+--       认领后状态为 3=执行中，执行期间定期续期 lease_expires_at，进程崩溃后租约过期的任务自动被重新认领
+-- 依赖：sql/alter_category.sql（task_status、updated_at），MySQL 8.0 及以上（SKIP LOCKED）
+
+ALTER TABLE `amc_category`
+MODIFY COLUMN `task_status` TINYINT(1) NOT NULL DEFAULT 0 COMMENT '任务状态: 0=待执行, 1=已执行, 2=失败, 3=执行中',
+ADD COLUMN `worker_id` VARCHAR(128) DEFAULT NULL COMMENT '认领任务的消费者（主机名:进程号:序号）' AFTER `task_status`,
+ADD COLUMN `lease_expires_at` DATETIME DEFAULT NULL COMMENT '认领租约到期时间，过期后可被其他消费者重新认领' AFTER `worker_id`;
+
+ALTER TABLE `amc_category`
+ADD INDEX `idx_task_status_lease` (`task_status`, `lease_expires_at`);
+
+-- 查看执行中的任务（可选）
+-- SELECT id, en_key, worker_id, lease_expires_at FROM `amc_category` WHERE `task_status` = 3;
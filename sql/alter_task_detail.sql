@@ -0,0 +1,14 @@
+-- 数据库扩展脚本：关键词任务详情、重试与取消
+-- 用途：记录任务执行到的阶段、失败原因和开始/结束时间，供 GET /api/tasks、/api/tasks/{id} 查询；
+--       POST /api/tasks/{id}/cancel 将任务置为 4=已取消，POST /api/tasks/{id}/retry 将失败或已取消的任务重置为待执行
+-- 依赖：sql/alter_task_claim.sql
+
+ALTER TABLE `amc_category`
+MODIFY COLUMN `task_status` TINYINT(1) NOT NULL DEFAULT 0 COMMENT '任务状态: 0=待执行, 1=已执行, 2=失败, 3=执行中, 4=已取消',
+ADD COLUMN `stage` VARCHAR(16) DEFAULT NULL COMMENT '执行到的阶段: search / product / seller / save' AFTER `lease_expires_at`,
+ADD COLUMN `error_message` VARCHAR(1024) DEFAULT NULL COMMENT '失败原因或部分完成的提示' AFTER `stage`,
+ADD COLUMN `started_at` DATETIME DEFAULT NULL COMMENT '最近一次开始执行的时间' AFTER `error_message`,
+ADD COLUMN `finished_at` DATETIME DEFAULT NULL COMMENT '完成、失败或取消的时间' AFTER `started_at`;
+
+-- 查看失败的任务（可选）
+-- SELECT id, en_key, stage, error_message, finished_at FROM `amc_category` WHERE `task_status` = 2;
@@ -0,0 +1,40 @@
+-- 数据库扩展脚本：关键词任务的站点、优先级和抓取深度
+-- 用途：/api/crawl 提交的每个关键词可指定亚马逊站点（domain）、优先级、最多搜索页数、最多处理商品数和最早执行时间，
+--       任务消费者按 priority 从高到低认领已到 not_before 的任务，一个服务实例可同时处理多个站点
+-- 依赖：sql/alter_task_claim.sql、sql/alter_task_detail.sql
+
+UPDATE `amc_category` SET `priority` = 0 WHERE `priority` IS NULL;
+
+ALTER TABLE `amc_category`
+ADD COLUMN `domain` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '亚马逊站点域名，为空时使用配置文件的 domain' AFTER `en_key`,
+MODIFY COLUMN `priority` INT NOT NULL DEFAULT 0 COMMENT '优先级，越大越先执行',
+ADD COLUMN `max_pages` INT NOT NULL DEFAULT 0 COMMENT '最多搜索的结果页数，0 表示 1 页' AFTER `priority`,
+ADD COLUMN `max_asins` INT NOT NULL DEFAULT 0 COMMENT '最多处理的商品数，0 表示不限' AFTER `max_pages`,
+ADD COLUMN `not_before` DATETIME DEFAULT NULL COMMENT '最早执行时间，为空时立即执行' AFTER `max_asins`;
+
+ALTER TABLE `amc_category`
+ADD INDEX `idx_task_status_priority` (`task_status`, `priority`, `not_before`);
+
+-- 同一关键词可以提交到多个站点：去掉 en_key 上的单列唯一索引（如果有），改为 (en_key, domain) 联合唯一，
+-- 同站点重复提交由联合唯一索引拦截（recrawl=skip 时跳过）
+SET @en_key_unique = (
+  SELECT MIN(INDEX_NAME) FROM (
+    SELECT INDEX_NAME FROM information_schema.STATISTICS
+    WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'amc_category' AND NON_UNIQUE = 0 AND INDEX_NAME <> 'PRIMARY'
+    GROUP BY INDEX_NAME HAVING COUNT(*) = 1 AND MAX(COLUMN_NAME) = 'en_key'
+  ) t
+);
+SET @drop_en_key_unique = IF(@en_key_unique IS NULL, 'DO 0', CONCAT('ALTER TABLE `amc_category` DROP INDEX `', @en_key_unique, '`'));
+PREPARE stmt FROM @drop_en_key_unique;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 旧任务的 domain 为空，执行时使用配置文件的 domain。将 @domain 改为配置文件 basic.domain 的值后回填，
+-- 使旧任务与之后提交到同一站点的任务落在同一个 (en_key, domain) 上，由联合唯一索引去重
+SET @domain = 'www.amazon.com';
+UPDATE `amc_category` SET `domain` = @domain WHERE `domain` = '';
+
+-- 已有重复的 (en_key, domain) 时添加唯一索引会失败，可先检查并清理：
+-- SELECT en_key, domain, COUNT(*) FROM `amc_category` GROUP BY en_key, domain HAVING COUNT(*) > 1;
+ALTER TABLE `amc_category`
+ADD UNIQUE KEY `uk_en_key_domain` (`en_key`, `domain`);
@@ -0,0 +1,15 @@
+-- 数据库扩展脚本：已提交关键词的重新爬取
+-- 用途：记录关键词最近一次完成的时间（completed_at）和自动刷新天数（refresh_days）；
+--       /api/crawl 的 recrawl=force/stale 按 completed_at 判断是否重新排队，
+--       HTTP 服务每 task.refresh_interval 秒将 completed_at 早于 refresh_days 天的已完成关键词重置为待执行
+-- 依赖：sql/alter_task_options.sql
+
+ALTER TABLE `amc_category`
+ADD COLUMN `refresh_days` INT NOT NULL DEFAULT 0 COMMENT '完成后超过该天数自动重新执行，0 表示不自动刷新' AFTER `not_before`,
+ADD COLUMN `completed_at` DATETIME DEFAULT NULL COMMENT '最近一次完成的时间' AFTER `finished_at`;
+
+-- 已完成的旧任务以结束时间（或更新时间）作为最近一次完成的时间
+UPDATE `amc_category` SET `completed_at` = COALESCE(`finished_at`, `updated_at`) WHERE `task_status` = 1;
+
+ALTER TABLE `amc_category`
+ADD INDEX `idx_task_status_completed` (`task_status`, `completed_at`);
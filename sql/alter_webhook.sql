@@ -0,0 +1,35 @@
+-- 数据库扩展脚本：任务完成回调
+-- 用途：/api/crawl 和 /api/asin-inspection/jobs 可携带 callback_url，关键词任务完成、部分完成或失败，
+--       以及巡检任务完成后，向该地址 POST 带 HMAC 签名的 JSON；每次回调及其投递结果记录在 amc_webhook_delivery，
+--       失败按退避间隔重试
+-- 依赖：sql/alter_task_claim.sql、sql/alter_inspection_job.sql，MySQL 8.0 及以上（投递认领使用 SKIP LOCKED）
+
+ALTER TABLE `amc_category`
+ADD COLUMN `callback_url` VARCHAR(1024) DEFAULT NULL COMMENT '任务结束后回调的地址' AFTER `lease_expires_at`;
+
+ALTER TABLE `amc_inspection_job`
+ADD COLUMN `callback_url` VARCHAR(1024) DEFAULT NULL COMMENT '任务完成后回调的地址' AFTER `options`;
+
+CREATE TABLE IF NOT EXISTS `amc_webhook_delivery` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `event` VARCHAR(64) NOT NULL COMMENT '事件: task.completed / task.partial / task.failed / inspection_job.completed',
+  `target_type` VARCHAR(32) NOT NULL COMMENT '回调对象: task=amc_category, inspection_job=amc_inspection_job',
+  `target_id` BIGINT NOT NULL COMMENT '回调对象 ID',
+  `url` VARCHAR(1024) NOT NULL COMMENT '回调地址',
+  `payload` MEDIUMTEXT NOT NULL COMMENT '回调内容（JSON）',
+  `status` TINYINT NOT NULL DEFAULT 0 COMMENT '投递状态: 0=待投递/等待重试, 1=已投递, 2=超过最大次数已放弃',
+  `attempts` INT NOT NULL DEFAULT 0 COMMENT '已投递次数',
+  `next_attempt_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次投递时间',
+  `last_status_code` INT DEFAULT NULL COMMENT '最近一次投递的 HTTP 状态码，0 表示未收到响应',
+  `last_error` VARCHAR(1024) DEFAULT NULL COMMENT '最近一次投递失败的原因',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '登记时间',
+  `delivered_at` DATETIME DEFAULT NULL COMMENT '投递成功时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_status_next` (`status`, `next_attempt_at`),
+  KEY `idx_target` (`target_type`, `target_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='任务完成回调投递记录';
+
+-- 查看投递失败的回调（可选）
+-- SELECT id, event, target_type, target_id, url, attempts, last_status_code, last_error FROM `amc_webhook_delivery` WHERE `status` = 2;
+-- 重新投递（可选）
+-- UPDATE `amc_webhook_delivery` SET `status` = 0, `attempts` = 0, `next_attempt_at` = NOW() WHERE `id` = ?;
@@ -363,7 +363,7 @@ USE `taotie`;
 /*!50001 SET collation_connection      = utf8mb4_general_ci */;
 /*!50001 CREATE ALGORITHM=UNDEFINED */
 /*!50013 DEFINER=`taotie`@`%` SQL SECURITY DEFINER */
-/*!50001 VIEW `程序状态表` AS select `amc_application`.`app_id` AS `app_id`,(case when (`amc_application`.`status` = 0) then '启动中' when (`amc_application`.`status` = 1) then '结束' when (`amc_application`.`status` = 2) then '1.搜索页面中' when (`amc_application`.`status` = 3) then '2.查找商家中' when (`amc_application`.`status` = 4) then '3.确定TRN中' end) AS `状态`,`amc_application`.`update` AS `更新时间` from `amc_application` order by `amc_application`.`update` desc */;
+/*!50001 VIEW `程序状态表` AS select `amc_application`.`app_id` AS `app_id`,(case when (`amc_application`.`status` = 0) then '启动中' when (`amc_application`.`status` = 1) then '结束' when (`amc_application`.`status` = 2) then '1.搜索页面中' when (`amc_application`.`status` = 3) then '2.查找商家中' when (`amc_application`.`status` = 4) then '3.确定TRN中' when (`amc_application`.`status` = 5) then '中断' end) AS `状态`,`amc_application`.`update` AS `更新时间` from `amc_application` order by `amc_application`.`update` desc */;
 /*!50001 SET character_set_client      = @saved_cs_client */;
 /*!50001 SET character_set_results     = @saved_cs_results */;
 /*!50001 SET collation_connection      = @saved_col_connection */;
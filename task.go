@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -10,18 +13,73 @@ import (
 
 // CrawlTask 表示一个爬取任务
 type CrawlTask struct {
-	ID      int64  // 数据库记录 ID
-	Keyword string // 品牌名/关键词
+	ID          int64  // 数据库记录 ID
+	Keyword     string // 品牌名/关键词
+	WorkerID    string // 认领该任务的消费者，更新任务状态时校验
+	CallbackURL string // 任务结束后回调的地址，为空时不回调
+	Domain      string // 站点域名，为空时使用配置文件的 domain
+	MaxPages    int    // 最多搜索的结果页数，0 表示 1 页
+	MaxASINs    int    // 最多处理的商品数，0 表示不限
 }
 
+// domain 任务的站点域名
+func (t CrawlTask) domain() string {
+	if t.Domain != "" {
+		return t.Domain
+	}
+	return app.Domain
+}
+
+// TaskConfig 关键词任务消费者配置
+type TaskConfig struct {
+	Workers          int `yaml:"workers"`          // 并发消费者数量，默认 1
+	Lease_seconds    int `yaml:"lease_seconds"`    // 认领租约时长（秒），执行期间每 1/3 时长续期一次，默认 600
+	Refresh_interval int `yaml:"refresh_interval"` // 检查 refresh_days 到期关键词的间隔（秒），默认 3600，小于 0 不检查
+}
+
+// withDefaults 填充未配置的字段
+func (c TaskConfig) withDefaults() TaskConfig {
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+	if c.Lease_seconds <= 0 {
+		c.Lease_seconds = 600
+	}
+	if c.Refresh_interval == 0 {
+		c.Refresh_interval = 3600
+	}
+	return c
+}
+
+// 任务执行到的阶段，记录在 amc_category.stage
+const (
+	TASK_STAGE_SEARCH  = "search"  // 搜索商品
+	TASK_STAGE_PRODUCT = "product" // 从商品页提取卖家
+	TASK_STAGE_SELLER  = "seller"  // 获取卖家详情
+	TASK_STAGE_SAVE    = "save"    // 保存结果
+)
+
+// TASK_POLL_INTERVAL 消费者定时检查待执行任务的间隔
+const TASK_POLL_INTERVAL = 10 * time.Second
+
 // 任务通知 channel，用于唤醒 Worker
 var taskNotify = make(chan struct{}, 1)
 
-// TaskWorker 任务消费者
+// notifyTaskWorkers 唤醒一个空闲的消费者，已有未处理的通知时忽略
+func notifyTaskWorkers() {
+	select {
+	case taskNotify <- struct{}{}:
+	default:
+	}
+}
+
+// TaskWorker 任务消费者，启动多个 goroutine 并发认领并执行任务
 type TaskWorker struct {
 	wg      sync.WaitGroup
 	stopCh  chan struct{}
 	running bool
+	workers int
+	lease   time.Duration
 }
 
 var taskWorker *TaskWorker
@@ -29,39 +87,59 @@ var taskWorker *TaskWorker
 // InitTaskWorker 初始化任务消费者
 func InitTaskWorker() {
 	taskWorker = &TaskWorker{
-		stopCh: make(chan struct{}),
+		stopCh:  make(chan struct{}),
+		workers: app.Task.Workers,
+		lease:   seconds(app.Task.Lease_seconds),
+	}
+}
+
+// taskWorkerID 消费者标识：主机名:进程号:序号，多台主机共用数据库时可区分
+func taskWorkerID(n int) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = fmt.Sprintf("host-%d", app.Basic.Host_id)
 	}
+	return fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), n)
 }
 
-// Start 启动任务消费者
-func (tw *TaskWorker) Start() {
-	tw.wg.Add(1)
+// Start 启动任务消费者，ctx 取消后当前任务保存进度并停止
+func (tw *TaskWorker) Start(ctx context.Context) {
 	tw.running = true
-	go func() {
-		defer tw.wg.Done()
-		log.Info("任务消费者已启动，等待任务...")
-
-		// 定时检查间隔
-		ticker := time.NewTicker(10 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-tw.stopCh:
-				log.Info("任务消费者收到停止信号")
-				return
-			case <-taskNotify:
-				// 收到新任务通知，立即处理
-				tw.processPendingTasks()
-			case <-ticker.C:
-				// 定时检查待执行任务
-				tw.processPendingTasks()
-			}
+	log.Infof("启动 %d 个任务消费者，任务租约 %s", tw.workers, tw.lease)
+	for i := 1; i <= tw.workers; i++ {
+		tw.wg.Add(1)
+		go tw.run(ctx, taskWorkerID(i))
+	}
+}
+
+// run 单个消费者的主循环
+func (tw *TaskWorker) run(ctx context.Context, workerID string) {
+	defer tw.wg.Done()
+	log.Infof("任务消费者 %s 已启动，等待任务...", workerID)
+
+	// 定时检查间隔
+	ticker := time.NewTicker(TASK_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("任务消费者 %s 收到退出信号", workerID)
+			return
+		case <-tw.stopCh:
+			log.Infof("任务消费者 %s 收到停止信号", workerID)
+			return
+		case <-taskNotify:
+			// 收到新任务通知，立即处理
+			tw.processPendingTasks(ctx, workerID)
+		case <-ticker.C:
+			// 定时检查待执行任务
+			tw.processPendingTasks(ctx, workerID)
 		}
-	}()
+	}
 }
 
-// Stop 停止任务消费者
+// Stop 停止任务消费者，等待当前任务完成或保存进度
 func (tw *TaskWorker) Stop() {
 	if tw.running {
 		close(tw.stopCh)
@@ -71,56 +149,186 @@ func (tw *TaskWorker) Stop() {
 	}
 }
 
-// processPendingTasks 处理待执行的任务
-func (tw *TaskWorker) processPendingTasks() {
-	for {
-		task, err := tw.fetchNextTask()
+// stopped Stop 是否已被调用
+func (tw *TaskWorker) stopped() bool {
+	select {
+	case <-tw.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// processPendingTasks 依次认领并执行任务，直到没有可认领的任务；Stop 后执行完当前任务即返回，不再认领
+func (tw *TaskWorker) processPendingTasks(ctx context.Context, workerID string) {
+	for ctx.Err() == nil && !tw.stopped() {
+		task, err := tw.claimNextTask(ctx, workerID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				// 没有待执行任务
 				return
 			}
-			log.Errorf("获取任务失败: %v", err)
+			if ctx.Err() == nil {
+				log.Errorf("认领任务失败: %v", err)
+			}
 			return
 		}
+		// 可能还有其他待执行任务，唤醒空闲的消费者
+		notifyTaskWorkers()
 
 		log.Infof("========================================")
-		log.Infof("开始执行任务 ID:%d 关键词:%s", task.ID, task.Keyword)
+		log.Infof("开始执行任务 ID:%d 关键词:%s 站点:%s 消费者:%s", task.ID, task.Keyword, task.domain(), workerID)
 		log.Infof("========================================")
 
-		// 执行爬取任务
-		success := ExecuteCrawlWithStatus(task)
+		// 执行爬取任务，期间定期续期租约；租约被回收时取消执行
+		taskCtx, cancel := context.WithCancel(ctx)
+		go tw.keepLease(taskCtx, task, cancel)
+		done := instance.beginTask("keyword:" + task.Keyword)
+		success := ExecuteCrawlWithStatus(taskCtx, task)
+		done()
+		interrupted := taskCtx.Err() != nil
+		cancel()
+		if !interrupted {
+			recordTaskResult(METRIC_TASK_KEYWORD, task.domain(), success)
+		}
 
-		if success {
-			tw.updateTaskStatus(task.ID, TASK_STATUS_COMPLETED)
+		switch {
+		case success:
 			log.Infof("任务执行成功 ID:%d 关键词:%s", task.ID, task.Keyword)
-		} else {
-			tw.updateTaskStatus(task.ID, TASK_STATUS_FAILED)
+		case interrupted && ctx.Err() == nil:
+			log.Warnf("任务租约已被回收，停止执行 ID:%d 关键词:%s", task.ID, task.Keyword)
+		case interrupted:
+			// 进度已保存，任务重置为待执行，下次启动后继续
+			log.Warnf("任务被中断 ID:%d 关键词:%s", task.ID, task.Keyword)
+		default:
 			log.Errorf("任务执行失败 ID:%d 关键词:%s", task.ID, task.Keyword)
 		}
 	}
 }
 
-// fetchNextTask 从数据库获取下一个待执行任务
-func (tw *TaskWorker) fetchNextTask() (CrawlTask, error) {
-	var task CrawlTask
+// claimNextTask 认领下一个待执行（已到 not_before）或租约已过期的任务，优先级高的先认领，将其标记为执行中并记录消费者和租约到期时间
+// FOR UPDATE SKIP LOCKED 保证多个消费者（包括其他主机上的）不会认领同一任务
+func (tw *TaskWorker) claimNextTask(ctx context.Context, workerID string) (CrawlTask, error) {
+	task := CrawlTask{WorkerID: workerID}
 
-	// 查询一条待执行任务
-	err := app.db.QueryRow(
-		"SELECT id, en_key FROM amc_category WHERE task_status = ? ORDER BY id ASC LIMIT 1",
-		TASK_STATUS_PENDING,
-	).Scan(&task.ID, &task.Keyword)
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return task, err
+	}
+	defer tx.Rollback()
+
+	var status int
+	var previous sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, en_key, task_status, worker_id, COALESCE(callback_url, ''), domain, max_pages, max_asins FROM amc_category
+		WHERE (task_status = ? AND (not_before IS NULL OR not_before <= NOW())) OR (task_status = ? AND lease_expires_at < NOW())
+		ORDER BY priority DESC, id ASC LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		TASK_STATUS_PENDING, TASK_STATUS_RUNNING,
+	).Scan(&task.ID, &task.Keyword, &status, &previous, &task.CallbackURL, &task.Domain, &task.MaxPages, &task.MaxASINs)
+	if err != nil {
+		return task, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE amc_category SET task_status = ?, worker_id = ?, lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND),
+		stage = NULL, error_message = NULL, started_at = NOW(), finished_at = NULL WHERE id = ?`,
+		TASK_STATUS_RUNNING, workerID, int64(tw.lease.Seconds()), task.ID,
+	)
+	if err != nil {
+		return task, err
+	}
+	if err := tx.Commit(); err != nil {
+		return task, err
+	}
+
+	if status == TASK_STATUS_RUNNING {
+		log.Warnf("回收租约已过期的任务 ID:%d 原消费者:%s", task.ID, previous.String)
+	}
+	return task, nil
+}
+
+// keepLease 任务执行期间定期续期租约，租约已被回收时调用 cancel 停止执行
+func (tw *TaskWorker) keepLease(ctx context.Context, task CrawlTask, cancel context.CancelFunc) {
+	ticker := time.NewTicker(tw.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r, err := app.db.ExecContext(ctx,
+				"UPDATE amc_category SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ? AND task_status = ? AND worker_id = ?",
+				int64(tw.lease.Seconds()), task.ID, TASK_STATUS_RUNNING, task.WorkerID,
+			)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Errorf("续期任务租约失败 ID:%d: %v", task.ID, err)
+				}
+				continue
+			}
+			if n, _ := r.RowsAffected(); n == 0 {
+				cancel()
+				return
+			}
+		}
+	}
+}
 
-	return task, err
+// taskExecer *sql.DB 与 *sql.Tx 共有的执行方法，任务状态可在事务内更新
+type taskExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-// updateTaskStatus 更新任务状态
-func (tw *TaskWorker) updateTaskStatus(id int64, status int) {
-	_, err := app.db.Exec(
-		"UPDATE amc_category SET task_status = ? WHERE id = ?",
-		status, id,
+// finishTask 更新任务状态、记录 message 并释放租约，重置为待执行时不记录结束时间，完成时记录 completed_at
+// 任务已不属于 task.WorkerID（租约过期后被其他消费者认领或已取消）时不做修改，返回 ERROR_TASK_LEASE_LOST
+func finishTask(db taskExecer, task CrawlTask, status int, message string) error {
+	finishedAt := "NOW()"
+	if status == TASK_STATUS_PENDING {
+		finishedAt = "NULL"
+	}
+	completedAt := "completed_at"
+	if status == TASK_STATUS_COMPLETED {
+		completedAt = "NOW()"
+	}
+	r, err := db.Exec(
+		"UPDATE amc_category SET task_status = ?, error_message = ?, worker_id = NULL, lease_expires_at = NULL, finished_at = "+finishedAt+", completed_at = "+completedAt+", updated_at = NOW() WHERE id = ? AND worker_id = ?",
+		status, nullableString(truncateRunes(message, 1024)), task.ID, task.WorkerID,
 	)
 	if err != nil {
-		log.Errorf("更新任务状态失败 ID:%d 状态:%d 错误:%v", id, status, err)
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return ERROR_TASK_LEASE_LOST
+	}
+	return nil
+}
+
+// setTaskStatus 更新任务状态，message 为失败原因
+func setTaskStatus(task CrawlTask, status int, message string) error {
+	err := finishTask(app.db, task, status, message)
+	switch err {
+	case nil:
+	case ERROR_TASK_LEASE_LOST:
+		log.Warnf("任务已被其他消费者认领，不更新状态 ID:%d 状态:%d", task.ID, status)
+	default:
+		log.Errorf("更新任务状态失败 ID:%d 状态:%d 错误:%v", task.ID, status, err)
+	}
+	return err
+}
+
+// setTaskStage 记录任务执行到的阶段
+func setTaskStage(task CrawlTask, stage string) {
+	_, err := app.db.Exec("UPDATE amc_category SET stage = ? WHERE id = ? AND worker_id = ?", stage, task.ID, task.WorkerID)
+	if err != nil {
+		log.Errorf("更新任务阶段失败 ID:%d 阶段:%s 错误:%v", task.ID, stage, err)
+	}
+}
+
+// errorMessage 错误的文本，无错误时为空
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
 	}
+	return err.Error()
 }
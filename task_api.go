@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 任务列表分页
+const (
+	TASK_LIST_PAGE_SIZE     = 20  // 默认每页条数
+	TASK_LIST_PAGE_SIZE_MAX = 200 // 每页最多条数
+	TASK_RESULT_LIMIT       = 100 // 任务详情默认返回的商品/卖家条数
+	TASK_RESULT_LIMIT_MAX   = 1000
+)
+
+// taskStatusNames 任务状态名，/api/tasks 的 status 参数和返回值使用
+var taskStatusNames = map[int]string{
+	TASK_STATUS_PENDING:   "pending",
+	TASK_STATUS_COMPLETED: "completed",
+	TASK_STATUS_FAILED:    "failed",
+	TASK_STATUS_RUNNING:   "running",
+	TASK_STATUS_CANCELLED: "cancelled",
+}
+
+// taskStatusName 任务状态名，未知状态返回数字
+func taskStatusName(status int) string {
+	if name, ok := taskStatusNames[status]; ok {
+		return name
+	}
+	return strconv.Itoa(status)
+}
+
+// parseTaskStatus 解析状态名或状态值
+func parseTaskStatus(s string) (int, bool) {
+	for status, name := range taskStatusNames {
+		if s == name || s == strconv.Itoa(status) {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// TaskListFilter /api/tasks 的筛选和分页参数
+type TaskListFilter struct {
+	Statuses []int  // 为空时不限状态
+	Keyword  string // 关键词包含匹配
+	Page     int
+	PageSize int
+}
+
+// parseTaskListFilter 解析查询参数：status（可用逗号分隔多个）、keyword、page、page_size
+func parseTaskListFilter(q url.Values) (TaskListFilter, error) {
+	f := TaskListFilter{Keyword: strings.TrimSpace(q.Get("keyword")), Page: 1, PageSize: TASK_LIST_PAGE_SIZE}
+	if v := q.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			status, ok := parseTaskStatus(strings.TrimSpace(s))
+			if !ok {
+				return f, fmt.Errorf("无效的 status: %s", s)
+			}
+			f.Statuses = append(f.Statuses, status)
+		}
+	}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("page 必须是正整数")
+		}
+		f.Page = n
+	}
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("page_size 必须是正整数")
+		}
+		if n > TASK_LIST_PAGE_SIZE_MAX {
+			n = TASK_LIST_PAGE_SIZE_MAX
+		}
+		f.PageSize = n
+	}
+	return f, nil
+}
+
+// where 生成筛选条件，不含筛选时为空
+func (f TaskListFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "task_status IN (?"+strings.Repeat(", ?", len(f.Statuses)-1)+")")
+		for _, s := range f.Statuses {
+			args = append(args, s)
+		}
+	}
+	if f.Keyword != "" {
+		conds = append(conds, "(en_key LIKE ? OR zh_key LIKE ?)")
+		like := "%" + escapeLike(f.Keyword) + "%"
+		args = append(args, like, like)
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// TaskSummary 任务列表中的一项
+type TaskSummary struct {
+	ID           int64  `json:"id"`
+	Keyword      string `json:"keyword"`
+	ZhKey        string `json:"zh_key"`
+	Status       string `json:"status"`
+	Stage        string `json:"stage"`         // 执行到的阶段：search / product / seller / save
+	ErrorMessage string `json:"error_message"` // 失败原因或部分完成的提示
+	WorkerID     string `json:"worker_id"`
+	CallbackURL  string `json:"callback_url,omitempty"`
+	Domain       string `json:"domain"`
+	Priority     int    `json:"priority"`
+	MaxPages     int    `json:"max_pages"`    // 0 表示 1 页
+	MaxASINs     int    `json:"max_asins"`    // 0 表示不限
+	NotBefore    string `json:"not_before"`   // 最早执行时间
+	RefreshDays  int    `json:"refresh_days"` // 完成后超过该天数自动重新执行，0 表示不自动刷新
+	CompletedAt  string `json:"completed_at"` // 最近一次完成的时间
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+	StartedAt    string `json:"started_at"`
+	FinishedAt   string `json:"finished_at"`
+}
+
+// TASK_SUMMARY_COLUMNS 与 scanTaskSummary 对应的列
+const TASK_SUMMARY_COLUMNS = `id, en_key, zh_key, task_status, COALESCE(stage, ''), COALESCE(error_message, ''), COALESCE(worker_id, ''),
+	COALESCE(callback_url, ''), domain, COALESCE(priority, 0), max_pages, max_asins, COALESCE(not_before, ''), refresh_days, COALESCE(completed_at, ''),
+	created_at, updated_at, COALESCE(started_at, ''), COALESCE(finished_at, '')`
+
+// rowScanner *sql.Row 与 *sql.Rows 共有的 Scan
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTaskSummary 读取 TASK_SUMMARY_COLUMNS
+func scanTaskSummary(row rowScanner) (TaskSummary, error) {
+	var t TaskSummary
+	var status int
+	err := row.Scan(&t.ID, &t.Keyword, &t.ZhKey, &status, &t.Stage, &t.ErrorMessage, &t.WorkerID,
+		&t.CallbackURL, &t.Domain, &t.Priority, &t.MaxPages, &t.MaxASINs, &t.NotBefore, &t.RefreshDays, &t.CompletedAt, &t.CreatedAt, &t.UpdatedAt, &t.StartedAt, &t.FinishedAt)
+	t.Status = taskStatusName(status)
+	return t, err
+}
+
+// listTasks 按筛选条件分页查询任务，按 ID 倒序
+func listTasks(ctx context.Context, f TaskListFilter) ([]TaskSummary, int, error) {
+	where, args := f.where()
+
+	var total int
+	if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM amc_category"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := app.db.QueryContext(ctx,
+		"SELECT "+TASK_SUMMARY_COLUMNS+" FROM amc_category"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []TaskSummary{}
+	for rows.Next() {
+		t, err := scanTaskSummary(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, t)
+	}
+	return list, total, rows.Err()
+}
+
+// TaskSearch 任务关联的 amc_search_statistics 记录
+type TaskSearch struct {
+	ID     int64  `json:"id"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Status int    `json:"status"`
+	App    int    `json:"app"`
+	Valid  int    `json:"valid"` // 有效商品数
+}
+
+// TaskProduct 任务找到的商品
+type TaskProduct struct {
+	ID        int64  `json:"id"`
+	ASIN      string `json:"asin"`
+	Title     string `json:"title"`
+	Price     string `json:"price"`
+	SellerID  string `json:"seller_id"`
+	BrandName string `json:"brand_name"`
+	URL       string `json:"url"`
+	Status    int    `json:"status"`
+}
+
+// TaskSeller 任务找到的卖家
+type TaskSeller struct {
+	SellerID   string `json:"seller_id"`
+	SellerName string `json:"seller_name"`
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	TRN        string `json:"trn"`
+	AllStatus  int    `json:"all_status"`
+	FBLifetime int    `json:"fb_lifetime"`
+}
+
+// TaskDetail 任务详情，商品和卖家按关键词和站点关联，最多返回 limit 条，total 为总数
+type TaskDetail struct {
+	TaskSummary
+	Searches      []TaskSearch  `json:"searches"`
+	ProductsTotal int           `json:"products_total"`
+	Products      []TaskProduct `json:"products"`
+	SellersTotal  int           `json:"sellers_total"`
+	Sellers       []TaskSeller  `json:"sellers"`
+}
+
+// loadTaskDetail 读取任务及其搜索记录、商品和卖家
+func loadTaskDetail(ctx context.Context, id int64, limit int) (*TaskDetail, error) {
+	summary, err := scanTaskSummary(app.db.QueryRowContext(ctx,
+		"SELECT "+TASK_SUMMARY_COLUMNS+" FROM amc_category WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	d := &TaskDetail{TaskSummary: summary, Searches: []TaskSearch{}, Products: []TaskProduct{}, Sellers: []TaskSeller{}}
+
+	rows, err := app.db.QueryContext(ctx,
+		"SELECT id, start, COALESCE(end, ''), COALESCE(status, 0), app, COALESCE(valid, 0) FROM amc_search_statistics WHERE category_id = ? ORDER BY id DESC",
+		id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s TaskSearch
+		if err := rows.Scan(&s.ID, &s.Start, &s.End, &s.Status, &s.App, &s.Valid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Searches = append(d.Searches, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 站点为空的旧任务使用配置文件的 domain
+	domain := d.Domain
+	if domain == "" {
+		domain = app.Domain
+	}
+	if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM amc_product WHERE keyword = ? AND domain = ?", d.Keyword, domain).Scan(&d.ProductsTotal); err != nil {
+		return nil, err
+	}
+	rows, err = app.db.QueryContext(ctx,
+		`SELECT id, COALESCE(asin, ''), COALESCE(title, ''), COALESCE(price, ''), COALESCE(seller_id, ''), COALESCE(brand_name, ''), url, COALESCE(status, 0)
+		FROM amc_product WHERE keyword = ? AND domain = ? ORDER BY id LIMIT ?`, d.Keyword, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p TaskProduct
+		if err := rows.Scan(&p.ID, &p.ASIN, &p.Title, &p.Price, &p.SellerID, &p.BrandName, &p.URL, &p.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Products = append(d.Products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := app.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM amc_seller WHERE keyword = ? AND domain = ?", d.Keyword, domain).Scan(&d.SellersTotal); err != nil {
+		return nil, err
+	}
+	rows, err = app.db.QueryContext(ctx,
+		`SELECT seller_id, COALESCE(seller_name, ''), COALESCE(name, ''), COALESCE(address, ''), COALESCE(trn, ''), COALESCE(all_status, 0), fb_lifetime
+		FROM amc_seller WHERE keyword = ? AND domain = ? ORDER BY id LIMIT ?`, d.Keyword, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s TaskSeller
+		if err := rows.Scan(&s.SellerID, &s.SellerName, &s.Name, &s.Address, &s.TRN, &s.AllStatus, &s.FBLifetime); err != nil {
+			return nil, err
+		}
+		d.Sellers = append(d.Sellers, s)
+	}
+	return d, rows.Err()
+}
+
+// retryTask 将失败或已取消的任务重置为待执行，返回是否修改
+func retryTask(ctx context.Context, id int64) (bool, error) {
+	r, err := app.db.ExecContext(ctx,
+		`UPDATE amc_category SET task_status = ?, stage = NULL, error_message = NULL, started_at = NULL, finished_at = NULL
+		WHERE id = ? AND task_status IN (?, ?)`,
+		TASK_STATUS_PENDING, id, TASK_STATUS_FAILED, TASK_STATUS_CANCELLED)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// cancelTask 取消待执行或执行中的任务，返回是否修改
+// 执行中的任务清除 worker_id 后，原消费者下次续期租约时发现任务已不属于自己，停止执行且不保存结果
+func cancelTask(ctx context.Context, id int64) (bool, error) {
+	r, err := app.db.ExecContext(ctx,
+		`UPDATE amc_category SET task_status = ?, worker_id = NULL, lease_expires_at = NULL, error_message = ?, finished_at = NOW()
+		WHERE id = ? AND task_status IN (?, ?)`,
+		TASK_STATUS_CANCELLED, "已取消", id, TASK_STATUS_PENDING, TASK_STATUS_RUNNING)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// parseTaskPath 解析 /api/tasks/{id}[/retry|/cancel]
+func parseTaskPath(path string) (id int64, action string, ok bool) {
+	rest := strings.Trim(strings.TrimPrefix(path, "/api/tasks/"), "/")
+	if rest == "" {
+		return 0, "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "retry" && parts[1] != "cancel") {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", false
+	}
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	return id, action, true
+}
+
+// handleTasks 分页查询任务
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 GET 方法",
+		})
+		return
+	}
+
+	f, err := parseTaskListFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIResponse{
+			Code:    -1,
+			Message: err.Error(),
+		})
+		return
+	}
+	list, total, err := listTasks(r.Context(), f)
+	if err != nil {
+		log.Errorf("查询任务列表失败: %v", err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "查询任务列表失败",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data: map[string]interface{}{
+			"total":     total,
+			"page":      f.Page,
+			"page_size": f.PageSize,
+			"items":     list,
+		},
+	})
+}
+
+// handleTask 查看任务详情，或重试、取消任务
+func handleTask(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, action, ok := parseTaskPath(r.URL.Path)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIResponse{
+			Code:    -1,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+				Code:    -1,
+				Message: "只支持 GET 方法",
+			})
+			return
+		}
+		limit := TASK_RESULT_LIMIT
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeJSON(w, http.StatusBadRequest, APIResponse{
+					Code:    -1,
+					Message: "limit 必须是正整数",
+				})
+				return
+			}
+			if n > TASK_RESULT_LIMIT_MAX {
+				n = TASK_RESULT_LIMIT_MAX
+			}
+			limit = n
+		}
+		detail, err := loadTaskDetail(r.Context(), id, limit)
+		if err == sql.ErrNoRows {
+			writeJSON(w, http.StatusNotFound, APIResponse{
+				Code:    -1,
+				Message: "任务不存在",
+			})
+			return
+		}
+		if err != nil {
+			log.Errorf("查询任务失败 ID:%d: %v", id, err)
+			writeJSON(w, http.StatusInternalServerError, APIResponse{
+				Code:    -1,
+				Message: "查询任务失败",
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, APIResponse{
+			Code:    0,
+			Message: "ok",
+			Data:    detail,
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, APIResponse{
+			Code:    -1,
+			Message: "只支持 POST 方法",
+		})
+		return
+	}
+	change, conflict := retryTask, "只有失败或已取消的任务可以重试"
+	if action == "cancel" {
+		change, conflict = cancelTask, "只有待执行或执行中的任务可以取消"
+	}
+	changed, err := change(r.Context(), id)
+	if err != nil {
+		log.Errorf("更新任务失败 ID:%d 操作:%s: %v", id, action, err)
+		writeJSON(w, http.StatusInternalServerError, APIResponse{
+			Code:    -1,
+			Message: "更新任务失败",
+		})
+		return
+	}
+	if !changed {
+		// 区分任务不存在和状态不允许
+		var status int
+		if err := app.db.QueryRowContext(r.Context(), "SELECT task_status FROM amc_category WHERE id = ?", id).Scan(&status); err == sql.ErrNoRows {
+			writeJSON(w, http.StatusNotFound, APIResponse{
+				Code:    -1,
+				Message: "任务不存在",
+			})
+			return
+		}
+		writeJSON(w, http.StatusConflict, APIResponse{
+			Code:    -1,
+			Message: fmt.Sprintf("%s，当前状态: %s", conflict, taskStatusName(status)),
+		})
+		return
+	}
+
+	if action == "retry" {
+		log.Infof("任务已重新排队 ID:%d", id)
+		notifyTaskWorkers()
+	} else {
+		log.Infof("任务已取消 ID:%d", id)
+	}
+	summary, err := scanTaskSummary(app.db.QueryRowContext(r.Context(),
+		"SELECT "+TASK_SUMMARY_COLUMNS+" FROM amc_category WHERE id = ?", id))
+	if err != nil {
+		log.Errorf("查询任务失败 ID:%d: %v", id, err)
+	}
+	writeJSON(w, http.StatusOK, APIResponse{
+		Code:    0,
+		Message: "ok",
+		Data:    summary,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestParseTaskPath(t *testing.T) {
+	cases := []struct {
+		path   string
+		id     int64
+		action string
+		ok     bool
+	}{
+		{"/api/tasks/12", 12, "", true},
+		{"/api/tasks/12/", 12, "", true},
+		{"/api/tasks/12/retry", 12, "retry", true},
+		{"/api/tasks/12/cancel", 12, "cancel", true},
+		{"/api/tasks/", 0, "", false},
+		{"/api/tasks/abc", 0, "", false},
+		{"/api/tasks/0", 0, "", false},
+		{"/api/tasks/12/delete", 0, "", false},
+		{"/api/tasks/12/retry/now", 0, "", false},
+	}
+	for _, c := range cases {
+		id, action, ok := parseTaskPath(c.path)
+		got := fmt.Sprintf("%d %s %v", id, action, ok)
+		assertEqual(t, c.path, got, fmt.Sprintf("%d %s %v", c.id, c.action, c.ok))
+	}
+}
+
+func TestParseTaskListFilter(t *testing.T) {
+	f, err := parseTaskListFilter(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "default page", fmt.Sprint(f.Page, f.PageSize, len(f.Statuses)), "1 20 0")
+
+	f, err = parseTaskListFilter(url.Values{"status": {"failed, 4"}, "keyword": {" nike "}, "page": {"3"}, "page_size": {"1000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "statuses", fmt.Sprint(f.Statuses), fmt.Sprint([]int{TASK_STATUS_FAILED, TASK_STATUS_CANCELLED}))
+	assertEqual(t, "keyword", f.Keyword, "nike")
+	assertEqual(t, "page", strconv.Itoa(f.Page), "3")
+	assertEqual(t, "page_size capped", strconv.Itoa(f.PageSize), strconv.Itoa(TASK_LIST_PAGE_SIZE_MAX))
+
+	for _, bad := range []url.Values{{"status": {"done"}}, {"page": {"0"}}, {"page_size": {"x"}}} {
+		if _, err := parseTaskListFilter(bad); err == nil {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+}
+
+func TestTaskListFilterWhere(t *testing.T) {
+	where, args := TaskListFilter{}.where()
+	assertEqual(t, "empty", where, "")
+	assertEqual(t, "empty args", strconv.Itoa(len(args)), "0")
+
+	where, args = TaskListFilter{Statuses: []int{TASK_STATUS_FAILED, TASK_STATUS_CANCELLED}, Keyword: "50%_off"}.where()
+	assertEqual(t, "where", where, " WHERE task_status IN (?, ?) AND (en_key LIKE ? OR zh_key LIKE ?)")
+	assertEqual(t, "args", fmt.Sprint(args), `[2 4 %50\%\_off% %50\%\_off%]`)
+}
+
+func TestTaskStatusName(t *testing.T) {
+	assertEqual(t, "cancelled", taskStatusName(TASK_STATUS_CANCELLED), "cancelled")
+	assertEqual(t, "unknown", taskStatusName(9), "9")
+	status, ok := parseTaskStatus("running")
+	assertEqual(t, "parse", fmt.Sprint(status, ok), fmt.Sprint(TASK_STATUS_RUNNING, true))
+}
+
+func TestHandleTaskRejectsBadRequests(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/tasks/abc", http.StatusNotFound},
+		{http.MethodGet, "/api/tasks/12/retry", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/tasks/12", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/tasks/12?limit=-1", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		handleTask(rec, httptest.NewRequest(c.method, c.path, nil))
+		assertEqual(t, c.method+" "+c.path, strconv.Itoa(rec.Code), strconv.Itoa(c.want))
+	}
+
+	rec := httptest.NewRecorder()
+	handleTasks(rec, httptest.NewRequest(http.MethodGet, "/api/tasks?status=done", nil))
+	assertEqual(t, "bad status", strconv.Itoa(rec.Code), "400")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTaskConfigDefaults(t *testing.T) {
+	c := TaskConfig{}.withDefaults()
+	assertEqual(t, "workers", fmt.Sprint(c.Workers), "1")
+	assertEqual(t, "lease", fmt.Sprint(c.Lease_seconds), "600")
+
+	c = TaskConfig{Workers: 4, Lease_seconds: 120}.withDefaults()
+	assertEqual(t, "workers", fmt.Sprint(c.Workers), "4")
+	assertEqual(t, "lease", fmt.Sprint(c.Lease_seconds), "120")
+}
+
+func TestTaskWorkerIDIdentifiesHostProcessAndSlot(t *testing.T) {
+	id := taskWorkerID(2)
+	if !strings.HasSuffix(id, fmt.Sprintf(":%d:2", os.Getpid())) {
+		t.Fatalf("worker id = %q", id)
+	}
+	if id == taskWorkerID(3) {
+		t.Fatal("worker ids must differ between slots")
+	}
+}
+
+func TestTaskWorkerStopsClaimingAfterStop(t *testing.T) {
+	tw := &TaskWorker{stopCh: make(chan struct{})}
+	assertEqual(t, "running", fmt.Sprint(tw.stopped()), "false")
+	close(tw.stopCh)
+	assertEqual(t, "stopped", fmt.Sprint(tw.stopped()), "true")
+	// app.db 为空，认领任务会 panic；停止后不应再认领
+	tw.processPendingTasks(context.Background(), "test:1:1")
+}
+
+func TestEndSessionIgnoresSwitchedCookie(t *testing.T) {
+	oldID, oldRejected := app.cookieID, app.rejectedCookieID
+	t.Cleanup(func() { app.cookieID, app.rejectedCookieID = oldID, oldRejected })
+
+	app.cookieID, app.rejectedCookieID = 7, 0
+	app.endSession(requestSession{cookieID: 5}, nil, true)
+	assertEqual(t, "stale session", fmt.Sprint(app.rejectedCookieID), "0")
+
+	app.endSession(requestSession{cookieID: 7}, nil, true)
+	assertEqual(t, "current session", fmt.Sprint(app.rejectedCookieID), "7")
+}
+
+func TestHandleCookieInvalidSkipsAlreadySwitchedCookie(t *testing.T) {
+	oldID, oldRejected := app.cookieID, app.rejectedCookieID
+	t.Cleanup(func() { app.cookieID, app.rejectedCookieID = oldID, oldRejected })
+
+	// 其他消费者已切换到 cookie 8，旧 cookie 7 的拒绝不应再次触发切换
+	app.cookieID, app.rejectedCookieID = 8, 7
+	if err := app.handleCookieInvalid(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "cookie id", fmt.Sprint(app.cookieID), "8")
+}
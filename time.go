@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"time"
-
-	log "github.com/tengfei-xy/go-log"
 )
 
-// 随机挂起 x 秒
-func sleep(i int) {
-	log.Infof("挂起%d秒", i)
-	time.Sleep(time.Duration(i) * time.Second)
+// sleepContext 挂起 d，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
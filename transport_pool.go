@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// NetworkConfig 连接池与超时配置，时间单位均为秒
+type NetworkConfig struct {
+	Max_idle_conns          int `yaml:"max_idle_conns"`          // 所有主机的最大空闲连接数，默认 100
+	Max_idle_conns_per_host int `yaml:"max_idle_conns_per_host"` // 每个主机的最大空闲连接数，默认 10
+	Idle_conn_timeout       int `yaml:"idle_conn_timeout"`       // 空闲连接保留时间，默认 90
+	Dial_timeout            int `yaml:"dial_timeout"`            // 建立连接超时，默认 10
+	Tls_handshake_timeout   int `yaml:"tls_handshake_timeout"`   // TLS 握手超时，默认 10
+	Response_header_timeout int `yaml:"response_header_timeout"` // 等待响应头超时，默认 30
+	Request_timeout         int `yaml:"request_timeout"`         // 单次请求总超时，默认 60
+}
+
+// withDefaults 未配置的项使用默认值
+func (c NetworkConfig) withDefaults() NetworkConfig {
+	setDefault := func(v *int, d int) {
+		if *v <= 0 {
+			*v = d
+		}
+	}
+	setDefault(&c.Max_idle_conns, 100)
+	setDefault(&c.Max_idle_conns_per_host, 10)
+	setDefault(&c.Idle_conn_timeout, 90)
+	setDefault(&c.Dial_timeout, 10)
+	setDefault(&c.Tls_handshake_timeout, 10)
+	setDefault(&c.Response_header_timeout, 30)
+	setDefault(&c.Request_timeout, 60)
+	return c
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// transportPool 按代理地址复用 http.Transport，使 keep-alive 连接和 TLS 会话得以复用
+type transportPool struct {
+	mu         sync.Mutex
+	cfg        NetworkConfig
+	tlsConfig  *tls.Config // 为空时使用系统默认，测试时注入自签名证书
+	transports map[string]*http.Transport
+}
+
+var transports = newTransportPool(NetworkConfig{})
+
+func newTransportPool(cfg NetworkConfig) *transportPool {
+	return &transportPool{
+		cfg:        cfg.withDefaults(),
+		transports: make(map[string]*http.Transport),
+	}
+}
+
+// Get 获取代理地址对应的传输层，proxyAddr 为空表示直连
+func (p *transportPool) Get(proxyAddr string) *http.Transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t, ok := p.transports[proxyAddr]; ok {
+		return t
+	}
+	t := p.newTransport(proxyAddr)
+	p.transports[proxyAddr] = t
+	return t
+}
+
+// Client 创建使用池中传输层的客户端，http.Client 本身很轻量，可以每次创建
+func (p *transportPool) Client(proxyAddr string) http.Client {
+	return http.Client{
+		Transport: p.Get(proxyAddr),
+		Timeout:   seconds(p.cfg.Request_timeout),
+	}
+}
+
+// CloseIdleConnections 关闭所有空闲连接
+func (p *transportPool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+func (p *transportPool) newTransport(proxyAddr string) *http.Transport {
+	direct := &net.Dialer{
+		Timeout:   seconds(p.cfg.Dial_timeout),
+		KeepAlive: 30 * time.Second,
+	}
+	t := &http.Transport{
+		DialContext:           direct.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          p.cfg.Max_idle_conns,
+		MaxIdleConnsPerHost:   p.cfg.Max_idle_conns_per_host,
+		IdleConnTimeout:       seconds(p.cfg.Idle_conn_timeout),
+		TLSHandshakeTimeout:   seconds(p.cfg.Tls_handshake_timeout),
+		ResponseHeaderTimeout: seconds(p.cfg.Response_header_timeout),
+		TLSClientConfig:       p.tlsConfig,
+	}
+	if proxyAddr == "" {
+		return t
+	}
+
+	u, err := parseProxyURL(proxyAddr)
+	if err != nil {
+		// 代理地址无效时请求直接失败，不能退回直连
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, err
+		}
+		return t
+	}
+
+	switch u.Scheme {
+	case PROXY_SCHEME_HTTP, PROXY_SCHEME_HTTPS:
+		// HTTP(S) 代理，https 目标通过 CONNECT 建立隧道，认证信息由 net/http 写入 Proxy-Authorization
+		t.Proxy = http.ProxyURL(u)
+		return t
+	}
+
+	// SOCKS5 拨号器，经由代理建立连接
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", u.Host, auth, direct)
+	if err != nil {
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, err
+		}
+		return t
+	}
+	if cd, ok := dialer.(proxy.ContextDialer); ok {
+		t.DialContext = cd.DialContext
+	} else {
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		}
+	}
+	return t
+}
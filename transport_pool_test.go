@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingTLSServer 启动本地 TLS 服务，并统计新建连接数
+func newCountingTLSServer(tb testing.TB) (*httptest.Server, *int64) {
+	tb.Helper()
+	var conns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><span id="productTitle">Widget</span></html>`)
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.StartTLS()
+	tb.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func newTestTransportPool(srv *httptest.Server) *transportPool {
+	p := newTransportPool(NetworkConfig{})
+	p.tlsConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	return p
+}
+
+func doGet(tb testing.TB, client http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestTransportPoolReusesConnections(t *testing.T) {
+	srv, conns := newCountingTLSServer(t)
+	pool := newTestTransportPool(srv)
+
+	for i := 0; i < 10; i++ {
+		doGet(t, pool.Client(""), srv.URL)
+	}
+	if got := atomic.LoadInt64(conns); got != 1 {
+		t.Fatalf("new connections = %d, want 1", got)
+	}
+	if pool.Get("") != pool.Get("") {
+		t.Fatal("same proxy address should share one transport")
+	}
+	if pool.Get("") == pool.Get("127.0.0.1:1080") {
+		t.Fatal("different proxy addresses should use different transports")
+	}
+}
+
+func TestNetworkConfigDefaults(t *testing.T) {
+	cfg := NetworkConfig{Max_idle_conns_per_host: 4}.withDefaults()
+	if cfg.Max_idle_conns_per_host != 4 || cfg.Max_idle_conns != 100 || cfg.Request_timeout != 60 {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	tr := newTransportPool(cfg).Get("")
+	if tr.MaxIdleConnsPerHost != 4 || tr.IdleConnTimeout != seconds(90) {
+		t.Fatalf("transport not configured from config: %d %s", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+}
+
+// BenchmarkTransportPool 复用连接池中的传输层
+func BenchmarkTransportPool(b *testing.B) {
+	srv, conns := newCountingTLSServer(b)
+	pool := newTestTransportPool(srv)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doGet(b, pool.Client(""), srv.URL)
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+}
+
+// BenchmarkTransportPerRequest 旧的做法：每次请求新建传输层，每次都要重新握手
+func BenchmarkTransportPerRequest(b *testing.B) {
+	srv, conns := newCountingTLSServer(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool := newTestTransportPool(srv)
+		doGet(b, pool.Client(""), srv.URL)
+		pool.CloseIdleConnections()
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(conns))/float64(b.N), "conns/op")
+}
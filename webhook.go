@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/tengfei-xy/go-log"
+)
+
+// 回调事件
+const (
+	WEBHOOK_EVENT_TASK_COMPLETED           = "task.completed"
+	WEBHOOK_EVENT_TASK_PARTIAL             = "task.partial"
+	WEBHOOK_EVENT_TASK_FAILED              = "task.failed"
+	WEBHOOK_EVENT_INSPECTION_JOB_COMPLETED = "inspection_job.completed"
+)
+
+// 回调对象类型，对应 amc_webhook_delivery.target_type
+const (
+	WEBHOOK_TARGET_TASK           = "task"
+	WEBHOOK_TARGET_INSPECTION_JOB = "inspection_job"
+)
+
+// 回调投递状态
+const (
+	WEBHOOK_DELIVERY_PENDING   = 0 // 待投递或等待重试
+	WEBHOOK_DELIVERY_DELIVERED = 1 // 已投递
+	WEBHOOK_DELIVERY_FAILED    = 2 // 超过最大次数，放弃投递
+)
+
+// WEBHOOK_CALLBACK_URL_MAX 回调地址最大长度，与 callback_url 列长度一致
+const WEBHOOK_CALLBACK_URL_MAX = 1024
+
+// WebhookConfig 任务完成回调配置
+type WebhookConfig struct {
+	Secret             string   `yaml:"secret"`             // HMAC-SHA256 签名密钥，为空时读取环境变量 CRAWLER_WEBHOOK_SECRET
+	Timeout_seconds    int      `yaml:"timeout_seconds"`    // 单次投递超时（秒），默认 10
+	Max_attempts       int      `yaml:"max_attempts"`       // 最多投递次数，默认 6
+	Retry_base_seconds int      `yaml:"retry_base_seconds"` // 首次重试间隔（秒），之后每次翻倍，默认 30
+	Retry_max_seconds  int      `yaml:"retry_max_seconds"`  // 重试间隔上限（秒），默认 3600
+	Allowed_hosts      []string `yaml:"allowed_hosts"`      // 允许解析到内网、本机地址的回调主机，其他主机只能解析到公网地址
+}
+
+// withDefaults 填充未配置的字段
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.Secret == "" {
+		c.Secret = strings.TrimSpace(os.Getenv("CRAWLER_WEBHOOK_SECRET"))
+	}
+	if c.Timeout_seconds <= 0 {
+		c.Timeout_seconds = 10
+	}
+	if c.Max_attempts <= 0 {
+		c.Max_attempts = 6
+	}
+	if c.Retry_base_seconds <= 0 {
+		c.Retry_base_seconds = 30
+	}
+	if c.Retry_max_seconds <= 0 {
+		c.Retry_max_seconds = 3600
+	}
+	return c
+}
+
+// TaskWebhookPayload 关键词任务结束的回调内容
+type TaskWebhookPayload struct {
+	Event        string `json:"event"`
+	TaskID       int64  `json:"task_id"`
+	Keyword      string `json:"keyword"`
+	Status       string `json:"status"` // completed / partial / failed
+	Products     int    `json:"products"`
+	SellersFound int    `json:"sellers_found"`
+	Sellers      int    `json:"sellers"`
+	Error        string `json:"error,omitempty"`
+	FinishedAt   string `json:"finished_at"`
+}
+
+// InspectionJobWebhookPayload 异步巡检任务完成的回调内容
+type InspectionJobWebhookPayload struct {
+	Event      string `json:"event"`
+	ID         int64  `json:"id"`
+	JobID      string `json:"job_id,omitempty"`
+	Domain     string `json:"domain"`
+	Status     string `json:"status"`
+	Total      int    `json:"total"`
+	Done       int    `json:"done"`
+	Failed     int    `json:"failed"`
+	FinishedAt string `json:"finished_at"`
+}
+
+// taskWebhookPayload 根据任务结果生成回调内容
+func taskWebhookPayload(task CrawlTask, outcome CrawlOutcome, finishedAt time.Time) TaskWebhookPayload {
+	event := WEBHOOK_EVENT_TASK_COMPLETED
+	switch outcome.Status {
+	case CRAWL_OUTCOME_PARTIAL:
+		event = WEBHOOK_EVENT_TASK_PARTIAL
+	case CRAWL_OUTCOME_FAILED:
+		event = WEBHOOK_EVENT_TASK_FAILED
+	}
+	p := TaskWebhookPayload{
+		Event:        event,
+		TaskID:       task.ID,
+		Keyword:      task.Keyword,
+		Status:       outcome.Status,
+		Products:     outcome.Products,
+		SellersFound: outcome.SellersFound,
+		Sellers:      outcome.Sellers,
+		FinishedAt:   finishedAt.UTC().Format(time.RFC3339),
+	}
+	if outcome.Err != nil {
+		p.Error = outcome.Err.Error()
+	}
+	return p
+}
+
+// WEBHOOK_RESOLVE_TIMEOUT 登记回调地址时解析主机的超时
+const WEBHOOK_RESOLVE_TIMEOUT = 5 * time.Second
+
+// 回调地址不能指向的地址段（回环、内网、链路本地等由 net.IP 的方法判断）
+var callbackBlockedNets = parseCIDRs(
+	"0.0.0.0/8",      // 本网络
+	"100.64.0.0/10",  // 运营商级 NAT
+	"192.0.0.0/24",   // IETF 协议分配
+	"198.18.0.0/15",  // 基准测试
+	"240.0.0.0/4",    // 保留
+	"64:ff9b:1::/48", // 本地 NAT64
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isPublicCallbackIP 是否为可以接收回调的公网地址
+func isPublicCallbackIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range callbackBlockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// callbackHostAllowed 主机是否在 webhook.allowed_hosts 中
+func callbackHostAllowed(host string) bool {
+	for _, allowed := range app.Webhook.Allowed_hosts {
+		if strings.EqualFold(strings.TrimSpace(allowed), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析回调主机，测试时可替换
+var lookupCallbackIP = net.DefaultResolver.LookupIPAddr
+
+// resolveCallbackHost 解析回调主机，任一地址不是公网地址时拒绝（allowed_hosts 中的主机除外）
+// 登记回调和投递时都会检查，投递时只连接检查过的地址，避免 DNS 重新绑定到内网
+func resolveCallbackHost(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(host)
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := lookupCallbackIP(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析回调主机 %s: %w", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("无法解析回调主机 %s", host)
+	}
+	if callbackHostAllowed(host) {
+		return ips, nil
+	}
+	for _, ip := range ips {
+		if !isPublicCallbackIP(ip) {
+			return nil, fmt.Errorf("回调主机 %s 指向内网或本机地址 %s，如需使用请加入 webhook.allowed_hosts", host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// dialCallback 投递回调时建立连接，只连接 resolveCallbackHost 检查过的地址（包括重定向后的地址）
+func dialCallback(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolveCallbackHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// newWebhookClient 投递回调使用的客户端，不走环境变量中的代理，连接前检查目标地址
+func newWebhookClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialCallback,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// validateCallbackURL 检查回调地址，只接受解析到公网地址的 http/https 绝对地址
+func validateCallbackURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > WEBHOOK_CALLBACK_URL_MAX {
+		return fmt.Errorf("callback_url 不能超过 %d 个字符", WEBHOOK_CALLBACK_URL_MAX)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url 必须是 http 或 https 地址: %s", raw)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), WEBHOOK_RESOLVE_TIMEOUT)
+	defer cancel()
+	if _, err := resolveCallbackHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("callback_url 无效: %v", err)
+	}
+	return nil
+}
+
+// nullableString 空字符串写入数据库时为 NULL
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// 回调通知 channel，登记回调后唤醒投递消费者
+var webhookNotify = make(chan struct{}, 1)
+
+// notifyWebhookWorker 唤醒投递消费者
+func notifyWebhookWorker() {
+	select {
+	case webhookNotify <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueWebhook 登记一次回调，由投递消费者异步发送
+// 任务结束时根 context 可能已取消，因此不使用 context
+func enqueueWebhook(event, targetType string, targetID int64, callbackURL string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Errorf("生成回调内容失败 %s:%d: %v", targetType, targetID, err)
+		return
+	}
+	_, err = app.db.Exec(
+		`INSERT INTO amc_webhook_delivery (event, target_type, target_id, url, payload, status, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())`,
+		event, targetType, targetID, callbackURL, string(data), WEBHOOK_DELIVERY_PENDING)
+	if err != nil {
+		log.Errorf("登记回调失败 %s:%d: %v", targetType, targetID, err)
+		return
+	}
+	log.Infof("已登记回调 %s %s:%d", event, targetType, targetID)
+	notifyWebhookWorker()
+}
+
+// enqueueTaskWebhook 登记关键词任务结束的回调
+func enqueueTaskWebhook(task CrawlTask, outcome CrawlOutcome) {
+	p := taskWebhookPayload(task, outcome, time.Now())
+	enqueueWebhook(p.Event, WEBHOOK_TARGET_TASK, task.ID, task.CallbackURL, p)
+}
+
+// signWebhook 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，以 sha256= 开头的十六进制
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 第 attempt 次投递失败后的重试间隔，从 base 开始每次翻倍，不超过 max
+func webhookBackoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// webhookDelivery amc_webhook_delivery 中的一条待投递记录
+type webhookDelivery struct {
+	ID       int64
+	Event    string
+	URL      string
+	Payload  []byte
+	Attempts int // 包括本次在内的投递次数
+}
+
+// deliverWebhook 发送一次回调，2xx 视为成功
+// 请求头：X-Crawler-Event 事件名，X-Crawler-Delivery 投递 ID（重试时不变，可用于去重），
+// X-Crawler-Timestamp Unix 秒，X-Crawler-Signature 签名（配置了密钥时）
+func deliverWebhook(ctx context.Context, client *http.Client, secret string, d webhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "amazon-crawler-webhook/"+buildVersion())
+	req.Header.Set("X-Crawler-Event", d.Event)
+	req.Header.Set("X-Crawler-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Crawler-Timestamp", timestamp)
+	if secret != "" {
+		req.Header.Set("X-Crawler-Signature", signWebhook(secret, timestamp, d.Payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("回调返回 HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// WebhookWorker 回调投递消费者，多台主机共用数据库时通过 FOR UPDATE SKIP LOCKED 避免重复投递
+type WebhookWorker struct {
+	wg     sync.WaitGroup
+	client *http.Client
+	cfg    WebhookConfig
+}
+
+// StartWebhookWorker 启动回调投递消费者，返回的函数等待消费者退出
+func StartWebhookWorker(ctx context.Context) (wait func()) {
+	cfg := app.Webhook
+	if cfg.Secret == "" {
+		log.Warnf("未配置 webhook.secret，回调不带签名")
+	}
+	w := &WebhookWorker{client: newWebhookClient(seconds(cfg.Timeout_seconds)), cfg: cfg}
+	w.wg.Add(1)
+	go w.run(ctx)
+	return w.wg.Wait
+}
+
+// run 投递消费者的主循环
+func (w *WebhookWorker) run(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(TASK_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		w.processDueDeliveries(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-webhookNotify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDueDeliveries 依次投递到期的回调，直到没有可投递的记录
+func (w *WebhookWorker) processDueDeliveries(ctx context.Context) {
+	for ctx.Err() == nil {
+		d, err := w.claimNextDelivery(ctx)
+		if err != nil {
+			if err != sql.ErrNoRows && ctx.Err() == nil {
+				log.Errorf("读取待投递回调失败: %v", err)
+			}
+			return
+		}
+		code, err := deliverWebhook(ctx, w.client, w.cfg.Secret, d, time.Now())
+		if ctx.Err() != nil {
+			// 退出时中断的投递不计入次数，下次启动后重新投递
+			w.release(d)
+			return
+		}
+		w.record(d, code, err)
+	}
+}
+
+// claimNextDelivery 认领一条到期的回调并计入投递次数
+// next_attempt_at 推迟到超时之后，投递中进程崩溃时由其他实例重新投递
+func (w *WebhookWorker) claimNextDelivery(ctx context.Context) (webhookDelivery, error) {
+	var d webhookDelivery
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return d, err
+	}
+	defer tx.Rollback()
+
+	var payload string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, event, url, payload, attempts FROM amc_webhook_delivery
+		WHERE status = ? AND next_attempt_at <= NOW()
+		ORDER BY next_attempt_at ASC, id ASC LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		WEBHOOK_DELIVERY_PENDING,
+	).Scan(&d.ID, &d.Event, &d.URL, &payload, &d.Attempts)
+	if err != nil {
+		return d, err
+	}
+	d.Payload = []byte(payload)
+	d.Attempts++
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE amc_webhook_delivery SET attempts = ?, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ?",
+		d.Attempts, w.cfg.Timeout_seconds*2, d.ID)
+	if err != nil {
+		return d, err
+	}
+	return d, tx.Commit()
+}
+
+// record 保存投递结果，失败时按退避间隔安排重试，超过最大次数后放弃
+func (w *WebhookWorker) record(d webhookDelivery, code int, deliverErr error) {
+	var err error
+	switch {
+	case deliverErr == nil:
+		_, err = app.db.Exec(
+			"UPDATE amc_webhook_delivery SET status = ?, last_status_code = ?, last_error = NULL, delivered_at = NOW() WHERE id = ?",
+			WEBHOOK_DELIVERY_DELIVERED, code, d.ID)
+		log.Infof("回调投递成功 ID:%d 事件:%s 第%d次", d.ID, d.Event, d.Attempts)
+	case d.Attempts >= w.cfg.Max_attempts:
+		_, err = app.db.Exec(
+			"UPDATE amc_webhook_delivery SET status = ?, last_status_code = ?, last_error = ? WHERE id = ?",
+			WEBHOOK_DELIVERY_FAILED, code, truncateRunes(deliverErr.Error(), 1024), d.ID)
+		log.Errorf("回调投递失败，已达最大次数 ID:%d 地址:%s 错误:%v", d.ID, d.URL, deliverErr)
+	default:
+		delay := webhookBackoff(d.Attempts, seconds(w.cfg.Retry_base_seconds), seconds(w.cfg.Retry_max_seconds))
+		_, err = app.db.Exec(
+			"UPDATE amc_webhook_delivery SET last_status_code = ?, last_error = ?, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE id = ?",
+			code, truncateRunes(deliverErr.Error(), 1024), int64(delay.Seconds()), d.ID)
+		log.Warnf("回调投递失败，%s 后重试 ID:%d 第%d次 错误:%v", delay, d.ID, d.Attempts, deliverErr)
+	}
+	if err != nil {
+		log.Errorf("保存回调投递结果失败 ID:%d: %v", d.ID, err)
+	}
+}
+
+// release 退出时归还未完成的投递，退出时 ctx 已取消，因此不使用 context
+func (w *WebhookWorker) release(d webhookDelivery) {
+	_, err := app.db.Exec(
+		"UPDATE amc_webhook_delivery SET attempts = attempts - 1, next_attempt_at = NOW() WHERE id = ? AND status = ?",
+		d.ID, WEBHOOK_DELIVERY_PENDING)
+	if err != nil {
+		log.Errorf("归还回调投递失败 ID:%d: %v", d.ID, err)
+	}
+}
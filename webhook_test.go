@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfigDefaults(t *testing.T) {
+	t.Setenv("CRAWLER_WEBHOOK_SECRET", "from-env")
+	c := WebhookConfig{}.withDefaults()
+	assertEqual(t, "secret", c.Secret, "from-env")
+	assertEqual(t, "timeout", strconv.Itoa(c.Timeout_seconds), "10")
+	assertEqual(t, "attempts", strconv.Itoa(c.Max_attempts), "6")
+	assertEqual(t, "base", strconv.Itoa(c.Retry_base_seconds), "30")
+	assertEqual(t, "max", strconv.Itoa(c.Retry_max_seconds), "3600")
+
+	c = WebhookConfig{Secret: "configured"}.withDefaults()
+	assertEqual(t, "configured secret", c.Secret, "configured")
+}
+
+func TestSignWebhook(t *testing.T) {
+	got := signWebhook("secret", "1700000000", []byte(`{"event":"task.completed"}`))
+	assertEqual(t, "signature", got, "sha256=8476087d712b027a668e5e7019c04b9b70e5a33b56bba5e57c8aa39aa44ea5e3")
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	base, max := 30*time.Second, 5*time.Minute
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{30, 5 * time.Minute},
+	}
+	for _, c := range cases {
+		assertEqual(t, "attempt "+strconv.Itoa(c.attempt), webhookBackoff(c.attempt, base, max).String(), c.want.String())
+	}
+}
+
+// stubCallbackDNS 替换回调主机解析
+func stubCallbackDNS(t *testing.T, hosts map[string]string) {
+	t.Helper()
+	oldLookup, oldAllowed := lookupCallbackIP, app.Webhook.Allowed_hosts
+	lookupCallbackIP = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ip, ok := hosts[host]
+		if !ok {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+	t.Cleanup(func() { lookupCallbackIP, app.Webhook.Allowed_hosts = oldLookup, oldAllowed })
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	stubCallbackDNS(t, map[string]string{
+		"example.com":        "93.184.216.34",
+		"hook.internal":      "10.0.0.5",
+		"metadata.rebind.io": "169.254.169.254",
+	})
+	app.Webhook.Allowed_hosts = []string{"hook.internal"}
+
+	for _, ok := range []string{"", "https://example.com/hook", "http://93.184.216.34:9000/cb?x=1", "https://HOOK.internal/cb"} {
+		if err := validateCallbackURL(ok); err != nil {
+			t.Errorf("%q: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{
+		"example.com/hook", "ftp://example.com", "https://", "https://example.com/" + string(make([]byte, 1024)),
+		"http://127.0.0.1/cb", "http://localhost/cb", "http://10.0.0.2:9000/cb", "http://192.168.1.1/cb", "http://172.16.0.1/cb",
+		"http://169.254.169.254/latest/meta-data/", "http://metadata.rebind.io/", "http://[::1]/cb", "http://[::ffff:127.0.0.1]/cb",
+		"http://[fd00::1]/cb", "http://0.0.0.0/cb", "http://100.64.0.1/cb",
+	} {
+		if err := validateCallbackURL(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	stubCallbackDNS(t, nil)
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := newWebhookClient(time.Second)
+	d := webhookDelivery{ID: 1, Event: WEBHOOK_EVENT_TASK_COMPLETED, URL: srv.URL, Payload: []byte(`{}`)}
+	if _, err := deliverWebhook(context.Background(), client, "", d, time.Now()); err == nil || hits != 0 {
+		t.Fatalf("loopback delivery err = %v, hits = %d", err, hits)
+	}
+
+	app.Webhook.Allowed_hosts = []string{"127.0.0.1"}
+	if _, err := deliverWebhook(context.Background(), client, "", d, time.Now()); err != nil || hits != 1 {
+		t.Fatalf("allowed delivery err = %v, hits = %d", err, hits)
+	}
+}
+
+func TestTaskWebhookPayload(t *testing.T) {
+	task := CrawlTask{ID: 12, Keyword: "nike"}
+	finished := time.Date(2026, 6, 6, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+	p := taskWebhookPayload(task, CrawlOutcome{Status: CRAWL_OUTCOME_PARTIAL, Products: 120, SellersFound: 35, Sellers: 33, Err: errors.New("2 个卖家详情获取失败")}, finished)
+	assertEqual(t, "event", p.Event, WEBHOOK_EVENT_TASK_PARTIAL)
+	assertEqual(t, "error", p.Error, "2 个卖家详情获取失败")
+	assertEqual(t, "finished", p.FinishedAt, "2026-06-06T00:00:00Z")
+	assertEqual(t, "sellers", strconv.Itoa(p.Sellers)+"/"+strconv.Itoa(p.SellersFound), "33/35")
+
+	p = taskWebhookPayload(task, CrawlOutcome{Status: CRAWL_OUTCOME_FAILED, Err: errors.New("搜索阶段失败")}, finished)
+	assertEqual(t, "failed event", p.Event, WEBHOOK_EVENT_TASK_FAILED)
+
+	p = taskWebhookPayload(task, CrawlOutcome{Status: CRAWL_OUTCOME_COMPLETED}, finished)
+	assertEqual(t, "completed event", p.Event, WEBHOOK_EVENT_TASK_COMPLETED)
+	assertEqual(t, "completed error", p.Error, "")
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	d := webhookDelivery{ID: 7, Event: WEBHOOK_EVENT_TASK_COMPLETED, URL: srv.URL, Payload: []byte(`{"event":"task.completed"}`)}
+	now := time.Unix(1700000000, 0)
+	code, err := deliverWebhook(context.Background(), srv.Client(), "secret", d, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "code", strconv.Itoa(code), "204")
+	assertEqual(t, "body", gotBody, string(d.Payload))
+	assertEqual(t, "event", gotHeader.Get("X-Crawler-Event"), WEBHOOK_EVENT_TASK_COMPLETED)
+	assertEqual(t, "delivery", gotHeader.Get("X-Crawler-Delivery"), "7")
+	assertEqual(t, "timestamp", gotHeader.Get("X-Crawler-Timestamp"), "1700000000")
+	assertEqual(t, "signature", gotHeader.Get("X-Crawler-Signature"), signWebhook("secret", "1700000000", d.Payload))
+
+	// 未配置密钥时不带签名
+	if _, err := deliverWebhook(context.Background(), srv.Client(), "", d, now); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "unsigned", gotHeader.Get("X-Crawler-Signature"), "")
+
+	status = http.StatusInternalServerError
+	code, err = deliverWebhook(context.Background(), srv.Client(), "secret", d, now)
+	if err == nil {
+		t.Fatal("expected error for HTTP 500")
+	}
+	assertEqual(t, "error code", strconv.Itoa(code), "500")
+}
+
+func TestHandleCrawlRejectsInvalidCallbackURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/crawl", strings.NewReader(`{"keywords":["nike"],"callback_url":"ftp://example.com"}`))
+	rec := httptest.NewRecorder()
+	handleCrawl(rec, req)
+	assertEqual(t, "status", strconv.Itoa(rec.Code), "400")
+}